@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/esdandreu/go-protoc/pkg/breaking"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrBreakingChanges is returned by the breaking subcommand when the protos
+// are not compatible with the baseline.
+var ErrBreakingChanges = errors.New("breaking changes found")
+
+// runBreaking implements `go-protoc breaking --against <baseline>`. The
+// current protos are compiled with the cached protoc and compared with the
+// baseline, which is either a descriptor set file or a git ref whose version
+// of the working directory is compiled the same way. Remaining arguments are
+// forwarded to protoc, e.g. include paths or the proto files to compare.
+func runBreaking(cache BinCache, w io.Writer, args ...string) error {
+	args, against, _ := ExtractFlagValue(args, "against")
+	if against == "" {
+		return errors.New("breaking: --against <descriptor set|git ref> is required")
+	}
+
+	current, err := compileDescriptorSet(cache, ".", args, true)
+	if err != nil {
+		return fmt.Errorf("failed to compile current protos: %w", err)
+	}
+	baseline, err := baselineDescriptorSet(cache, against, args)
+	if err != nil {
+		return err
+	}
+
+	violations := breaking.Check(baseline, current)
+	for _, violation := range violations {
+		fmt.Fprintln(w, violation)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %d against %s", ErrBreakingChanges, len(violations), against)
+	}
+	return nil
+}
+
+// baselineDescriptorSet loads against as a descriptor set file if it exists,
+// or compiles the protos at the git ref against otherwise.
+func baselineDescriptorSet(cache BinCache, against string, args []string) (*descriptorpb.FileDescriptorSet, error) {
+	if info, err := os.Stat(against); err == nil && !info.IsDir() {
+		return loadDescriptorSet(against)
+	}
+	root, dir, err := checkoutGitRef(against)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a descriptor set nor a git ref: %w", against, err)
+	}
+	defer os.RemoveAll(root)
+	baseline, err := compileDescriptorSet(cache, dir, args, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile protos at %s: %w", against, err)
+	}
+	return baseline, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// writeDescriptorSetFixture writes a descriptor set with a single message
+// with the given fields to path.
+func writeDescriptorSetFixture(t *testing.T, path string, fields ...string) {
+	t.Helper()
+	message := &descriptorpb.DescriptorProto{Name: proto.String("Pet")}
+	for i, name := range fields {
+		message.Field = append(message.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(int32(i + 1)),
+			Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		})
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:        proto.String("pet.proto"),
+		Package:     proto.String("petstore"),
+		MessageType: []*descriptorpb.DescriptorProto{message},
+	}}}
+	content, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunBreaking_AgainstDescriptorSet(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockBinary(t, mockprotoc.CopiesDescriptorSet("fixture.binpb"))}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"pet.proto": ""})
+	writeDescriptorSetFixture(t, filepath.Join(dir, "fixture.binpb"), "id", "name")
+	baseline := filepath.Join(t.TempDir(), "baseline.binpb")
+
+	// Adding a field is compatible.
+	writeDescriptorSetFixture(t, baseline, "id")
+	var out bytes.Buffer
+	if err := runBreaking(cache, &out, "--against", baseline); err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, out.String())
+	}
+
+	// Removing one is not.
+	writeDescriptorSetFixture(t, baseline, "id", "name", "age")
+	out.Reset()
+	err := runBreaking(cache, &out, "--against", baseline)
+	if !errors.Is(err, ErrBreakingChanges) {
+		t.Fatalf("Expected ErrBreakingChanges, got: %v", err)
+	}
+	if !strings.Contains(out.String(), `field 3 "age" was deleted from "petstore.Pet"`) {
+		t.Errorf("Expected deleted field to be reported, got:\n%s", out.String())
+	}
+}
+
+func TestRunBreaking_AgainstGitRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	cache := &mockBinCache{binPath: createMockBinary(t, mockprotoc.CopiesDescriptorSet("fixture.binpb"))}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	protoDir := filepath.Join(dir, "api")
+	writeTestFiles(t, protoDir, map[string]string{"pet.proto": ""})
+	writeDescriptorSetFixture(t, filepath.Join(protoDir, "fixture.binpb"), "id", "name")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "baseline")
+
+	// The baseline is read from the same subdirectory at the ref.
+	t.Chdir(protoDir)
+	writeDescriptorSetFixture(t, filepath.Join(protoDir, "fixture.binpb"), "id")
+	var out bytes.Buffer
+	err := runBreaking(cache, &out, "--against", "HEAD")
+	if !errors.Is(err, ErrBreakingChanges) {
+		t.Fatalf("Expected ErrBreakingChanges, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "FIELD_NO_DELETE") {
+		t.Errorf("Expected deleted field to be reported, got:\n%s", out.String())
+	}
+}
+
+func TestRunBreaking_AgainstGitRefIncludes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	// The fixture is read from an include path outside of the working
+	// directory, which must be part of the baseline too.
+	cache := &mockBinCache{binPath: createMockBinary(t, mockprotoc.CopiesDescriptorSet("../shared/fixture.binpb"))}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"api/pet.proto": "", "shared/money.proto": ""})
+	writeDescriptorSetFixture(t, filepath.Join(dir, "shared", "fixture.binpb"), "id", "name")
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"commit", "-q", "-m", "baseline"}} {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	t.Chdir(filepath.Join(dir, "api"))
+	writeDescriptorSetFixture(t, filepath.Join(dir, "shared", "fixture.binpb"), "id")
+	var out bytes.Buffer
+	err := runBreaking(cache, &out, "--against", "HEAD", "pet.proto", "-I", ".", "-I", "../shared")
+	if !errors.Is(err, ErrBreakingChanges) {
+		t.Fatalf("Expected ErrBreakingChanges, got: %v\n%s", err, out.String())
+	}
+}
+
+func TestRunBreaking_MissingAgainst(t *testing.T) {
+	err := runBreaking(&mockBinCache{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "--against") {
+		t.Errorf("Expected error about missing --against, got: %v", err)
+	}
+}
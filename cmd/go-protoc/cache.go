@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+// bundleCache is implemented by caches that can be exported to and imported
+// from a bundle, such as bincache.ProtocBinCache.
+type bundleCache interface {
+	Export(w io.Writer) (*bincache.BundleManifest, error)
+	Import(r io.Reader) ([]bincache.BundleRelease, error)
+}
+
+// verifyingCache is implemented by caches that can check the digest of the
+// cached protoc releases, such as bincache.ProtocBinCache.
+type verifyingCache interface {
+	CachedVersions() ([]string, error)
+	Verify(version string) error
+}
+
+// runCache implements `go-protoc cache export <file>` and `go-protoc cache
+// import <file>`, which move the cached protoc releases between machines as a
+// gzip-compressed tar bundle, and `go-protoc cache verify`, which checks the
+// digest of every cached release.
+func runCache(cache BinCache, w io.Writer, args ...string) error {
+	if len(args) == 1 && args[0] == "verify" {
+		vc, ok := cache.(verifyingCache)
+		if !ok {
+			return fmt.Errorf("cache does not support verification")
+		}
+		return verifyCache(vc, w)
+	}
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		return fmt.Errorf("usage: go-protoc cache export|import <file> or go-protoc cache verify")
+	}
+	bc, ok := cache.(bundleCache)
+	if !ok {
+		return fmt.Errorf("cache does not support bundles")
+	}
+	if args[0] == "export" {
+		return exportCache(bc, w, args[1])
+	}
+	return importCache(bc, w, args[1])
+}
+
+func exportCache(cache bundleCache, w io.Writer, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	manifest, err := cache.Export(file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write bundle: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	for _, release := range manifest.Releases {
+		fmt.Fprintf(w, "exported protoc %s for %s/%s\n", release.Version, release.GOOS, release.GOARCH)
+	}
+	return nil
+}
+
+func importCache(cache bundleCache, w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+	imported, err := cache.Import(file)
+	for _, release := range imported {
+		fmt.Fprintf(w, "imported protoc %s for %s/%s\n", release.Version, release.GOOS, release.GOARCH)
+	}
+	return err
+}
+
+func verifyCache(cache verifyingCache, w io.Writer) error {
+	versions, err := cache.CachedVersions()
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, version := range versions {
+		if err := cache.Verify(version); err != nil {
+			fmt.Fprintf(w, "protoc %s is invalid: %v\n", version, err)
+			failed = append(failed, version)
+			continue
+		}
+		fmt.Fprintf(w, "verified protoc %s\n", version)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("invalid cached protoc releases: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCache(t *testing.T) {
+	source, _ := newTestProtocBinCache(t)
+	if err := runInstall(source, &bytes.Buffer{}, "--version", "v32.1", "--platform", "linux/arm64"); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(t.TempDir(), "protoc.tar.gz")
+
+	var out bytes.Buffer
+	if err := runCache(source, &out, "export", bundle); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != "exported protoc 32.1 for linux/arm64\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	target, downloader := newTestProtocBinCache(t)
+	out.Reset()
+	if err := runCache(target, &out, "import", bundle); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != "imported protoc 32.1 for linux/arm64\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+	// The imported release is used without downloading it.
+	if err := runInstall(target, &bytes.Buffer{}, "--version", "v32.1", "--platform", "linux/arm64"); err != nil {
+		t.Fatal(err)
+	}
+	if len(downloader.urls) != 0 {
+		t.Errorf("Expected no download, got %v", downloader.urls)
+	}
+}
+
+func TestRunCache_Verify(t *testing.T) {
+	cache, _ := newTestProtocBinCache(t)
+	for _, tag := range []string{"v31.0", "v32.1"} {
+		if _, err := cache.BinPath(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runCache(cache, &out, "verify"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != "verified protoc 31.0\nverified protoc 32.1\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	if err := os.WriteFile(cache.VersionBinPath("31.0"), []byte("corrupted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	err := runCache(cache, &out, "verify")
+	if err == nil || err.Error() != "invalid cached protoc releases: 31.0" {
+		t.Errorf("Expected the corrupt release to be reported, got: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "protoc 31.0 is invalid: ") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+func TestRunCache_Errors(t *testing.T) {
+	cache, _ := newTestProtocBinCache(t)
+	corrupted := filepath.Join(t.TempDir(), "corrupted.tar.gz")
+	if err := os.WriteFile(corrupted, []byte("not a bundle"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		cache    BinCache
+		args     []string
+		expected string
+	}{
+		"missing file":       {cache: cache, args: []string{"export"}, expected: "usage"},
+		"unknown command":    {cache: cache, args: []string{"clear", "file"}, expected: "usage"},
+		"unsupported cache":  {cache: &mockBinCache{}, args: []string{"export", "file"}, expected: "does not support bundles"},
+		"unsupported verify": {cache: &mockBinCache{}, args: []string{"verify"}, expected: "does not support verification"},
+		"corrupted bundle":   {cache: cache, args: []string{"import", corrupted}, expected: "failed to read bundle"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := runCache(tc.cache, &bytes.Buffer{}, tc.args...)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
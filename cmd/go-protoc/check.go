@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/esdandreu/go-protoc/pkg/diff"
+)
+
+// ErrOutOfDate is returned in check mode when the generated files differ from
+// the ones on disk.
+var ErrOutOfDate = errors.New("generated files are out of date")
+
+// checkProtoc runs protoc like runProtoc in dir, but writes every output into
+// a temporary directory instead. Generated files are then compared with the
+// ones in dir and a unified diff is written to w for each difference, in
+// which case ErrOutOfDate is returned. The generated files listed under key
+// in the manifest that are no longer produced, which cleanProtoc would
+// remove, are reported as differences too.
+func checkProtoc(cache BinCache, tag, dir, key string, w io.Writer, args ...string) error {
+	outputDir, err := os.MkdirTemp("", "go-protoc-check-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(outputDir)
+	opts := protocOptions(cache, tag, dir, args)
+	opts.OutputDir = outputDir
+	result, err := runProtocWith(opts)
+	if err != nil {
+		return err
+	}
+
+	outOfDate := false
+	for _, name := range result.Files {
+		path := filepath.FromSlash(name)
+		generated, err := os.ReadFile(filepath.Join(outputDir, path))
+		if err != nil {
+			return fmt.Errorf("failed to read generated file: %w", err)
+		}
+		oldName := "a/" + name
+		current, err := os.ReadFile(filepath.Join(dir, path))
+		if errors.Is(err, fs.ErrNotExist) {
+			oldName = "/dev/null"
+		} else if err != nil {
+			return fmt.Errorf("failed to read checked-in file: %w", err)
+		}
+		if d := diff.Unified(oldName, "b/"+name, current, generated); d != nil {
+			outOfDate = true
+			if _, err := w.Write(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	manifest, err := readManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return err
+	}
+	for _, name := range manifest[key] {
+		if _, ok := slices.BinarySearch(result.Files, name); ok {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if generated, err := isGeneratedFile(path); err != nil || !generated {
+			continue
+		}
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read checked-in file: %w", err)
+		}
+		outOfDate = true
+		if _, err := w.Write(diff.Unified("a/"+name, "/dev/null", current, nil)); err != nil {
+			return err
+		}
+	}
+	if outOfDate {
+		return ErrOutOfDate
+	}
+	return nil
+}
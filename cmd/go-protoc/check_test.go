@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+)
+
+// writesGoFile makes a mock protoc write content into x.pb.go inside the
+// directory given by --go_out.
+func writesGoFile(content string) mockprotoc.Option {
+	return mockprotoc.OnArg("--go_out=*", "printf '"+content+"' > \"${arg#--go_out=}/x.pb.go\"")
+}
+
+func TestCheckProtoc_UpToDate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "x.pb.go"), []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := &mockBinCache{binPath: createMockBinary(t, writesGoFile(`package x\n`))}
+
+	var out bytes.Buffer
+	err := checkProtoc(cache, protocTag(cache), dir, "", &out, "--go_out=.", "x.proto")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no diff, got:\n%s", out.String())
+	}
+}
+
+func TestCheckProtoc_OutOfDate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "x.pb.go"), []byte("package old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := &mockBinCache{binPath: createMockBinary(t, writesGoFile(`package x\n`))}
+
+	var out bytes.Buffer
+	err := checkProtoc(cache, protocTag(cache), dir, "", &out, "--go_out=.", "x.proto")
+	if !errors.Is(err, ErrOutOfDate) {
+		t.Fatalf("Expected ErrOutOfDate, got: %v", err)
+	}
+	expected := "--- a/x.pb.go\n+++ b/x.pb.go\n@@ -1 +1 @@\n-package old\n+package x\n"
+	if out.String() != expected {
+		t.Errorf("Expected diff\n%s\ngot\n%s", expected, out.String())
+	}
+	// The checked-in file is left untouched.
+	content, err := os.ReadFile(filepath.Join(dir, "x.pb.go"))
+	if err != nil || string(content) != "package old\n" {
+		t.Errorf("Expected checked-in file to be unchanged, got %q (%v)", content, err)
+	}
+}
+
+func TestCheckProtoc_MissingFile(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockBinary(t, writesGoFile(`package x\n`))}
+
+	var out bytes.Buffer
+	err := checkProtoc(cache, protocTag(cache), t.TempDir(), "", &out, "--go_out=.", "x.proto")
+	if !errors.Is(err, ErrOutOfDate) {
+		t.Fatalf("Expected ErrOutOfDate, got: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "--- /dev/null\n+++ b/x.pb.go\n") {
+		t.Errorf("Expected diff against /dev/null, got:\n%s", out.String())
+	}
+}
+
+func TestCheckProtoc_StaleFile(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"--go_out=.", "x.proto"}
+	key := manifestKey(args)
+	writeTestFiles(t, dir, map[string]string{
+		ManifestFileName: "[" + key + "]\nx.pb.go\nold.pb.go\nhand.pb.go\ngone.pb.go\n",
+		"x.pb.go":        "package x\n",
+		"old.pb.go":      generatedContent,
+		"hand.pb.go":     "package x\n",
+	})
+	cache := &mockBinCache{binPath: createMockBinary(t, writesGoFile(`package x\n`))}
+
+	var out bytes.Buffer
+	err := checkProtoc(cache, protocTag(cache), dir, key, &out, args...)
+	if !errors.Is(err, ErrOutOfDate) {
+		t.Fatalf("Expected ErrOutOfDate, got: %v", err)
+	}
+	// Only the generated files --clean would remove are reported.
+	if !strings.HasPrefix(out.String(), "--- a/old.pb.go\n+++ /dev/null\n") || strings.Contains(out.String(), "hand.pb.go") {
+		t.Errorf("Expected a diff removing old.pb.go only, got:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.pb.go")); err != nil {
+		t.Errorf("Expected the stale file to be left untouched, got: %v", err)
+	}
+}
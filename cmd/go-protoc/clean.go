@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ManifestFileName is the file, relative to the working directory, recording
+// the outputs produced by the last run with stale file cleanup enabled. The
+// outputs are recorded per run arguments, see manifestKey.
+const ManifestFileName = ".go-protoc-manifest"
+
+// generatedHeader matches the header written by protoc-gen-go,
+// protoc-gen-go-grpc and any other plugin following the same convention.
+var generatedHeader = regexp.MustCompile(`^// Code generated by protoc-gen-\S+\. DO NOT EDIT\.$`)
+
+// cleanProtoc runs protoc like runProtoc in dir, but records every produced
+// output in the manifest under key and removes the generated files listed
+// under key by the previous manifest that were not produced this time.
+// Removals are reported to w. With dryRun set, stale files are only reported
+// and the manifest is not updated.
+func cleanProtoc(cache BinCache, tag, dir, key string, dryRun bool, w io.Writer, args ...string) error {
+	result, err := runProtocWith(protocOptions(cache, tag, dir, args))
+	if err != nil {
+		return err
+	}
+	produced := result.Files
+
+	manifestPath := filepath.Join(dir, ManifestFileName)
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range manifest[key] {
+		if _, ok := slices.BinarySearch(produced, name); ok {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		generated, err := isGeneratedFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to inspect %s: %w", name, err)
+		}
+		if !generated {
+			fmt.Fprintf(w, "keeping %s: not a generated file\n", name)
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(w, "would remove %s\n", name)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale file: %w", err)
+		}
+		fmt.Fprintf(w, "removed %s\n", name)
+	}
+
+	if dryRun {
+		return nil
+	}
+	manifest[key] = produced
+	return writeManifest(manifestPath, manifest)
+}
+
+// manifestKey returns the key the outputs of a run with args, as given to
+// go-protoc, are recorded under in the manifest. Runs with different
+// arguments in the same directory, such as two go:generate directives, each
+// remove only their own stale outputs.
+func manifestKey(args []string) string {
+	digest := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(digest[:8])
+}
+
+// isGeneratedFile reports whether the file starts with a protoc plugin
+// "Code generated ... DO NOT EDIT." header. Only the leading comment lines are
+// inspected.
+func isGeneratedFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if generatedHeader.MatchString(line) {
+			return true, nil
+		}
+		if line != "" && !strings.HasPrefix(line, "//") {
+			return false, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// readManifest returns the outputs listed in the manifest by key, or an empty
+// manifest if there is none yet. Each key starts a section as a "[key]"
+// line, and outputs listed before any section are ignored.
+func readManifest(path string) (map[string][]string, error) {
+	manifest := map[string][]string{}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	key := ""
+	for line := range strings.Lines(string(content)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if section, ok := strings.CutPrefix(line, "["); ok && strings.HasSuffix(section, "]") {
+			key = strings.TrimSuffix(section, "]")
+			continue
+		}
+		if key != "" {
+			manifest[key] = append(manifest[key], line)
+		}
+	}
+	return manifest, nil
+}
+
+func writeManifest(path string, manifest map[string][]string) error {
+	var content strings.Builder
+	content.WriteString("# Generated by go-protoc. DO NOT EDIT.\n")
+	for _, key := range slices.Sorted(maps.Keys(manifest)) {
+		if len(manifest[key]) == 0 {
+			continue
+		}
+		content.WriteString("[" + key + "]\n")
+		for _, name := range manifest[key] {
+			content.WriteString(name + "\n")
+		}
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
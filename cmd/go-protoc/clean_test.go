@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+)
+
+const generatedContent = "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage x\n"
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCleanProtoc(t *testing.T) {
+	binPath := createMockBinary(t, writesGoFile(`// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage x\n`))
+	dir := t.TempDir()
+	t.Chdir(dir)
+	args := []string{"--go_out=.", "x.proto"}
+	key := manifestKey(args)
+	writeTestFiles(t, dir, map[string]string{
+		ManifestFileName: "[" + key + "]\nx.pb.go\nold.pb.go\nhand.pb.go\ngone.pb.go\n",
+		"old.pb.go":      generatedContent,
+		"hand.pb.go":     "package x\n",
+	})
+
+	var out bytes.Buffer
+	cache := &mockBinCache{binPath: binPath}
+	if err := cleanProtoc(cache, protocTag(cache), dir, key, false, &out, args...); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expectedOut := "removed old.pb.go\nkeeping hand.pb.go: not a generated file\n"
+	if out.String() != expectedOut {
+		t.Errorf("Expected output %q, got %q", expectedOut, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.pb.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected stale generated file to be removed, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hand.pb.go")); err != nil {
+		t.Errorf("Expected hand-written file to be kept, got: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "x.pb.go"))
+	if err != nil || string(content) != generatedContent {
+		t.Errorf("Expected generated file to be written, got %q (%v)", content, err)
+	}
+	manifest, err := readManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest, map[string][]string{key: {"x.pb.go"}}) {
+		t.Errorf("Expected manifest to list x.pb.go only, got %v", manifest)
+	}
+}
+
+func TestCleanProtoc_DryRun(t *testing.T) {
+	binPath := createMockBinary(t, writesGoFile(`package x\n`))
+	dir := t.TempDir()
+	t.Chdir(dir)
+	args := []string{"--go_out=.", "x.proto"}
+	key := manifestKey(args)
+	writeTestFiles(t, dir, map[string]string{
+		ManifestFileName: "[" + key + "]\nold.pb.go\n",
+		"old.pb.go":      generatedContent,
+	})
+
+	var out bytes.Buffer
+	cache := &mockBinCache{binPath: binPath}
+	if err := cleanProtoc(cache, protocTag(cache), dir, key, true, &out, args...); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if out.String() != "would remove old.pb.go\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.pb.go")); err != nil {
+		t.Errorf("Expected stale file to be kept in dry-run mode, got: %v", err)
+	}
+	manifest, err := readManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(manifest, map[string][]string{key: {"old.pb.go"}}) {
+		t.Errorf("Expected manifest to be unchanged in dry-run mode, got %v", manifest)
+	}
+}
+
+func TestCleanProtoc_Directives(t *testing.T) {
+	// The mock writes a generated file named after each input.
+	binPath := createMockBinary(t,
+		mockprotoc.OnArg("--go_out=*", `out="${arg#--go_out=}"`),
+		mockprotoc.OnArg("*.proto", `printf '`+strings.ReplaceAll(generatedContent, "\n", `\n`)+`' > "$out/${arg%.proto}.pb.go"`),
+	)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	cache := &mockBinCache{binPath: binPath}
+	directives := [][]string{
+		{"--go_out=.", "a.proto"},
+		{"--go_out=.", "b.proto"},
+	}
+
+	// Running the directives again leaves the outputs of the other one.
+	for range 2 {
+		for _, args := range directives {
+			var out bytes.Buffer
+			if err := cleanProtoc(cache, protocTag(cache), dir, manifestKey(args), false, &out, args...); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("Expected no removals for %v, got %q", args, out.String())
+			}
+		}
+	}
+	for _, name := range []string{"a.pb.go", "b.pb.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept, got: %v", name, err)
+		}
+	}
+	manifest, err := readManifest(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		manifestKey(directives[0]): {"a.pb.go"},
+		manifestKey(directives[1]): {"b.pb.go"},
+	}
+	if !reflect.DeepEqual(manifest, expected) {
+		t.Errorf("Expected manifest %v, got %v", expected, manifest)
+	}
+}
+
+func TestIsGeneratedFile(t *testing.T) {
+	dir := t.TempDir()
+	testCases := map[string]struct {
+		content  string
+		expected bool
+	}{
+		"protoc-gen-go":      {generatedContent, true},
+		"protoc-gen-go-grpc": {"// Code generated by protoc-gen-go-grpc. DO NOT EDIT.\n", true},
+		"after comments":     {"// Copyright\n\n// Code generated by protoc-gen-go. DO NOT EDIT.\n", true},
+		"other generator":    {"// Code generated by stringer. DO NOT EDIT.\n", false},
+		"after package":      {"package x\n// Code generated by protoc-gen-go. DO NOT EDIT.\n", false},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".go")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			generated, err := isGeneratedFile(path)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if generated != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, generated)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/esdandreu/go-protoc/pkg/deps"
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+	"github.com/esdandreu/go-protoc/pkg/modproto"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+)
+
+// dependencyArgs appends to args the include paths of the proto dependencies
+// configured in the go-protoc.json file of dir or its parents, fetching them
+// into the cache if needed.
+func dependencyArgs(cache BinCache, dir string, args []string) ([]string, error) {
+	configPath := deps.FindConfig(dir)
+	if configPath == "" {
+		return args, nil
+	}
+	// The configuration file may only configure other subcommands, such as
+	// lint.
+	config, err := deps.ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Deps) == 0 {
+		return args, nil
+	}
+	cd, ok := cache.(cacheDirer)
+	if !ok {
+		return nil, fmt.Errorf("cache does not support proto dependencies")
+	}
+	fetcher := deps.NewFetcher(cd.Dir())
+	if archiveDownloader, ok := fetcher.ZipDownloader.(*downloader.ArchiveDownloader); ok {
+		archiveDownloader.Observer = runTimings
+	}
+	includes, err := deps.Resolve(fetcher, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve proto dependencies: %w", err)
+	}
+	logger.Debug("proto dependencies", "config", configPath, "includes", includes)
+	return appendIncludes(args, includes), nil
+}
+
+// goModuleArgs appends to args the include roots making the proto files of
+// the Go module dependencies importable by their module path, for the
+// imports of the input files that are not found in the include paths. Inputs
+// default to the proto files in dir, like protoc.Run does.
+func goModuleArgs(cache BinCache, dir string, args []string) ([]string, error) {
+	cd, ok := cache.(cacheDirer)
+	if !ok || findGoMod(dir) == "" {
+		return args, nil
+	}
+	includes := protoc.IncludePaths(args)
+	if len(includes) == 0 {
+		includes = []string{"."}
+	}
+	inputs, err := protoInputs(dir, args)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := modproto.NewResolver(dir, includes, cd.Dir()).Resolve(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve imports from Go modules: %w", err)
+	}
+	logger.Debug("proto include roots from Go modules", "roots", roots)
+	return appendIncludes(args, roots), nil
+}
+
+// protoInputs returns the proto files given in args or, when there are none,
+// the proto files in dir, like protoc.Run does.
+func protoInputs(dir string, args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if protoc.IsInput(arg) {
+			inputs = append(inputs, arg)
+		}
+	}
+	if len(inputs) == 0 {
+		return protoc.FindProtoFiles(os.DirFS(dir))
+	}
+	return inputs, nil
+}
+
+// appendIncludes appends include paths to args. The current directory is
+// included first unless args already have include paths, as protoc only
+// includes it by default when none is given. They are appended last, so that
+// the flag parser does not take the argument following them as their value.
+func appendIncludes(args []string, includes []string) []string {
+	if len(includes) == 0 {
+		return args
+	}
+	args = slices.Clone(args)
+	if len(protoc.IncludePaths(args)) == 0 {
+		args = append(args, "-I.")
+	}
+	for _, include := range includes {
+		args = append(args, "-I"+include)
+	}
+	return args
+}
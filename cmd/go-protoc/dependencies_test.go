@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/pkg/deps"
+)
+
+type mockDepsDownloader struct{}
+
+func (mockDepsDownloader) DownloadAndExtract(url string, destDir string) error {
+	path := filepath.Join(destDir, "googleapis-main", "google", "api", "annotations.proto")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte("syntax = \"proto3\";\n"), 0644)
+}
+
+func TestDependencyArgs(t *testing.T) {
+	cache, _ := newTestProtocBinCache(t)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":            "module example.com/pets\n",
+		deps.ConfigFileName: `{"deps": [{"name": "googleapis", "module": "github.com/googleapis/googleapis@main"}]}`,
+	})
+	// Fetch the dependency into the cache ahead of time, as it would be
+	// downloaded otherwise.
+	fetcher := deps.NewFetcher(cache.Dir())
+	fetcher.ZipDownloader = mockDepsDownloader{}
+	config, err := deps.ReadConfig(filepath.Join(dir, deps.ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	includeDir, _, err := fetcher.Fetch(config.Deps[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		args     []string
+		expected []string
+	}{
+		"no include path": {
+			args:     []string{"pet.proto"},
+			expected: []string{"pet.proto", "-I.", "-I" + includeDir},
+		},
+		"include path": {
+			args:     []string{"-Iproto", "pet.proto"},
+			expected: []string{"-Iproto", "pet.proto", "-I" + includeDir},
+		},
+		"proto path": {
+			args:     []string{"--proto_path", "proto"},
+			expected: []string{"--proto_path", "proto", "-I" + includeDir},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			args, err := dependencyArgs(cache, dir, tc.args)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, args)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, deps.LockFileName)); err != nil {
+		t.Errorf("Expected lockfile, got: %v", err)
+	}
+}
+
+func TestDependencyArgs_NoConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"go.mod": "module example.com/pets\n"})
+	args, err := dependencyArgs(&mockBinCache{}, dir, []string{"pet.proto"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(args, []string{"pet.proto"}) {
+		t.Errorf("Expected args unchanged, got %v", args)
+	}
+}
+
+func TestGoModuleArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+	cache, _ := newTestProtocBinCache(t)
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/pets\n\ngo 1.24\n\n" +
+			"require example.com/dep v0.0.0\n\n" +
+			"replace example.com/dep => ./dep\n",
+		"pet.proto":           `import "example.com/dep/api/thing.proto";`,
+		"dep/go.mod":          "module example.com/dep\n",
+		"dep/api/thing.proto": "",
+	})
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+
+	args, err := goModuleArgs(cache, dir, []string{"pet.proto"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(args) != 3 || args[1] != "-I." || !strings.HasPrefix(args[2], "-I") {
+		t.Fatalf("Expected the current directory and a module include root, got %v", args)
+	}
+	root := strings.TrimPrefix(args[2], "-I")
+	if _, err := os.Stat(filepath.Join(root, "example.com", "dep", "api", "thing.proto")); err != nil {
+		t.Errorf("Expected the dependency to be importable, got: %v", err)
+	}
+}
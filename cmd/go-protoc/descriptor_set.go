@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// DefaultDescriptorSetPath is where the FileDescriptorSet is written when
+// embedding is requested without an explicit path.
+const DefaultDescriptorSetPath = "descriptor.binpb"
+
+// DescriptorSetEmbedVar is the name of the variable holding the embedded
+// FileDescriptorSet.
+const DescriptorSetEmbedVar = "FileDescriptorSet"
+
+var descriptorSetEmbedTemplate = template.Must(template.New("embed").Parse(
+	`// Code generated by go-protoc. DO NOT EDIT.
+
+package {{.Package}}
+
+import _ "embed"
+
+// {{.Var}} holds the serialized google.protobuf.FileDescriptorSet of the
+// generated protos, including their imports and source info.
+//
+//go:embed {{.File}}
+var {{.Var}} []byte
+`))
+
+// descriptorSetArgs returns args with the flags to write a FileDescriptorSet,
+// including imports and source info, to path. Flags already present are not
+// repeated.
+func descriptorSetArgs(args []string, path string) []string {
+	flags, _ := ParseArgs(args)
+	args = slices.Clone(args)
+	if _, ok := descriptorSetOut(args); !ok {
+		args = append(args, "--descriptor_set_out="+path)
+	}
+	if !slices.Contains(flags, "include_imports") {
+		args = append(args, "--include_imports")
+	}
+	if !slices.Contains(flags, "include_source_info") {
+		args = append(args, "--include_source_info")
+	}
+	return args
+}
+
+// descriptorSetOut returns the path protoc writes the FileDescriptorSet to,
+// given with --descriptor_set_out or its -o shorthand. The last one wins, like
+// in protoc.
+func descriptorSetOut(args []string) (string, bool) {
+	var path string
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return path, found
+		case arg == "--descriptor_set_out" || arg == "-o":
+			if i+1 < len(args) {
+				i++
+				path, found = args[i], true
+			}
+		case strings.HasPrefix(arg, "--descriptor_set_out="):
+			path, found = strings.TrimPrefix(arg, "--descriptor_set_out="), true
+		case strings.HasPrefix(arg, "-o"):
+			path, found = strings.TrimPrefix(arg, "-o"), true
+		}
+	}
+	return path, found
+}
+
+// writeDescriptorSetEmbed writes a Go file next to the descriptor set at path
+// that embeds it with //go:embed. The package name is goPackage when the
+// descriptor set is in the working directory, typically $GOPACKAGE as set by
+// go generate, and the name of its directory otherwise.
+func writeDescriptorSetEmbed(path, goPackage string) error {
+	dir, file := filepath.Split(path)
+	if dir = filepath.Clean(dir); dir != "." || goPackage == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve descriptor set directory: %w", err)
+		}
+		goPackage = packageNameFromDir(abs)
+	}
+	if !token.IsIdentifier(goPackage) {
+		return fmt.Errorf("cannot derive a Go package name for %s", path)
+	}
+
+	var content bytes.Buffer
+	err := descriptorSetEmbedTemplate.Execute(&content, map[string]string{
+		"Package": goPackage,
+		"Var":     DescriptorSetEmbedVar,
+		"File":    file,
+	})
+	if err != nil {
+		return err
+	}
+	embedPath := strings.TrimSuffix(path, filepath.Ext(path)) + "_embed.go"
+	if err := os.WriteFile(embedPath, content.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write descriptor set embed file: %w", err)
+	}
+	return nil
+}
+
+// packageNameFromDir derives a Go package name from the last element of dir,
+// dropping characters that are not valid in an identifier.
+func packageNameFromDir(dir string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.ToLower(filepath.Base(dir)))
+	return strings.TrimLeft(name, "0123456789")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDescriptorSetArgs(t *testing.T) {
+	args := descriptorSetArgs([]string{"x.proto"}, "out.binpb")
+	expected := []string{"x.proto", "--descriptor_set_out=out.binpb", "--include_imports", "--include_source_info"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	// Flags given explicitly are kept as they are, also in shorthand.
+	args = descriptorSetArgs([]string{"-omine.binpb", "--include_imports"}, "out.binpb")
+	expected = []string{"-omine.binpb", "--include_imports", "--include_source_info"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	args = descriptorSetArgs([]string{"--descriptor_set_out=mine.binpb", "--include_imports"}, "out.binpb")
+	expected = []string{"--descriptor_set_out=mine.binpb", "--include_imports", "--include_source_info"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestDescriptorSetOut(t *testing.T) {
+	testCases := map[string]struct {
+		args     []string
+		expected string
+		found    bool
+	}{
+		"none":       {args: []string{"x.proto", "--go_out=."}},
+		"long":       {args: []string{"--descriptor_set_out=set.binpb"}, expected: "set.binpb", found: true},
+		"long value": {args: []string{"--descriptor_set_out", "set.binpb"}, expected: "set.binpb", found: true},
+		"short":      {args: []string{"-oset.binpb"}, expected: "set.binpb", found: true},
+		"short value": {
+			args:     []string{"-o", "api/set.binpb", "x.proto"},
+			expected: "api/set.binpb",
+			found:    true,
+		},
+		"last wins": {
+			args:     []string{"-oset.binpb", "--descriptor_set_out=other.binpb"},
+			expected: "other.binpb",
+			found:    true,
+		},
+		"after terminator": {args: []string{"--", "-oset.binpb"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path, found := descriptorSetOut(tc.args)
+			if path != tc.expected || found != tc.found {
+				t.Errorf("Expected %q, %v, got %q, %v", tc.expected, tc.found, path, found)
+			}
+		})
+	}
+}
+
+func TestRun_DescriptorSetEmbedExplicitPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\n"})
+	os.Mkdir(filepath.Join(dir, "api"), 0755)
+	t.Chdir(dir)
+	t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+	t.Setenv("GOPACKAGE", "petstore")
+	cache := &mockBinCache{binPath: createMockBinary(t)}
+
+	args := []string{"pet.proto", "--descriptor-set-embed", "-o", "api/set.binpb"}
+	if err := run(cache, os.DirFS(dir), args); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "api", "set_embed.go"))
+	if err != nil {
+		t.Fatalf("Expected the embed file next to the explicit descriptor set, got: %v", err)
+	}
+	if !strings.Contains(string(content), "//go:embed set.binpb\n") {
+		t.Errorf("Expected the explicit descriptor set to be embedded, got:\n%s", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "descriptor_embed.go")); err == nil {
+		t.Errorf("Expected no embed file for the default descriptor set")
+	}
+}
+
+func TestWriteDescriptorSetEmbed(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	testCases := map[string]struct {
+		path      string
+		goPackage string
+		embedPath string
+		pkg       string
+	}{
+		"working directory": {
+			path:      "descriptor.binpb",
+			goPackage: "petstore",
+			embedPath: "descriptor_embed.go",
+			pkg:       "petstore",
+		},
+		"subdirectory": {
+			path:      filepath.Join("api-v1", "set.binpb"),
+			goPackage: "petstore",
+			embedPath: filepath.Join("api-v1", "set_embed.go"),
+			pkg:       "apiv1",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := os.MkdirAll(filepath.Dir(tc.path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeDescriptorSetEmbed(tc.path, tc.goPackage); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), tc.embedPath, nil, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("Expected valid Go file, got: %v", err)
+			}
+			if file.Name.Name != tc.pkg {
+				t.Errorf("Expected package %q, got %q", tc.pkg, file.Name.Name)
+			}
+			content, _ := os.ReadFile(tc.embedPath)
+			directive := "//go:embed " + filepath.Base(tc.path) + "\nvar " + DescriptorSetEmbedVar + " []byte\n"
+			if !strings.Contains(string(content), directive) {
+				t.Errorf("Expected embed directive %q in:\n%s", directive, content)
+			}
+		})
+	}
+}
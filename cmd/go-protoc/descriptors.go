@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// compileDescriptorSet compiles the proto files in dir into a
+// FileDescriptorSet with source info, and with their imports if imports is
+// set, without running any plugin. Like runProtoc, the arguments are
+// completed with resolveArgs and the proto files are discovered in dir
+// unless args name some.
+func compileDescriptorSet(cache BinCache, dir string, args []string, imports bool) (*descriptorpb.FileDescriptorSet, error) {
+	args, tag, err := resolveArgs(cache, dir, options{}, args)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []string
+	if _, hasNonFlagArgs := ParseArgs(args); !hasNonFlagArgs {
+		if inputs, err = protoc.FindProtoFiles(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+		if len(inputs) == 0 {
+			return nil, fmt.Errorf("no proto files found in %s", dir)
+		}
+	}
+
+	out, err := os.CreateTemp("", "go-protoc-*.binpb")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	flags := []string{"--descriptor_set_out=" + out.Name(), "--include_source_info"}
+	if imports {
+		flags = append(flags, "--include_imports")
+	}
+
+	opts := protocOptions(cache, tag, dir, append(flags, args...))
+	opts.Inputs = inputs
+	opts.Plugins = []protoc.Plugin{}
+	if _, err := runProtocWith(opts); err != nil {
+		return nil, err
+	}
+	return loadDescriptorSet(out.Name())
+}
+
+// loadDescriptorSet reads a serialized FileDescriptorSet, as written by
+// protoc's --descriptor_set_out.
+func loadDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// checkoutGitRef extracts the repository of the working directory as of the
+// git ref into a new temporary directory, which the caller must remove. It
+// returns that directory and the one matching the working directory in it,
+// so that include paths outside of the working directory resolve as they do
+// in the repository.
+func checkoutGitRef(ref string) (root, dir string, err error) {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel", "--show-prefix").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to locate git repository: %w", gitError(err))
+	}
+	toplevel, prefix, _ := strings.Cut(strings.TrimRight(string(out), "\n"), "\n")
+
+	archive, err := os.CreateTemp("", "go-protoc-git-*.tar")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	archive.Close()
+	defer os.Remove(archive.Name())
+	cmd := exec.Command("git", "archive", "--format=tar", "--output="+archive.Name(), ref)
+	cmd.Dir = toplevel
+	if _, err := cmd.Output(); err != nil {
+		return "", "", fmt.Errorf("failed to read %s from git: %w", ref, gitError(err))
+	}
+
+	root, err = os.MkdirTemp("", "go-protoc-git-*")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	// Symbolic links are left out, as they may point outside of the tree.
+	limits := downloader.DefaultLimits
+	limits.SkipSymlinks = true
+	if err := downloader.Extract(archive.Name(), "tree.tar", "", root, limits); err != nil {
+		os.RemoveAll(root)
+		return "", "", fmt.Errorf("failed to extract %s: %w", ref, err)
+	}
+	return root, filepath.Join(root, filepath.FromSlash(strings.TrimSpace(prefix))), nil
+}
+
+// gitError adds git's standard error output to the error of a failed git
+// command.
+func gitError(err error) error {
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && len(exitError.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitError.Stderr)))
+	}
+	return err
+}
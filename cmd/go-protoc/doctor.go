@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// ErrDoctorFailed is returned by doctor when any check fails.
+var ErrDoctorFailed = errors.New("some checks failed")
+
+const (
+	// ReleasesURL is where protoc releases are downloaded from.
+	ReleasesURL = "https://github.com/protocolbuffers/protobuf/releases"
+	// RateLimitURL reports the GitHub API rate limit, which resolving the
+	// latest protoc release counts against.
+	RateLimitURL = "https://api.github.com/rate_limit"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+// checkResult is the outcome of a doctor check. Hint tells how to fix a
+// warning or failure.
+type checkResult struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+	Hint    string      `json:"hint,omitempty"`
+}
+
+// cacheDirer is implemented by caches stored in a directory, such as
+// bincache.ProtocBinCache.
+type cacheDirer interface {
+	Dir() string
+}
+
+// pluginRequirement describes how a plugin relates to the runtime module the
+// code it generates depends on.
+type pluginRequirement struct {
+	Name string
+	// Package is the import path to install the plugin from, and Module the
+	// module providing it.
+	Package string
+	Module  string
+	// Runtime is the module the generated code imports.
+	Runtime string
+	// MinRuntime maps a plugin major.minor version to the minimum runtime
+	// version its generated code requires. When the plugin is part of the
+	// runtime module, the runtime must be at least as new as the plugin.
+	MinRuntime map[string]string
+}
+
+var pluginRequirements = []pluginRequirement{
+	{
+		Name:    "protoc-gen-go",
+		Package: "google.golang.org/protobuf/cmd/protoc-gen-go",
+		Module:  "google.golang.org/protobuf",
+		Runtime: "google.golang.org/protobuf",
+	},
+	{
+		Name:    "protoc-gen-go-grpc",
+		Package: "google.golang.org/grpc/cmd/protoc-gen-go-grpc",
+		Module:  "google.golang.org/grpc/cmd/protoc-gen-go-grpc",
+		Runtime: "google.golang.org/grpc",
+		MinRuntime: map[string]string{
+			"v1.4": "v1.62.0",
+			"v1.5": "v1.64.0",
+		},
+	},
+}
+
+// doctor diagnoses the environment go-protoc generates code in.
+type doctor struct {
+	cache  BinCache
+	tag    string
+	client *http.Client
+	// releasesURL and rateLimitURL are the endpoints checked for network
+	// reachability and rate limiting.
+	releasesURL  string
+	rateLimitURL string
+	// goMod is the path of the go.mod file plugin versions are compared
+	// against, empty when there is none.
+	goMod string
+}
+
+// runDoctor implements `go-protoc doctor [--json]`, which runs every check and
+// reports whether it passed, with a hint on how to fix it otherwise.
+func runDoctor(cache BinCache, w io.Writer, args ...string) error {
+	args, asJSON := ExtractFlag(args, "json")
+	if len(args) > 0 {
+		return fmt.Errorf("doctor: unexpected arguments %v", args)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	d := &doctor{
+		cache:        cache,
+		tag:          protocTag(cache),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		releasesURL:  ReleasesURL,
+		rateLimitURL: RateLimitURL,
+		goMod:        findGoMod(wd),
+	}
+	results := d.run()
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	} else if err := writeCheckResults(w, results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Status == checkFail {
+			return ErrDoctorFailed
+		}
+	}
+	return nil
+}
+
+// run runs every check in order.
+func (d *doctor) run() []checkResult {
+	results := []checkResult{
+		d.checkNetwork(),
+		d.checkRateLimit(),
+		d.checkCacheWritable(),
+		d.checkProtoc(),
+	}
+	var goMod *modfile.File
+	if d.goMod != "" {
+		content, err := os.ReadFile(d.goMod)
+		if err == nil {
+			goMod, err = modfile.Parse(d.goMod, content, nil)
+		}
+		if err != nil {
+			results = append(results, checkResult{
+				Name:    "go.mod",
+				Status:  checkFail,
+				Message: fmt.Sprintf("failed to read %s: %v", d.goMod, err),
+				Hint:    "fix go.mod, `go mod tidy` reports the problem in detail",
+			})
+		}
+	}
+	for _, plugin := range pluginRequirements {
+		results = append(results, d.checkPlugin(plugin, goMod))
+	}
+	return results
+}
+
+func (d *doctor) checkNetwork() checkResult {
+	result := checkResult{Name: "network"}
+	resp, err := d.client.Head(d.releasesURL)
+	if err != nil {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%s is not reachable: %v", d.releasesURL, err)
+		result.Hint = "check your connection and proxy settings (HTTPS_PROXY); cached protoc releases keep working offline"
+		return result
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%s returned status %d", d.releasesURL, resp.StatusCode)
+		result.Hint = "check your proxy settings (HTTPS_PROXY)"
+		return result
+	}
+	result.Status = checkPass
+	result.Message = d.releasesURL + " is reachable"
+	return result
+}
+
+func (d *doctor) checkRateLimit() checkResult {
+	result := checkResult{Name: "rate limit"}
+	hint := "set PROTOC_RELEASE_TAG to a release such as v32.1, which needs no API request"
+	resp, err := d.client.Get(d.rateLimitURL)
+	if err != nil {
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("failed to get GitHub rate limit: %v", err)
+		result.Hint = hint
+		return result
+	}
+	defer resp.Body.Close()
+	var rateLimit struct {
+		Resources struct {
+			Core struct {
+				Limit     int   `json:"limit"`
+				Remaining int   `json:"remaining"`
+				Reset     int64 `json:"reset"`
+			} `json:"core"`
+		} `json:"resources"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status %d", resp.StatusCode)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&rateLimit)
+	}
+	if err != nil {
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("failed to get GitHub rate limit: %v", err)
+		result.Hint = hint
+		return result
+	}
+
+	core := rateLimit.Resources.Core
+	result.Message = fmt.Sprintf("%d of %d GitHub API requests remaining", core.Remaining, core.Limit)
+	switch {
+	case core.Remaining == 0:
+		reset := time.Unix(core.Reset, 0).Format(time.Kitchen)
+		result.Message = fmt.Sprintf("GitHub API rate limit exceeded until %s", reset)
+		result.Status = checkWarn
+		// Only resolving the latest release uses the API.
+		if d.tag == DefaultProtocTag {
+			result.Status = checkFail
+			result.Message += ", the latest protoc release cannot be resolved"
+			result.Hint = hint
+		}
+	case core.Remaining < 10:
+		result.Status = checkWarn
+		result.Hint = hint
+	default:
+		result.Status = checkPass
+	}
+	return result
+}
+
+func (d *doctor) checkCacheWritable() checkResult {
+	result := checkResult{Name: "cache"}
+	cache, ok := d.cache.(cacheDirer)
+	if !ok {
+		result.Status = checkWarn
+		result.Message = "cache directory unknown"
+		return result
+	}
+	dir := cache.Dir()
+	hint := fmt.Sprintf("fix the permissions of %s or move the user cache directory (XDG_CACHE_HOME on Linux)", dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("failed to create cache directory: %v", err)
+		result.Hint = hint
+		return result
+	}
+	file, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("cache directory is not writable: %v", err)
+		result.Hint = hint
+		return result
+	}
+	file.Close()
+	os.Remove(file.Name())
+	result.Status = checkPass
+	result.Message = dir + " is writable"
+	return result
+}
+
+// checkProtoc verifies that the cached protoc binary for the selected tag, if
+// any, matches the digest recorded when it was installed, runs and reports
+// the expected version.
+func (d *doctor) checkProtoc() checkResult {
+	result := checkResult{Name: "protoc"}
+	cache, ok := d.cache.(versionCache)
+	if !ok {
+		result.Status = checkWarn
+		result.Message = "cache does not support version lookup"
+		return result
+	}
+	version, err := cache.ResolveVersion(d.tag)
+	if err != nil {
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("failed to resolve %s: %v", d.tag, err)
+		result.Hint = "check the network and rate limit checks, or set PROTOC_RELEASE_TAG to a release such as v32.1"
+		return result
+	}
+	binPath := cache.VersionBinPath(version)
+	if _, err := os.Stat(binPath); errors.Is(err, os.ErrNotExist) {
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("protoc %s is not cached yet", version)
+		result.Hint = "it is downloaded the first time go-protoc runs"
+		return result
+	}
+	// Removing the version directory makes go-protoc download it again.
+	hint := fmt.Sprintf("remove %s to download it again", filepath.Dir(filepath.Dir(binPath)))
+	if vc, ok := d.cache.(verifyingCache); ok {
+		if err := vc.Verify(version); err != nil {
+			result.Status = checkFail
+			result.Message = fmt.Sprintf("cached protoc %s is invalid: %v", version, err)
+			result.Hint = hint
+			return result
+		}
+	}
+	// Caches whose binaries are not native programs, such as wasm.Runtime,
+	// check them themselves.
+	var checker bincache.BinaryChecker = bincache.VersionChecker{}
+	if bc, ok := d.cache.(bincache.BinaryChecker); ok {
+		checker = bc
+	}
+	if err := checker.CheckBinary(binPath, version); err != nil {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("cached protoc %s is broken: %v", version, err)
+		result.Hint = hint
+		return result
+	}
+	result.Status = checkPass
+	result.Message = fmt.Sprintf("protoc %s at %s", version, binPath)
+	return result
+}
+
+// checkPlugin verifies that a plugin is in the PATH and that the code it
+// generates works with the runtime version required in goMod, when given.
+func (d *doctor) checkPlugin(plugin pluginRequirement, goMod *modfile.File) checkResult {
+	result := checkResult{Name: plugin.Name}
+	found := pluginVersion(plugin.Name)
+	if found.Path == "" {
+		installVersion := "latest"
+		if v := requiredVersion(goMod, plugin.Module); v != "" {
+			installVersion = v
+		}
+		result.Status = checkFail
+		result.Message = found.Error
+		result.Hint = fmt.Sprintf("go install %s@%s and make sure $(go env GOPATH)/bin is in the PATH", plugin.Package, installVersion)
+		return result
+	}
+	version := found.Version
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("failed to determine the version of %s", found.Path)
+		if found.Error != "" {
+			result.Message += ": " + found.Error
+		}
+		result.Hint = fmt.Sprintf("reinstall it with go install %s@latest", plugin.Package)
+		return result
+	}
+	result.Status = checkPass
+	result.Message = fmt.Sprintf("%s %s at %s", plugin.Name, version, found.Path)
+	if goMod == nil {
+		return result
+	}
+
+	if plugin.Module != plugin.Runtime {
+		if required := requiredVersion(goMod, plugin.Module); required != "" && required != version {
+			result.Status = checkWarn
+			result.Message = fmt.Sprintf("%s %s is installed, go.mod requires %s", plugin.Name, version, required)
+			result.Hint = fmt.Sprintf("go install %s@%s", plugin.Package, required)
+			return result
+		}
+	}
+	runtimeVersion := requiredVersion(goMod, plugin.Runtime)
+	minRuntime := plugin.MinRuntime[semver.MajorMinor(version)]
+	if plugin.Module == plugin.Runtime {
+		minRuntime = version
+	}
+	switch {
+	case runtimeVersion == "":
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("go.mod does not require %s, which the generated code imports", plugin.Runtime)
+		result.Hint = fmt.Sprintf("go get %s", plugin.Runtime)
+		if minRuntime != "" {
+			result.Hint += "@" + minRuntime
+		}
+	case minRuntime != "" && semver.Compare(runtimeVersion, minRuntime) < 0:
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%s %s generates code requiring %s %s, go.mod requires %s", plugin.Name, version, plugin.Runtime, minRuntime, runtimeVersion)
+		result.Hint = fmt.Sprintf("go get %s@%s", plugin.Runtime, minRuntime)
+		if plugin.Module == plugin.Runtime {
+			result.Hint += fmt.Sprintf(" or go install %s@%s", plugin.Package, runtimeVersion)
+		}
+	case plugin.Module == plugin.Runtime && semver.Compare(runtimeVersion, version) > 0:
+		result.Status = checkWarn
+		result.Message = fmt.Sprintf("%s %s is older than %s %s in go.mod", plugin.Name, version, plugin.Runtime, runtimeVersion)
+		result.Hint = fmt.Sprintf("go install %s@%s", plugin.Package, runtimeVersion)
+	}
+	return result
+}
+
+// requiredVersion returns the version of module required by goMod, or an
+// empty string if it is not required.
+func requiredVersion(goMod *modfile.File, module string) string {
+	if goMod == nil {
+		return ""
+	}
+	for _, require := range goMod.Require {
+		if require.Mod.Path == module {
+			return require.Mod.Version
+		}
+	}
+	return ""
+}
+
+// findGoMod returns the path of the go.mod file of the module containing dir,
+// or an empty string if there is none.
+func findGoMod(dir string) string {
+	for {
+		path := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// writeCheckResults prints a line per check, followed by its hint if any.
+func writeCheckResults(w io.Writer, results []checkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(string(result.Status)), result.Name, result.Message)
+		if result.Hint != "" {
+			fmt.Fprintf(tw, "\t\thint: %s\n", result.Hint)
+		}
+	}
+	return tw.Flush()
+}
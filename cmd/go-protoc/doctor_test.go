@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/pkg/wasm"
+)
+
+type mockDoctorCache struct {
+	mockVersionCache
+}
+
+func (m *mockDoctorCache) Dir() string {
+	return m.dir
+}
+
+// newTestDoctor creates a doctor checking against a local server that reports
+// remaining GitHub API requests.
+func newTestDoctor(t *testing.T, remaining int) *doctor {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"resources": map[string]any{
+				"core": map[string]any{"limit": 60, "remaining": remaining, "reset": 0},
+			},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return &doctor{
+		cache:        &mockDoctorCache{mockVersionCache{dir: t.TempDir()}},
+		tag:          "v32.1",
+		client:       server.Client(),
+		releasesURL:  server.URL + "/releases",
+		rateLimitURL: server.URL + "/rate_limit",
+	}
+}
+
+func writeMockPlugin(t *testing.T, dir, name, version string) {
+	t.Helper()
+	script := "#!/bin/sh\necho " + name + " " + version + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock binaries require a POSIX shell")
+	}
+	binDir := t.TempDir()
+	writeMockPlugin(t, binDir, "protoc-gen-go", "v1.36.10")
+	writeMockPlugin(t, binDir, "protoc-gen-go-grpc", "1.5.1")
+	t.Setenv("PATH", binDir)
+
+	d := newTestDoctor(t, 42)
+	protocPath := d.cache.(versionCache).VersionBinPath("32.1")
+	if err := os.MkdirAll(filepath.Dir(protocPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(protocPath, []byte("#!/bin/sh\necho libprotoc 32.1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d.goMod = filepath.Join(t.TempDir(), "go.mod")
+	goMod := "module example.com/pets\n\ngo 1.24\n\nrequire (\n" +
+		"\tgoogle.golang.org/grpc v1.60.0\n" +
+		"\tgoogle.golang.org/protobuf v1.36.11\n" +
+		")\n"
+	if err := os.WriteFile(d.goMod, []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []checkResult{
+		{Name: "network", Status: checkPass},
+		{Name: "rate limit", Status: checkPass, Message: "42 of 60 GitHub API requests remaining"},
+		{Name: "cache", Status: checkPass},
+		{Name: "protoc", Status: checkPass, Message: "protoc 32.1 at " + protocPath},
+		{
+			Name:    "protoc-gen-go",
+			Status:  checkWarn,
+			Message: "protoc-gen-go v1.36.10 is older than google.golang.org/protobuf v1.36.11 in go.mod",
+			Hint:    "go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.36.11",
+		},
+		{
+			Name:    "protoc-gen-go-grpc",
+			Status:  checkFail,
+			Message: "protoc-gen-go-grpc v1.5.1 generates code requiring google.golang.org/grpc v1.64.0, go.mod requires v1.60.0",
+			Hint:    "go get google.golang.org/grpc@v1.64.0",
+		},
+	}
+	results := d.run()
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i, result := range results {
+		if result.Name != expected[i].Name || result.Status != expected[i].Status {
+			t.Errorf("Expected %s %s, got %+v", expected[i].Status, expected[i].Name, result)
+		}
+		if expected[i].Message != "" && result.Message != expected[i].Message {
+			t.Errorf("Expected message %q, got %q", expected[i].Message, result.Message)
+		}
+		if result.Hint != expected[i].Hint {
+			t.Errorf("Expected hint %q, got %q", expected[i].Hint, result.Hint)
+		}
+	}
+}
+
+func TestDoctor_Failures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock binaries require a POSIX shell")
+	}
+	t.Setenv("PATH", t.TempDir())
+	d := newTestDoctor(t, 0)
+	d.tag = DefaultProtocTag
+	// A corrupted binary fails to run.
+	protocPath := d.cache.(versionCache).VersionBinPath(DefaultProtocTag)
+	if err := os.MkdirAll(filepath.Dir(protocPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(protocPath, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d.releasesURL = "http://127.0.0.1:0"
+
+	statuses := map[string]checkStatus{}
+	for _, result := range d.run() {
+		statuses[result.Name] = result.Status
+		if result.Status != checkPass && result.Hint == "" && result.Name != "cache" {
+			t.Errorf("Expected a hint for %+v", result)
+		}
+	}
+	expected := map[string]checkStatus{
+		"network":            checkFail,
+		"rate limit":         checkFail,
+		"cache":              checkPass,
+		"protoc":             checkFail,
+		"protoc-gen-go":      checkFail,
+		"protoc-gen-go-grpc": checkFail,
+	}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("Expected %s to %s, got %s", name, status, statuses[name])
+		}
+	}
+}
+
+func TestDoctor_CheckProtoc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock binaries require a POSIX shell")
+	}
+	tests := map[string]struct {
+		tag      string
+		reported string
+		expected checkStatus
+	}{
+		"same version":            {tag: "v32.1", reported: "libprotoc 32.1", expected: checkPass},
+		"3.x version":             {tag: "v21.12", reported: "libprotoc 3.21.12", expected: checkPass},
+		"other version":           {tag: "v32.1", reported: "libprotoc 31.1", expected: checkFail},
+		"ending with the version": {tag: "v2.1", reported: "libprotoc 32.1", expected: checkFail},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDoctor(t, 60)
+			d.tag = tt.tag
+			protocPath := d.cache.(versionCache).VersionBinPath(strings.TrimPrefix(tt.tag, "v"))
+			if err := os.MkdirAll(filepath.Dir(protocPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(protocPath, []byte("#!/bin/sh\necho "+tt.reported+"\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if result := d.checkProtoc(); result.Status != tt.expected {
+				t.Errorf("Expected %s, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDoctor_CheckProtoc_Corrupt(t *testing.T) {
+	cache, _ := newTestProtocBinCache(t)
+	binPath, err := cache.BinPath("v32.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep the size and modification time, which BinPath trusts.
+	content := bytes.Repeat([]byte("x"), int(info.Size()))
+	if err := os.WriteFile(binPath, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(binPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestDoctor(t, 60)
+	d.cache = cache
+	result := d.checkProtoc()
+	if result.Status != checkFail || !strings.Contains(result.Message, "cached protoc 32.1 is invalid: protoc binary digest is") {
+		t.Errorf("Expected the corrupt binary to fail, got %+v", result)
+	}
+}
+
+func TestDoctor_CheckProtoc_Wasm(t *testing.T) {
+	content, err := os.ReadFile(buildMockModule(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := wasm.NewRuntime(t.TempDir())
+	writeTestFiles(t, filepath.Dir(r.VersionBinPath("32.1")), map[string]string{"protoc.wasm": string(content)})
+
+	d := newTestDoctor(t, 60)
+	d.cache = r
+	if result := d.checkProtoc(); result.Status != checkPass {
+		t.Errorf("Expected the module to pass, got %+v", result)
+	}
+}
+
+func TestWriteCheckResults(t *testing.T) {
+	var out bytes.Buffer
+	err := writeCheckResults(&out, []checkResult{
+		{Name: "network", Status: checkPass, Message: "reachable"},
+		{Name: "protoc-gen-go", Status: checkFail, Message: "not found in PATH", Hint: "go install"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "PASS  network        reachable\n" +
+		"FAIL  protoc-gen-go  not found in PATH\n" +
+		"                     hint: go install\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestRunDoctor_UnexpectedArguments(t *testing.T) {
+	err := runDoctor(&mockBinCache{}, &bytes.Buffer{}, "extra")
+	if err == nil || errors.Is(err, ErrDoctorFailed) || !strings.Contains(err.Error(), "unexpected arguments") {
+		t.Errorf("Expected unexpected arguments error, got: %v", err)
+	}
+}
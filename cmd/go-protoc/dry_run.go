@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// protocCommand is the protoc command go-protoc runs.
+type protocCommand struct {
+	// Tag is the release tag selected by PROTOC_RELEASE_TAG, and Version the
+	// version it resolves to, when the cache can tell.
+	Tag     string `json:"tag"`
+	Version string `json:"version,omitempty"`
+	Binary  string `json:"binary"`
+	// Cached is false when running the command would download protoc first.
+	Cached bool     `json:"cached"`
+	Dir    string   `json:"dir"`
+	Args   []string `json:"args"`
+}
+
+// String returns the command line, with every argument quoted for POSIX
+// shells as needed.
+func (c protocCommand) String() string {
+	words := []string{shellQuote(c.Binary)}
+	for _, arg := range c.Args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// dryRunProtoc resolves the protoc command runProtoc would run in dir, with
+// outputs in place, and writes it to w, as JSON when asJSON is set, instead
+// of running it. Caches that implement versionCache report where protoc
+// would be without downloading it.
+func dryRunProtoc(cache BinCache, tag, dir string, asJSON bool, w io.Writer, args ...string) error {
+	opts := protocOptions(cache, tag, dir, args)
+	args, err := opts.Command()
+	if err != nil {
+		return err
+	}
+	command := protocCommand{Tag: tag, Dir: dir, Args: args}
+	if vc, ok := cache.(versionCache); ok {
+		if command.Version, err = vc.ResolveVersion(tag); err != nil {
+			return fmt.Errorf("failed to resolve protoc %s: %w", tag, err)
+		}
+		command.Binary = vc.VersionBinPath(command.Version)
+		_, err := os.Stat(command.Binary)
+		command.Cached = err == nil
+	} else {
+		if command.Binary, err = cache.BinPath(tag); err != nil {
+			return fmt.Errorf("failed to get protoc binary %s: %w", tag, err)
+		}
+		command.Cached = true
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(command)
+	}
+	binary := command.Binary
+	if !command.Cached {
+		binary += " (not cached)"
+	}
+	fmt.Fprintf(w, "# protoc %s: %s\n", tag, binary)
+	fmt.Fprintf(w, "# dir: %s\n", dir)
+	_, err = fmt.Fprintln(w, command)
+	return err
+}
+
+// shellQuote quotes s for POSIX shells, unless it only contains characters
+// that need no quoting.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !isShellSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("@%+=:,./_-", r)
+}
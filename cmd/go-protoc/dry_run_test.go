@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	testCases := map[string]struct {
+		arg      string
+		expected string
+	}{
+		"plain":        {arg: "--go_opt=paths=source_relative", expected: "--go_opt=paths=source_relative"},
+		"path":         {arg: "/home/user/.cache/go-protoc/32.1/bin/protoc", expected: "/home/user/.cache/go-protoc/32.1/bin/protoc"},
+		"empty":        {arg: "", expected: "''"},
+		"space":        {arg: "my pets.proto", expected: "'my pets.proto'"},
+		"glob":         {arg: "*.proto", expected: "'*.proto'"},
+		"variable":     {arg: "--go_out=$OUT", expected: "'--go_out=$OUT'"},
+		"single quote": {arg: "it's.proto", expected: `'it'\''s.proto'`},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if quoted := shellQuote(tc.arg); quoted != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, quoted)
+			}
+		})
+	}
+}
+
+func TestDryRunProtoc(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"pets/pet.proto":      "syntax = \"proto3\";",
+		"pets/my owner.proto": "syntax = \"proto3\";",
+	})
+	t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+	cacheDir := t.TempDir()
+	cache := &mockVersionCache{dir: cacheDir}
+	binPath := filepath.Join(cacheDir, "32.1", "protoc")
+
+	var out bytes.Buffer
+	if err := dryRunProtoc(cache, protocTag(cache), dir, false, &out, "--go_out=gen"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "# protoc v32.1: " + binPath + " (not cached)\n" +
+		"# dir: " + dir + "\n" +
+		shellQuote(binPath) + " --go_opt=paths=source_relative --go-grpc_out=. " +
+		"--go-grpc_opt=paths=source_relative --go_out=gen 'pets/my owner.proto' pets/pet.proto\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if cache.callCount != 0 {
+		t.Errorf("Expected protoc not to be fetched, got %d calls", cache.callCount)
+	}
+
+	out.Reset()
+	if err := dryRunProtoc(cache, protocTag(cache), dir, true, &out, "pets/pet.proto"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var command protocCommand
+	if err := json.Unmarshal(out.Bytes(), &command); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v\n%s", err, out.String())
+	}
+	expectedCommand := protocCommand{
+		Tag:     "v32.1",
+		Version: "32.1",
+		Binary:  binPath,
+		Dir:     dir,
+		Args: []string{
+			"--go_out=.", "--go_opt=paths=source_relative",
+			"--go-grpc_out=.", "--go-grpc_opt=paths=source_relative", "pets/pet.proto",
+		},
+	}
+	if !reflect.DeepEqual(command, expectedCommand) {
+		t.Errorf("Expected %+v, got %+v", expectedCommand, command)
+	}
+}
+
+func TestDryRunProtoc_BinCache(t *testing.T) {
+	t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+	cache := &mockBinCache{binPath: "/cache/protoc"}
+	var out bytes.Buffer
+	if err := dryRunProtoc(cache, protocTag(cache), "/work", false, &out, "--version"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "# protoc v32.1: /cache/protoc\n# dir: /work\n/cache/protoc ") ||
+		!strings.Contains(out.String(), " --version") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	cache.err = errors.New("offline")
+	err := dryRunProtoc(cache, protocTag(cache), "/work", false, &out, "--version")
+	if err == nil || !strings.Contains(err.Error(), "failed to get protoc binary v32.1: offline") {
+		t.Errorf("Expected cache error, got: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/editions"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+)
+
+// selectProtocTag returns the protoc release tag to compile the inputs of
+// args with, which are relative to dir. When PROTOC_RELEASE_TAG is a version
+// range, such as ">=v25.0", the lowest published version of the range supporting the
+// editions of the inputs is selected. Otherwise, a release too old for them
+// is reported before downloading it, as protoc would fail with parse errors.
+func selectProtocTag(cache BinCache, dir string, args []string) (string, error) {
+	tag := protocReleaseTag()
+	inputs, err := protoInputs(dir, args)
+	if err != nil {
+		return "", err
+	}
+	req := editions.Require(dir, inputs)
+
+	if editions.IsRange(tag) {
+		r, err := editions.ParseRange(tag)
+		if err != nil {
+			return "", fmt.Errorf("invalid PROTOC_RELEASE_TAG: %w", err)
+		}
+		selected, err := r.Select(req, protoc.PublishedVersions(cache))
+		if err != nil {
+			return "", fmt.Errorf("%w: widen PROTOC_RELEASE_TAG", err)
+		}
+		logger.Debug("selected protoc from range", "tag", selected, "range", tag)
+		return selected, nil
+	}
+
+	// The latest release supports every known edition.
+	version := strings.TrimPrefix(tag, "v")
+	if tag != DefaultProtocTag && !req.Satisfies(version) {
+		return "", fmt.Errorf("%s, but PROTOC_RELEASE_TAG selects %s: set PROTOC_RELEASE_TAG to v%s or newer, or to a range such as \">=v%s\"",
+			req, tag, req.MinVersion, req.MinVersion)
+	}
+	return tag, nil
+}
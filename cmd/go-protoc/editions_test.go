@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSelectProtocTag(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"pet.proto":     "edition = \"2023\";\npackage pets;\n",
+		"owner.proto":   "syntax = \"proto3\";\npackage pets;\n",
+		"api/v2.proto":  "edition = \"2024\";\npackage pets.v2;\n",
+		"api/v1.proto":  "syntax = \"proto3\";\npackage pets.v1;\n",
+		"api/README.md": "",
+	})
+
+	testCases := map[string]struct {
+		tag         string
+		args        []string
+		expected    string
+		expectedErr string
+	}{
+		"syntax only": {
+			tag:      "v3.20.3",
+			args:     []string{"owner.proto"},
+			expected: "v3.20.3",
+		},
+		"supported edition": {
+			tag:      "v27.1",
+			args:     []string{"pet.proto"},
+			expected: "v27.1",
+		},
+		"latest": {
+			tag:      "latest",
+			args:     []string{"pet.proto"},
+			expected: "latest",
+		},
+		"too old": {
+			tag:         "v25.3",
+			args:        []string{"--go_out=.", "pet.proto"},
+			expectedErr: `pet.proto uses edition 2023, which requires protoc 27.0 or newer, but PROTOC_RELEASE_TAG selects v25.3: set PROTOC_RELEASE_TAG to v27.0 or newer, or to a range such as ">=v27.0"`,
+		},
+		"discovered inputs": {
+			tag:         "v30.2",
+			expectedErr: "api/v2.proto uses edition 2024, which requires protoc 32.0 or newer",
+		},
+		"range": {
+			tag:      ">=v25.0",
+			args:     []string{"pet.proto", "owner.proto"},
+			expected: "v27.0",
+		},
+		"range without editions": {
+			tag:      ">=v25.0",
+			args:     []string{"owner.proto"},
+			expected: "v25.0",
+		},
+		"range too old": {
+			tag:         ">=v25.0 <v32.0",
+			expectedErr: "no protoc version in range >=v25.0 <v32.0: api/v2.proto uses edition 2024",
+		},
+		"invalid range": {
+			tag:         "<v30.0",
+			expectedErr: "invalid PROTOC_RELEASE_TAG",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("PROTOC_RELEASE_TAG", tc.tag)
+			tag, err := selectProtocTag(&mockBinCache{}, dir, tc.args)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if tag != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, tag)
+			}
+		})
+	}
+}
+
+func TestRun_EditionRange(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"pet.proto": "edition = \"2023\";\npackage pets;\n",
+	})
+	t.Chdir(dir)
+	t.Setenv("PROTOC_RELEASE_TAG", ">=v25.0")
+	cache := &mockBinCache{binPath: createMockBinary(t)}
+
+	if err := run(cache, os.DirFS(dir), []string{"pet.proto"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.lastTag != "v27.0" {
+		t.Errorf("Expected protoc v27.0, got %s", cache.lastTag)
+	}
+	if tag := os.Getenv("PROTOC_RELEASE_TAG"); tag != ">=v25.0" {
+		t.Errorf("Expected PROTOC_RELEASE_TAG to be left unchanged, got %s", tag)
+	}
+
+	// The lowest published version is selected.
+	listing := &mockListingCache{mockBinCache: *cache, versions: []string{"28.0", "27.1", "26.1"}}
+	if err := run(listing, os.DirFS(dir), []string{"pet.proto"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if listing.lastTag != "v27.1" {
+		t.Errorf("Expected protoc v27.1, got %s", listing.lastTag)
+	}
+}
+
+type mockListingCache struct {
+	mockBinCache
+	versions []string
+}
+
+func (m *mockListingCache) ListVersions() ([]string, error) {
+	return m.versions, nil
+}
+
+func TestRun_EditionTooOld(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"pet.proto": "edition = \"2023\";\npackage pets;\n",
+	})
+	t.Chdir(dir)
+	t.Setenv("PROTOC_RELEASE_TAG", "v25.3")
+	cache := &mockBinCache{binPath: createMockBinary(t)}
+
+	err := run(cache, os.DirFS(dir), []string{"pet.proto"})
+	if err == nil || !strings.Contains(err.Error(), "requires protoc 27.0 or newer") {
+		t.Errorf("Expected edition error, got: %v", err)
+	}
+	if cache.callCount != 0 {
+		t.Errorf("Expected protoc not to be fetched, got %d calls", cache.callCount)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/esdandreu/go-protoc/pkg/diff"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"github.com/esdandreu/go-protoc/pkg/protofmt"
+)
+
+// ErrNotFormatted is returned by the fmt subcommand in list or diff mode when
+// some proto files are not formatted.
+var ErrNotFormatted = errors.New("proto files are not formatted")
+
+// runFmt implements `go-protoc fmt [-w] [-d] [-l] [path ...]`, which formats
+// proto files like gofmt formats Go files. The formatted files are written to
+// w unless -w writes them back, -d prints a diff or -l lists the files that
+// are not formatted. Directories are searched for proto files the same way
+// the generator does, and the proto files in dirFs are formatted when no path
+// is given.
+func runFmt(dirFs fs.FS, w io.Writer, args ...string) error {
+	args, write := ExtractFlag(args, "w")
+	args, showDiff := ExtractFlag(args, "d")
+	args, list := ExtractFlag(args, "l")
+
+	var files []string
+	if len(args) == 0 {
+		found, err := protoc.FindProtoFiles(dirFs)
+		if err != nil {
+			return err
+		}
+		files = found
+	}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := protoc.FindProtoFiles(os.DirFS(arg))
+		if err != nil {
+			return err
+		}
+		for _, name := range found {
+			files = append(files, filepath.Join(arg, filepath.FromSlash(name)))
+		}
+	}
+
+	unformatted := false
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		formatted, err := protofmt.Format(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		changed := !bytes.Equal(src, formatted)
+		if changed {
+			unformatted = true
+		}
+		if list && changed {
+			if _, err := fmt.Fprintln(w, file); err != nil {
+				return err
+			}
+		}
+		if showDiff && changed {
+			if _, err := w.Write(diff.Unified(file+".orig", file, src, formatted)); err != nil {
+				return err
+			}
+		}
+		if write && changed {
+			info, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(file, formatted, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if !list && !showDiff && !write {
+			if _, err := w.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+	if unformatted && (list || showDiff) && !write {
+		return ErrNotFormatted
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const (
+	unformattedProto = "syntax=\"proto3\";\nmessage Pet{int64 id=1;}\n"
+	formattedProto   = "syntax = \"proto3\";\n\nmessage Pet {\n  int64 id = 1;\n}\n"
+)
+
+func TestRunFmt(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"pet.proto":         unformattedProto,
+		"sub/done.proto":    formattedProto,
+		"other/other.proto": unformattedProto,
+	})
+
+	var out bytes.Buffer
+	if err := runFmt(os.DirFS(dir), &out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != strings.Repeat(formattedProto, 3) {
+		t.Errorf("Expected formatted protos, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	err := runFmt(os.DirFS(dir), &out, "-l")
+	if !errors.Is(err, ErrNotFormatted) {
+		t.Errorf("Expected ErrNotFormatted, got: %v", err)
+	}
+	if out.String() != "pet.proto\nother/other.proto\n" {
+		t.Errorf("Expected unformatted file to be listed, got %q", out.String())
+	}
+
+	out.Reset()
+	err = runFmt(os.DirFS(dir), &out, "-d", "other")
+	if !errors.Is(err, ErrNotFormatted) {
+		t.Errorf("Expected ErrNotFormatted, got: %v", err)
+	}
+	name := filepath.Join("other", "other.proto")
+	if !strings.HasPrefix(out.String(), "--- "+name+".orig\n+++ "+name+"\n") {
+		t.Errorf("Expected diff, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runFmt(os.DirFS(dir), &out, "-w"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, name := range []string{"pet.proto", "other/other.proto"} {
+		content, _ := os.ReadFile(filepath.Join(dir, name))
+		if string(content) != formattedProto {
+			t.Errorf("Expected %s to be rewritten, got:\n%s", name, content)
+		}
+	}
+}
+
+func TestRunFmt_SyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"bad.proto": "message Pet {\n"})
+
+	err := runFmt(os.DirFS(dir), &bytes.Buffer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "bad.proto: line 1:") {
+		t.Errorf("Expected error with position, got: %v", err)
+	}
+}
+
+func TestRunFmt_KeepsFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"pet.proto": unformattedProto})
+	if err := os.Chmod(filepath.Join(dir, "pet.proto"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runFmt(os.DirFS(dir), &bytes.Buffer{}, "-w"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "pet.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %v", info.Mode().Perm())
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestRunFmt_WriteError(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"pet.proto": unformattedProto})
+
+	for _, args := range [][]string{nil, {"-l"}, {"-d"}} {
+		err := runFmt(os.DirFS(dir), failingWriter{}, args...)
+		if err == nil || errors.Is(err, ErrNotFormatted) {
+			t.Errorf("Expected write error for %v, got: %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/editions"
+	"golang.org/x/mod/modfile"
+)
+
+// ErrGenerateFailed is returned by generate when generation fails in any
+// directory.
+var ErrGenerateFailed = errors.New("generation failed")
+
+// generateDirective is a //go:generate directive running go-protoc.
+type generateDirective struct {
+	// File is the Go file declaring the directive, and Package its package
+	// name, given to go-protoc as $GOFILE and $GOPACKAGE like go generate
+	// does.
+	File    string
+	Line    int
+	Package string
+	// Args are the arguments of go-protoc.
+	Args []string
+}
+
+// generateJob generates the code of a directory.
+type generateJob struct {
+	// Dir is the directory, and Name its path as displayed.
+	Dir  string
+	Name string
+	// Directives are run one after the other. A directory without directives
+	// runs go-protoc once with the default arguments.
+	Directives []generateDirective
+	Output     bytes.Buffer
+	Duration   time.Duration
+	Err        error
+}
+
+// runGenerate implements `go-protoc generate [-p n] [packages]`, which runs
+// go-protoc in every directory matching the package patterns that contains
+// proto files or go-protoc //go:generate directives, up to n at a time. The
+// protoc release is resolved and downloaded once for every directory.
+// Without patterns, every module of the workspace is generated, or the
+// current module outside of a workspace.
+func runGenerate(cache BinCache, w io.Writer, args ...string) error {
+	args, parallelism, ok := ExtractFlagValue(args, "p")
+	jobsLimit := runtime.GOMAXPROCS(0)
+	if ok {
+		n, err := strconv.Atoi(parallelism)
+		if err != nil || n < 1 {
+			return fmt.Errorf("generate: invalid -p value %q", parallelism)
+		}
+		jobsLimit = n
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("generate: unknown flag %s", arg)
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find go-protoc executable: %w", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	jobs, err := findGenerateJobs(wd, args)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no proto files or go-protoc directives found")
+	}
+
+	// Warm the cache once, so that the jobs neither resolve the tag nor
+	// download protoc again. Version ranges are passed on instead, as each
+	// job selects a version for its own files.
+	tag := protocReleaseTag()
+	if !editions.IsRange(tag) {
+		if resolver, ok := cache.(versionCache); ok {
+			if tag, err = resolver.ResolveVersion(tag); err != nil {
+				return fmt.Errorf("failed to resolve protoc version %s: %w", protocReleaseTag(), err)
+			}
+		}
+		if _, err := cache.BinPath(tag); err != nil {
+			return fmt.Errorf("failed to get protoc binary %s: %w", tag, err)
+		}
+	}
+	env := append(os.Environ(),
+		"PROTOC_RELEASE_TAG="+tag,
+		"GO_PROTOC_FORMAT="+string(diagnosticsFormat),
+	)
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, jobsLimit)
+	for _, job := range jobs {
+		wg.Go(func() {
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			job.run(executable, env)
+		})
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, job := range jobs {
+		if job.Err != nil {
+			failed++
+		}
+		if job.Output.Len() > 0 {
+			fmt.Fprintf(w, "# %s\n%s", job.Name, job.Output.Bytes())
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIRECTORY\tSTATUS\tTIME")
+	for _, job := range jobs {
+		status := "ok"
+		if job.Err != nil {
+			status = "FAIL: " + job.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", job.Name, status, job.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w in %d of %d directories", ErrGenerateFailed, failed, len(jobs))
+	}
+	return nil
+}
+
+// run runs go-protoc for every directive of the job.
+func (job *generateJob) run(executable string, env []string) {
+	start := time.Now()
+	defer func() { job.Duration = time.Since(start) }()
+	directives := job.Directives
+	if len(directives) == 0 {
+		directives = []generateDirective{{}}
+	}
+	for _, directive := range directives {
+		cmd := exec.Command(executable, directive.Args...)
+		cmd.Dir = job.Dir
+		cmd.Env = env
+		if directive.File != "" {
+			cmd.Env = append(slices.Clone(env),
+				"GOFILE="+directive.File,
+				"GOLINE="+strconv.Itoa(directive.Line),
+				"GOPACKAGE="+directive.Package,
+			)
+		}
+		cmd.Stdout = &job.Output
+		cmd.Stderr = &job.Output
+		if err := cmd.Run(); err != nil {
+			if directive.File != "" {
+				err = fmt.Errorf("%s:%d: %w", directive.File, directive.Line, err)
+			}
+			job.Err = err
+			return
+		}
+	}
+}
+
+// findGenerateJobs returns a job for every directory matching the patterns
+// that contains go-protoc directives, or proto files not already compiled by
+// a directive of its parent directory, as the default inputs include the
+// proto files of subdirectories.
+func findGenerateJobs(wd string, patterns []string) ([]*generateJob, error) {
+	workspace, err := findWorkspaceModules(wd)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		roots := workspace
+		if len(roots) == 0 {
+			goMod := findGoMod(wd)
+			if goMod == "" {
+				return nil, fmt.Errorf("go.mod file not found in %s or any parent directory", wd)
+			}
+			roots = []string{filepath.Dir(goMod)}
+		}
+		for _, root := range roots {
+			patterns = append(patterns, filepath.Join(root, "..."))
+		}
+	}
+
+	var dirs []string
+	for _, pattern := range patterns {
+		root, recursive := strings.CutSuffix(filepath.ToSlash(pattern), "/...")
+		if root == "..." {
+			root, recursive = ".", true
+		}
+		root = filepath.FromSlash(root)
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(wd, root)
+		}
+		if !recursive {
+			dirs = append(dirs, root)
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			if path != root {
+				name := d.Name()
+				if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+					return filepath.SkipDir
+				}
+				// Nested modules are only part of the pattern in a
+				// workspace using them, as with go generate.
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && !slices.Contains(workspace, path) {
+					return filepath.SkipDir
+				}
+			}
+			dirs = append(dirs, path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", pattern, err)
+		}
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	var jobs []*generateJob
+	// coversSubdirs records the directories with a directive compiling the
+	// default inputs, which include the proto files of subdirectories.
+	coversSubdirs := map[string]bool{}
+	for _, dir := range dirs {
+		directives, err := findDirectives(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, directive := range directives {
+			if _, hasInputs := ParseArgs(directive.Args); !hasInputs {
+				coversSubdirs[dir] = true
+			}
+		}
+		if len(directives) == 0 {
+			protos, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+			if err != nil || len(protos) == 0 || coversSubdirs[filepath.Dir(dir)] {
+				continue
+			}
+		}
+		name, err := filepath.Rel(wd, dir)
+		if err != nil || strings.HasPrefix(name, "..") {
+			name = dir
+		}
+		jobs = append(jobs, &generateJob{Dir: dir, Name: name, Directives: directives})
+	}
+	return jobs, nil
+}
+
+// findWorkspaceModules returns the module directories of the go.work file in
+// effect for wd, if any.
+func findWorkspaceModules(wd string) ([]string, error) {
+	goWork := os.Getenv("GOWORK")
+	if goWork == "off" {
+		return nil, nil
+	}
+	if goWork == "" {
+		for dir := wd; ; dir = filepath.Dir(dir) {
+			if _, err := os.Stat(filepath.Join(dir, "go.work")); err == nil {
+				goWork = filepath.Join(dir, "go.work")
+				break
+			}
+			if filepath.Dir(dir) == dir {
+				return nil, nil
+			}
+		}
+	}
+	content, err := os.ReadFile(goWork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go.work: %w", err)
+	}
+	work, err := modfile.ParseWork(goWork, content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.work: %w", err)
+	}
+	var modules []string
+	for _, use := range work.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(goWork), dir)
+		}
+		modules = append(modules, dir)
+	}
+	return modules, nil
+}
+
+// findDirectives returns the //go:generate directives running go-protoc in
+// the Go files of dir. Directives running generate itself are ignored.
+func findDirectives(dir string) ([]generateDirective, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var directives []generateDirective
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if !bytes.Contains(content, []byte("//go:generate")) {
+			continue
+		}
+		pkg := ""
+		if f, err := parser.ParseFile(token.NewFileSet(), file, content, parser.PackageClauseOnly); err == nil {
+			pkg = f.Name.Name
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for line := 1; scanner.Scan(); line++ {
+			directive, ok := strings.CutPrefix(scanner.Text(), "//go:generate")
+			if !ok || (directive != "" && directive[0] != ' ' && directive[0] != '\t') {
+				continue
+			}
+			words, err := splitDirective(directive, filepath.Base(file), line, pkg)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+			}
+			args, ok := goProtocArgs(words)
+			if !ok || (len(args) > 0 && args[0] == "generate") {
+				continue
+			}
+			directives = append(directives, generateDirective{
+				File:    filepath.Base(file),
+				Line:    line,
+				Package: pkg,
+				Args:    args,
+			})
+		}
+	}
+	return directives, nil
+}
+
+// goProtocArgs returns the go-protoc arguments of a directive running
+// go-protoc, as `go tool go-protoc`, `go run <module>` or `go-protoc`.
+func goProtocArgs(words []string) ([]string, bool) {
+	switch {
+	case len(words) >= 1 && words[0] == "go-protoc":
+		return words[1:], true
+	case len(words) >= 3 && words[0] == "go" && words[1] == "tool" &&
+		(words[2] == "go-protoc" || words[2] == ModulePath+"/cmd/go-protoc"):
+		return words[3:], true
+	case len(words) >= 3 && words[0] == "go" && words[1] == "run":
+		target, _, _ := strings.Cut(words[2], "@")
+		if target == ModulePath || strings.HasPrefix(target, ModulePath+"/") {
+			return words[3:], true
+		}
+	}
+	return nil, false
+}
+
+// splitDirective splits a directive into words like go generate does:
+// double-quoted strings are single words and $NAME is expanded from the
+// environment, which includes $GOFILE, $GOLINE, $GOPACKAGE and $DOLLAR.
+func splitDirective(directive, file string, line int, pkg string) ([]string, error) {
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			switch name {
+			case "GOFILE":
+				return file
+			case "GOLINE":
+				return strconv.Itoa(line)
+			case "GOPACKAGE":
+				return pkg
+			case "DOLLAR":
+				return "$"
+			}
+			return os.Getenv(name)
+		})
+	}
+	var words []string
+	rest := strings.TrimSpace(directive)
+	for rest != "" {
+		if rest[0] == '"' {
+			end := 1
+			for ; end < len(rest) && rest[end] != '"'; end++ {
+				if rest[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(rest) {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			word, err := strconv.Unquote(rest[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %w", err)
+			}
+			words = append(words, expand(word))
+			rest = strings.TrimLeft(rest[end+1:], " \t")
+			continue
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		words = append(words, expand(rest[:end]))
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return words, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+func TestRunGenerate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock protoc requires a POSIX shell")
+	}
+	t.Setenv("GO_PROTOC_TEST_MAIN", "1")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("PROTOC_RELEASE_TAG", "latest")
+	t.Setenv("GOWORK", "")
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := bincache.NewProtocBinCache(cacheDir)
+	cache.VersionResolver = mockVersionResolver{}
+	cache.URLResolver = mockURLResolver{}
+	downloader := &mockZipDownloader{}
+	cache.ZipDownloader = downloader
+	cache.Checker = nil
+
+	// The mock protoc, cached for the resolved version, records its
+	// environment and fails to compile broken.proto.
+	mockprotoc.Write(t, cache.VersionBinPath("32.1"),
+		mockprotoc.OnArg("broken.proto", `echo 'broken.proto:1:1: Expected "syntax".' >&2; exit 1`),
+		mockprotoc.OnArg("--go_out=*", `printf '%s %s' "$GOPACKAGE" "$PROTOC_RELEASE_TAG" > "${arg#--go_out=}/generated.txt"`),
+	)
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"go.work":                "go 1.25\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod":               "module example.com/a\n",
+		"a/gen.go":               "package pets\n\n//go:generate go tool go-protoc\n",
+		"a/x.proto":              "",
+		"a/api/pet.proto":        "",
+		"a/testdata/t.proto":     "",
+		"a/explicit/gen.go":      "package explicit\n\n//go:generate go tool go-protoc x.proto\n",
+		"a/explicit/x.proto":     "",
+		"a/explicit/sub/y.proto": "",
+		"b/go.mod":               "module example.com/b\n",
+		"b/broken.proto":         "",
+		"c/go.mod":               "module example.com/c\n",
+		"c/z.proto":              "",
+	})
+	t.Chdir(root)
+
+	var out bytes.Buffer
+	err = runGenerate(cache, &out, "-p", "2")
+	if !errors.Is(err, ErrGenerateFailed) {
+		t.Fatalf("Expected ErrGenerateFailed, got: %v\n%s", err, out.String())
+	}
+	if len(downloader.urls) != 0 {
+		t.Errorf("Expected no download, got %v", downloader.urls)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, "a", "generated.txt"))
+	if err != nil || string(content) != "pets 32.1" {
+		t.Errorf("Expected generation with the directive environment, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "explicit", "sub", "generated.txt")); err != nil {
+		t.Errorf("Expected generation in a directory without directives, got: %v", err)
+	}
+
+	var rows []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && (fields[1] == "ok" || fields[1] == "FAIL:") {
+			rows = append(rows, fields[0]+" "+fields[1])
+		}
+	}
+	// a/api is compiled by the directive of a, which has no explicit inputs.
+	expected := []string{"a ok", filepath.Join("a", "explicit") + " ok", filepath.Join("a", "explicit", "sub") + " ok", "b FAIL:"}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected summary %v, got:\n%s", expected, out.String())
+	}
+	if _, section, _ := strings.Cut(out.String(), "# b\n"); !strings.Contains(section, "broken.proto:1:1: Expected \"syntax\".\n") {
+		t.Errorf("Expected protoc output of b, got:\n%s", out.String())
+	}
+}
+
+func TestGoProtocArgs(t *testing.T) {
+	testCases := map[string]struct {
+		directive string
+		args      []string
+		ok        bool
+	}{
+		"go tool":     {directive: `go tool go-protoc --go_out=. "a b.proto"`, args: []string{"--go_out=.", "a b.proto"}, ok: true},
+		"go run":      {directive: "go run github.com/esdandreu/go-protoc@latest", args: []string{}, ok: true},
+		"installed":   {directive: "go-protoc --check", args: []string{"--check"}, ok: true},
+		"environment": {directive: "go-protoc --descriptor-set=$GOPACKAGE.binpb", args: []string{"--descriptor-set=pets.binpb"}, ok: true},
+		"other tool":  {directive: "go tool stringer -type=Pet", ok: false},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			words, err := splitDirective(" "+tc.directive, "pets.go", 3, "pets")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			args, ok := goProtocArgs(words)
+			if ok != tc.ok || (ok && !reflect.DeepEqual(args, tc.args)) {
+				t.Errorf("Expected %v %v, got %v %v", tc.args, tc.ok, args, ok)
+			}
+		})
+	}
+}
@@ -1,95 +1,311 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
-	"os/exec"
-	"slices"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"github.com/esdandreu/go-protoc/pkg/compiler"
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+	"github.com/esdandreu/go-protoc/pkg/editions"
+	"github.com/esdandreu/go-protoc/pkg/outcache"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"github.com/esdandreu/go-protoc/pkg/releases"
+	"github.com/esdandreu/go-protoc/pkg/signature"
+	"github.com/esdandreu/go-protoc/pkg/wasm"
 )
 
-const (
-	DefaultProtocTag     = "latest"
-	DefaultGoOutFlag     = "--go_out=."
-	DefaultGoOptPathFlag = "--go_opt=paths=source_relative"
-	DefaultGoGrpcOutFlag = "--go-grpc_out=."
-	DefaultGoGrpcOptFlag = "--go-grpc_opt=paths=source_relative"
-)
+const DefaultProtocTag = protoc.DefaultTag
 
-var ProtoFilesPatterns = []string{"*.proto", "**/*.proto"}
+// diagnosticsFormat is the format protoc errors and warnings are reported in.
+// With protoc.FormatText, the output of protoc is forwarded as is.
+var diagnosticsFormat = protoc.FormatText
 
-var debug = func(format string, args ...any) {}
+// BinCache provides the path to a protoc binary for a release tag.
+type BinCache = protoc.BinCache
 
-type BinCache interface {
-	BinPath(tag string) (string, error)
+// runProtoc runs protoc in dir with args, completed like protoc.Run does with
+// the default plugins and, unless args name inputs, the proto files of dir.
+func runProtoc(cache BinCache, tag, dir string, args ...string) error {
+	_, err := runProtocWith(protocOptions(cache, tag, dir, args))
+	return err
 }
 
-func runProtoc(cache BinCache, dirFs fs.FS, args ...string) error {
-	// Determine protoc release tag.
-	tag, ok := os.LookupEnv("PROTOC_RELEASE_TAG")
-	if !ok {
-		tag = DefaultProtocTag
-	}
-
-	flags, hasNonFlagArgs := ParseArgs(args)
-	if !slices.Contains(flags, "go_out") {
-		args = append(args, DefaultGoOutFlag)
+// protocOptions returns the options go-protoc runs protoc with in dir, which
+// forward the standard streams of go-protoc and map the protos without a
+// go_package option to the Go packages of dir, see goPackages.
+func protocOptions(cache BinCache, tag, dir string, args []string) protoc.Options {
+	opts := protoc.Options{
+		Cache:      cache,
+		Version:    tag,
+		Dir:        dir,
+		Args:       args,
+		GoPackages: goPackages(dir, args),
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
 	}
-	if !slices.Contains(flags, "go_opt") {
-		args = append(args, DefaultGoOptPathFlag)
+	if diagnosticsFormat == protoc.FormatText {
+		opts.Stderr = os.Stderr
 	}
-	if !slices.Contains(flags, "go-grpc_out") {
-		args = append(args, DefaultGoGrpcOutFlag)
+	return opts
+}
+
+// runProtocWith runs protoc.Run, recording how long protoc ran. Unless
+// diagnosticsFormat is text, the errors and warnings protoc printed are
+// reported in that format.
+func runProtocWith(opts protoc.Options) (*protoc.Result, error) {
+	logger.Debug("executing protoc", "tag", opts.Version, "dir", opts.Dir, "args", opts.Args)
+	result, err := protoc.Run(context.Background(), opts)
+	if result.Duration == 0 {
+		return result, err
 	}
-	if !slices.Contains(flags, "go-grpc_opt") {
-		args = append(args, DefaultGoGrpcOptFlag)
+	runTimings.add(phaseProtoc, result.Duration)
+	logger.Debug("protoc finished", "version", result.ProtocVersion, "dir", opts.Dir, "duration", result.Duration)
+	if diagnosticsFormat != protoc.FormatText {
+		if diagnosticsFormat == protoc.FormatGitHub {
+			relativeToWorkspace(opts.Dir, result.Diagnostics)
+		}
+		if writeErr := protoc.WriteDiagnostics(os.Stdout, diagnosticsFormat, result.Diagnostics); writeErr != nil {
+			return result, fmt.Errorf("failed to write diagnostics: %w", writeErr)
+		}
 	}
-	if !hasNonFlagArgs {
-		for _, pattern := range ProtoFilesPatterns {
-			matches, err := fs.Glob(dirFs, pattern)
-			if err != nil {
-				return fmt.Errorf("failed to glob proto files: %w", err)
+	return result, err
+}
+
+// protocTag determines the protoc release tag of the subcommands that do not
+// compile inputs. A version range selects its lowest published version, see
+// selectProtocTag.
+func protocTag(cache BinCache) string {
+	tag := protocReleaseTag()
+	if editions.IsRange(tag) {
+		if r, err := editions.ParseRange(tag); err == nil {
+			if selected, err := r.Select(nil, protoc.PublishedVersions(cache)); err == nil {
+				return selected
 			}
-			args = append(args, matches...)
 		}
 	}
+	return tag
+}
 
-	// Get protoc binary path (downloads if needed).
-	binPath, err := cache.BinPath(tag)
-	if err != nil {
-		return fmt.Errorf("failed to get protoc binary %s: %w", tag, err)
+// protocReleaseTag returns the PROTOC_RELEASE_TAG setting, which is either a
+// release tag or a version range. An empty setting selects DefaultProtocTag.
+func protocReleaseTag() string {
+	tag := os.Getenv("PROTOC_RELEASE_TAG")
+	if tag == "" {
+		tag = DefaultProtocTag
+	}
+	return tag
+}
+
+// relativeToWorkspace makes the diagnostic files relative to the root of the
+// GitHub Actions workspace, as annotations require, when they are inside it.
+func relativeToWorkspace(dir string, diagnostics []protoc.Diagnostic) {
+	workspace := os.Getenv("GITHUB_WORKSPACE")
+	if workspace == "" {
+		return
 	}
+	for i, d := range diagnostics {
+		if d.File == "" {
+			continue
+		}
+		abs, err := filepath.Abs(filepath.Join(dir, d.File))
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(workspace, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			diagnostics[i].File = filepath.ToSlash(rel)
+		}
+	}
+}
 
-	debug("Executing protoc %s with args: %v", tag, args)
-	cmd := exec.Command(binPath, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+// envBool reports whether the environment variable is set to a true value
+// such as "1" or "true".
+func envBool(key string) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && value
+}
 
-	return cmd.Run()
+// newCache returns the cache providing protoc in cacheDir, as selected by
+// GO_PROTOC_COMPILER: the protoc releases downloaded into the cache, by
+// default, the pure-Go compiler built into go-protoc, or protoc compiled to
+// WebAssembly, downloaded from GO_PROTOC_WASM_URL into the cache.
+func newCache(cacheDir, selected string) (BinCache, error) {
+	switch selected {
+	case "", "protoc", "wasm":
+	case "go":
+		return compiler.NewCompiler(cacheDir), nil
+	default:
+		return nil, fmt.Errorf("invalid GO_PROTOC_COMPILER %q: expected protoc, go or wasm", selected)
+	}
+	cache := bincache.NewProtocBinCache(cacheDir)
+	cache.VersionResolver = timedVersionResolver{VersionResolver: cache.VersionResolver, timings: runTimings}
+	if urlResolver, ok := cache.URLResolver.(*releases.ProtocURLResolver); ok {
+		urlResolver.WasmURL = os.Getenv("GO_PROTOC_WASM_URL")
+	}
+	if archiveDownloader, ok := cache.ZipDownloader.(*downloader.ArchiveDownloader); ok {
+		archiveDownloader.Observer = runTimings
+	}
+	if keyPath := os.Getenv("GO_PROTOC_TRUSTED_KEY"); keyPath != "" {
+		verifier, err := signature.LoadVerifier(keyPath, os.Getenv("GO_PROTOC_SIGNATURES"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load trusted key: %w", err)
+		}
+		cache.Verifier = verifier
+	}
+	if selected == "wasm" {
+		wasmRuntime := wasm.NewRuntime(cacheDir)
+		wasmRuntime.ProtocBinCache = cache.ForPlatform(wasm.GOOS, wasm.GOARCH)
+		return wasmRuntime, nil
+	}
+	return cache, nil
 }
 
 func main() {
-	// Set up debug logging.
-	_, debugEnabled := os.LookupEnv("DEBUG")
-	if debugEnabled {
-		debug = log.Printf
+	// The WebAssembly runtime and the pure-Go compiler run protoc as
+	// go-protoc, through a link named protoc.
+	if wasm.IsLink(os.Args[0]) {
+		os.Exit(wasm.Main(os.Args[0], os.Args[1:]))
+	}
+	if compiler.IsProtoc(os.Args[0]) {
+		os.Exit(compiler.Main(os.Args[1:]))
+	}
+	var err error
+	logger, err = newLogger(os.Stderr, logLevel(), os.Getenv("GO_PROTOC_LOG_FORMAT"))
+	if err != nil {
+		log.Fatal(err)
 	}
 	// Create binary cache
 	cacheDir, err := os.UserCacheDir()
 	if err != nil {
 		log.Fatalf("failed to get user cache dir: %v", err)
 	}
-	debug("go-protoc cache dir: %s", cacheDir)
-	cache := bincache.NewProtocBinCache(cacheDir)
+	logger.Debug("cache", "dir", cacheDir)
+	cache, err := newCache(cacheDir, os.Getenv("GO_PROTOC_COMPILER"))
+	if err != nil {
+		log.Fatal(err)
+	}
 	dirFs := os.DirFS(".")
-	if err := runProtoc(cache, dirFs, os.Args[1:]...); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
+
+	args, format, err := parseDiagnosticsFormat(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	diagnosticsFormat = format
+	args, showTimings := ExtractFlag(args, "timings")
+	showTimings = showTimings || envBool("GO_PROTOC_TIMINGS")
+
+	err = run(cache, dirFs, args)
+	if showTimings {
+		runTimings.write(os.Stderr)
+	}
+	if err != nil {
+		// Both protoc binaries and modules exit with the code of protoc.
+		var exitError interface{ ExitCode() int }
+		if errors.As(err, &exitError) {
 			os.Exit(exitError.ExitCode())
 		}
+		// The pure-Go compiler printed its errors already.
+		if errors.Is(err, compiler.ErrFailed) {
+			os.Exit(1)
+		}
+		if errors.Is(err, ErrOutOfDate) || errors.Is(err, ErrBreakingChanges) ||
+			errors.Is(err, ErrNotFormatted) || errors.Is(err, ErrDoctorFailed) ||
+			errors.Is(err, ErrGenerateFailed) || errors.Is(err, ErrLintFailed) {
+			fmt.Fprintf(os.Stderr, "go-protoc: %v\n", err)
+			os.Exit(1)
+		}
 		log.Fatalf("Failed to run protoc: %v", err)
 	}
 }
+
+// run dispatches to the subcommand named by the first argument. Otherwise, it
+// runs protoc with the arguments after extracting the go-protoc options.
+func run(cache BinCache, dirFs fs.FS, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "breaking":
+			return runBreaking(cache, os.Stdout, args[1:]...)
+		case "cache":
+			return runCache(cache, os.Stdout, args[1:]...)
+		case "doctor":
+			return runDoctor(cache, os.Stdout, args[1:]...)
+		case "fmt":
+			return runFmt(dirFs, os.Stdout, args[1:]...)
+		case "generate":
+			return runGenerate(cache, os.Stdout, args[1:]...)
+		case "install":
+			return runInstall(cache, os.Stdout, args[1:]...)
+		case "lint":
+			return runLint(cache, os.Stdout, args[1:]...)
+		case "version":
+			return runVersion(cache, os.Stdout, args[1:]...)
+		case "watch":
+			return runWatch(cache, os.Stdout, args[1:]...)
+		}
+	}
+
+	opts, args := parseOptions(args)
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	key := manifestKey(args)
+	args, tag, err := resolveArgs(cache, wd, opts, args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.dryRun || opts.dryRunJSON:
+		return dryRunProtoc(cache, tag, wd, opts.dryRunJSON, os.Stdout, args...)
+	case opts.check:
+		return checkProtoc(cache, tag, wd, key, os.Stdout, args...)
+	case opts.clean || opts.cleanDryRun:
+		err = cleanProtoc(cache, tag, wd, key, opts.cleanDryRun, os.Stderr, args...)
+	case opts.outputCache != "":
+		var outputs *outcache.Cache
+		if outputs, err = openOutputCache(cache, opts.outputCache); err != nil {
+			return err
+		} else if outputs != nil {
+			err = cachedProtoc(cache, outputs, tag, wd, args...)
+		} else {
+			err = runProtoc(cache, tag, wd, args...)
+		}
+	default:
+		err = runProtoc(cache, tag, wd, args...)
+	}
+	if err == nil && opts.descriptorSetEmbed {
+		// The descriptor set flags given explicitly take precedence over
+		// opts.descriptorSet.
+		path, _ := descriptorSetOut(args)
+		err = writeDescriptorSetEmbed(path, os.Getenv("GOPACKAGE"))
+	}
+	return err
+}
+
+// resolveArgs completes the protoc arguments of a run in dir with the
+// descriptor set, proto dependency and Go module flags, and returns them with
+// the protoc release tag selected for the editions of the inputs.
+func resolveArgs(cache BinCache, dir string, opts options, args []string) ([]string, string, error) {
+	if opts.descriptorSet != "" {
+		args = descriptorSetArgs(args, opts.descriptorSet)
+	}
+	args, err := dependencyArgs(cache, dir, args)
+	if err != nil {
+		return nil, "", err
+	}
+	if args, err = goModuleArgs(cache, dir, args); err != nil {
+		return nil, "", err
+	}
+	tag, err := selectProtocTag(cache, dir, args)
+	if err != nil {
+		return nil, "", err
+	}
+	return args, tag, nil
+}
@@ -3,12 +3,31 @@ package main
 import (
 	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"github.com/esdandreu/go-protoc/pkg/compiler"
+	"github.com/esdandreu/go-protoc/pkg/deps"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"github.com/esdandreu/go-protoc/pkg/wasm"
 )
 
+func TestMain(m *testing.M) {
+	// Tests running go-protoc in a subprocess execute the test binary, which
+	// then behaves as go-protoc.
+	if os.Getenv("GO_PROTOC_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 // Mock BinCache implementation for testing
 type mockBinCache struct {
 	binPath   string
@@ -26,30 +45,11 @@ func (m *mockBinCache) BinPath(tag string) (string, error) {
 	return m.binPath, nil
 }
 
-// Helper to create a temporary mock binary for testing
-func createMockBinary(t testing.TB) string {
+// createMockBinary creates a mock protoc that prints its arguments, with the
+// behavior of the options added.
+func createMockBinary(t testing.TB, opts ...mockprotoc.Option) string {
 	t.Helper()
-
-	tempDir := t.TempDir()
-	binName := "mock-protoc"
-	if runtime.GOOS == "windows" {
-		binName += ".exe"
-	}
-	binPath := filepath.Join(tempDir, binName)
-
-	// Create a simple shell script/batch file that echoes its arguments
-	var content string
-	if runtime.GOOS == "windows" {
-		content = "@echo off\necho mock-protoc called with args: %*\n"
-	} else {
-		content = "#!/bin/sh\necho \"mock-protoc called with args: $@\"\n"
-	}
-
-	if err := os.WriteFile(binPath, []byte(content), 0755); err != nil {
-		t.Fatalf("Failed to create mock binary: %v", err)
-	}
-
-	return binPath
+	return mockprotoc.New(t, opts...)
 }
 
 func TestDefaultProtocTag(t *testing.T) {
@@ -62,7 +62,7 @@ func TestRunProtoc_Success(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: createMockBinary(t),
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Save and restore environment
 	originalTag := os.Getenv("PROTOC_RELEASE_TAG")
@@ -77,7 +77,7 @@ func TestRunProtoc_Success(t *testing.T) {
 	// Test with specific tag
 	os.Setenv("PROTOC_RELEASE_TAG", "v25.3")
 
-	err := runProtoc(cache, dirFs, "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--version")
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
@@ -95,7 +95,7 @@ func TestRunProtoc_DefaultTag(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: createMockBinary(t),
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Save and restore environment
 	originalTag, isSet := os.LookupEnv("PROTOC_RELEASE_TAG")
@@ -108,7 +108,7 @@ func TestRunProtoc_DefaultTag(t *testing.T) {
 	// Unset environment variable to test default
 	os.Unsetenv("PROTOC_RELEASE_TAG")
 
-	err := runProtoc(cache, dirFs, "--help")
+	err := runProtoc(cache, protocTag(cache), dir, "--help")
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
@@ -124,9 +124,9 @@ func TestRunProtoc_BinCacheError(t *testing.T) {
 	cache := &mockBinCache{
 		err: expectedErr,
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
-	err := runProtoc(cache, dirFs, "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--version")
 	if err == nil {
 		t.Fatal("Expected error from BinCache, got nil")
 	}
@@ -145,9 +145,9 @@ func TestRunProtoc_CommandExecutionError(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: "/non/existent/binary",
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
-	err := runProtoc(cache, dirFs, "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--version")
 	if err == nil {
 		t.Fatal("Expected error from command execution, got nil")
 	}
@@ -162,7 +162,7 @@ func TestRunProtoc_MultipleArguments(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: createMockBinary(t),
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Save and restore environment
 	originalTag := os.Getenv("PROTOC_RELEASE_TAG")
@@ -177,7 +177,7 @@ func TestRunProtoc_MultipleArguments(t *testing.T) {
 	os.Setenv("PROTOC_RELEASE_TAG", "v25.3")
 
 	// Test with multiple arguments
-	err := runProtoc(cache, dirFs, "--help", "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--help", "--version")
 	if err != nil {
 		t.Errorf("Expected no error with multiple args, got: %v", err)
 	}
@@ -187,10 +187,10 @@ func TestRunProtoc_NoArguments(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: createMockBinary(t),
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Test with no arguments
-	err := runProtoc(cache, dirFs)
+	err := runProtoc(cache, protocTag(cache), dir)
 	if err != nil {
 		t.Errorf("Expected no error with no args, got: %v", err)
 	}
@@ -198,7 +198,7 @@ func TestRunProtoc_NoArguments(t *testing.T) {
 
 func TestRunProtoc_EnvironmentVariableHandling(t *testing.T) {
 	binPath := createMockBinary(t)
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Save original environment
 	originalTag := os.Getenv("PROTOC_RELEASE_TAG")
@@ -234,10 +234,11 @@ func TestRunProtoc_EnvironmentVariableHandling(t *testing.T) {
 			expectedTag: "latest",
 		},
 		{
+			// See TestRunProtoc_EmptyReleaseTag.
 			name:        "Environment variable set to empty string",
 			envValue:    "",
 			setEnv:      true,
-			expectedTag: "",
+			expectedTag: DefaultProtocTag,
 		},
 	}
 
@@ -254,7 +255,7 @@ func TestRunProtoc_EnvironmentVariableHandling(t *testing.T) {
 				os.Unsetenv("PROTOC_RELEASE_TAG")
 			}
 
-			err := runProtoc(cache, dirFs, "--version")
+			err := runProtoc(cache, protocTag(cache), dir, "--version")
 			if err != nil {
 				t.Errorf("Expected no error for %s, got: %v", tc.name, err)
 			}
@@ -266,13 +267,29 @@ func TestRunProtoc_EnvironmentVariableHandling(t *testing.T) {
 	}
 }
 
+func TestRunProtoc_EmptyReleaseTag(t *testing.T) {
+	// An empty PROTOC_RELEASE_TAG selects the default release, as protoc.Run
+	// does for an empty version, rather than downloading a release with an
+	// empty version.
+	cache, downloader := newTestProtocBinCache(t)
+	mockprotoc.Write(t, cache.VersionBinPath("32.1"))
+	t.Setenv("PROTOC_RELEASE_TAG", "")
+
+	if err := runProtoc(cache, protocTag(cache), t.TempDir(), "--version"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(downloader.urls) != 0 {
+		t.Errorf("Expected the cached default release, got downloads: %v", downloader.urls)
+	}
+}
+
 func TestRunProtoc_BinCacheCalledOnce(t *testing.T) {
 	cache := &mockBinCache{
 		binPath: createMockBinary(t),
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
-	err := runProtoc(cache, dirFs, "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--version")
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
 	}
@@ -287,7 +304,7 @@ func TestRunProtoc_ErrorMessageFormat(t *testing.T) {
 	cache := &mockBinCache{
 		err: expectedErr,
 	}
-	dirFs := os.DirFS(t.TempDir())
+	dir := t.TempDir()
 
 	// Save and restore environment
 	originalTag := os.Getenv("PROTOC_RELEASE_TAG")
@@ -302,7 +319,7 @@ func TestRunProtoc_ErrorMessageFormat(t *testing.T) {
 	testTag := "v25.3"
 	os.Setenv("PROTOC_RELEASE_TAG", testTag)
 
-	err := runProtoc(cache, dirFs, "--version")
+	err := runProtoc(cache, protocTag(cache), dir, "--version")
 	if err == nil {
 		t.Fatal("Expected error, got nil")
 	}
@@ -317,3 +334,119 @@ func TestRunProtoc_ErrorMessageFormat(t *testing.T) {
 		t.Errorf("Expected error message to contain original error %q, got: %v", expectedErr.Error(), err)
 	}
 }
+
+func TestRelativeToWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	t.Setenv("GITHUB_WORKSPACE", workspace)
+	diagnostics := []protoc.Diagnostic{{File: "pet.proto"}, {Message: "no file"}}
+	relativeToWorkspace(filepath.Join(workspace, "api"), diagnostics)
+	if diagnostics[0].File != "api/pet.proto" {
+		t.Errorf("Expected path relative to the workspace, got %q", diagnostics[0].File)
+	}
+	if diagnostics[1].File != "" {
+		t.Errorf("Expected diagnostic without file to be unchanged, got %q", diagnostics[1].File)
+	}
+}
+
+func TestNewCache(t *testing.T) {
+	testCases := map[string]struct {
+		selected    string
+		expected    BinCache
+		expectedErr string
+	}{
+		"default": {expected: &bincache.ProtocBinCache{}},
+		"protoc":  {selected: "protoc", expected: &bincache.ProtocBinCache{}},
+		"go":      {selected: "go", expected: &compiler.Compiler{}},
+		"wasm":    {selected: "wasm", expected: &wasm.Runtime{}},
+		"invalid": {selected: "java", expectedErr: `invalid GO_PROTOC_COMPILER "java"`},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache, err := newCache(t.TempDir(), tc.selected)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if reflect.TypeOf(cache) != reflect.TypeOf(tc.expected) {
+				t.Errorf("Expected a %T, got %T", tc.expected, cache)
+			}
+		})
+	}
+}
+
+// buildMockModule compiles the mock protoc of the wasm package to WASI.
+func buildMockModule(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "protoc.wasm")
+	cmd := exec.Command("go", "build", "-o", path, "../../pkg/wasm/testdata/mockprotoc")
+	cmd.Env = append(os.Environ(), "GOOS="+wasm.GOOS, "GOARCH="+wasm.GOARCH)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build mock protoc module: %v\n%s", err, output)
+	}
+	return path
+}
+
+func TestRun_Backends(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock plugins require a POSIX shell")
+	}
+	module := buildMockModule(t)
+	// The default plugins generate nothing.
+	binDir := t.TempDir()
+	for _, name := range []string{"protoc-gen-go", "protoc-gen-go-grpc"} {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\ncat > /dev/null\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", binDir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+	testCases := map[string]struct {
+		compiler string
+		args     []string
+		expected string
+	}{
+		"go":   {compiler: "go", args: []string{"--descriptor_set_out=pet.binpb", "pet.proto"}, expected: "pet.binpb"},
+		"wasm": {compiler: "wasm", args: []string{"--cpp_out=.", "pet.proto"}, expected: "pet.pb.h"},
+	}
+	for name, tc := range testCases {
+		for _, outputCache := range []string{"false", "true"} {
+			t.Run(name+"/output-cache="+outputCache, func(t *testing.T) {
+				t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+				cache, err := newCache(t.TempDir(), tc.compiler)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r, ok := cache.(*wasm.Runtime); ok {
+					content, err := os.ReadFile(module)
+					if err != nil {
+						t.Fatal(err)
+					}
+					writeTestFiles(t, filepath.Dir(r.VersionBinPath("32.1")), map[string]string{"protoc.wasm": string(content)})
+				}
+				dir := t.TempDir()
+				// Configs without proto dependencies still need the cache
+				// directory of the backend.
+				writeTestFiles(t, dir, map[string]string{
+					"pet.proto":         "syntax = \"proto3\";\n",
+					deps.ConfigFileName: `{"lint": {"except": ["PACKAGE_DEFINED"]}}`,
+				})
+				// The mock module writes set.binpb as the descriptors of the
+				// inputs.
+				writeDescriptorSetFixture(t, filepath.Join(dir, "set.binpb"), "name")
+				t.Chdir(dir)
+
+				args := append([]string{"--output-cache=" + outputCache}, tc.args...)
+				if err := run(cache, os.DirFS(dir), args); err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(dir, tc.expected)); err != nil {
+					t.Errorf("Expected %s to be generated, got: %v", tc.expected, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// goPackagePattern matches the go_package option of proto files.
+var goPackagePattern = regexp.MustCompile(`(?m)^\s*option\s+go_package\s*=\s*"([^"]*)"\s*;`)
+
+// goPackages maps the inputs of a run in dir, and the files they import, that
+// have no go_package option to the import path of the package their Go code
+// is generated in, as found from the go.mod file of dir. The package
+// generated in dir itself is named $GOPACKAGE, as set by go generate. Files
+// with a go_package option that disagrees with the package their code is
+// generated in are warned about.
+//
+// The code is only known to be generated next to the protos with
+// paths=source_relative, which go-protoc uses by default. Otherwise, and
+// outside a Go module, no files are mapped.
+func goPackages(dir string, args []string) map[string]string {
+	goMod := findGoMod(dir)
+	if goMod == "" || !sourceRelative(args) {
+		return nil
+	}
+	content, err := os.ReadFile(goMod)
+	if err != nil {
+		return nil
+	}
+	modulePath := modfile.ModulePath(content)
+	if modulePath == "" {
+		return nil
+	}
+	inputs, err := protoInputs(dir, args)
+	if err != nil {
+		return nil
+	}
+	outDir := goOutDir(args)
+	if !filepath.IsAbs(outDir) {
+		outDir = filepath.Join(dir, outDir)
+	}
+
+	moduleDir := filepath.Dir(goMod)
+	packages := map[string]string{}
+	graph := readImportGraph(dir, inputs, args)
+	for file, name := range graph.names {
+		// Files of other modules, such as proto dependencies, are left to
+		// protoc-gen-go.
+		if !inDir(moduleDir, file) {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		generatedDir := filepath.Join(outDir, filepath.FromSlash(path.Dir(name)))
+		rel, err := filepath.Rel(moduleDir, generatedDir)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		importPath := path.Join(modulePath, filepath.ToSlash(rel))
+		packageName := os.Getenv("GOPACKAGE")
+		if generatedDir != filepath.Clean(dir) {
+			packageName = ""
+		}
+
+		match := goPackagePattern.FindSubmatch(content)
+		if match == nil {
+			packages[name] = importPath
+			if packageName != "" {
+				packages[name] += ";" + packageName
+			}
+			continue
+		}
+		goPackage := string(match[1])
+		explicitPath, explicitName, ok := strings.Cut(goPackage, ";")
+		if !ok {
+			explicitName = path.Base(explicitPath)
+		}
+		switch {
+		case explicitPath != importPath:
+			warn("%s: go_package %q does not match the directory the code is generated in, %s", name, goPackage, importPath)
+		case packageName != "" && explicitName != packageName:
+			warn("%s: go_package %q does not match the package the code is generated in, %s", name, goPackage, packageName)
+		}
+	}
+	return packages
+}
+
+// inDir reports whether path is in dir or its subdirectories.
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// sourceRelative reports whether args generate the Go code next to the
+// protos, with the paths=source_relative option go-protoc gives by default.
+func sourceRelative(args []string) bool {
+	var options []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--go_opt="); ok {
+			options = append(options, strings.Split(value, ",")...)
+		}
+		if value, ok := strings.CutPrefix(arg, "--go_out="); ok {
+			if parameters, _, ok := strings.Cut(value, ":"); ok && !filepath.IsAbs(value) {
+				options = append(options, strings.Split(parameters, ",")...)
+			}
+		}
+	}
+	if len(options) == 0 {
+		return true
+	}
+	for _, option := range options {
+		if option == "paths=source_relative" {
+			return true
+		}
+	}
+	return false
+}
+
+// goOutDir returns the output directory of the go plugin given in args,
+// which is the current directory by default.
+func goOutDir(args []string) string {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--go_out="); ok {
+			if _, out, ok := strings.Cut(value, ":"); ok && !filepath.IsAbs(value) {
+				return out
+			}
+			return value
+		}
+	}
+	return "."
+}
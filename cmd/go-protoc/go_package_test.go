@@ -0,0 +1,93 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGoPackages(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"go.mod": "module example.com/pets\n",
+		"api/pet.proto": `syntax = "proto3";
+import "v1/kind.proto";
+import "v1/owner.proto";
+import "google/protobuf/timestamp.proto";
+`,
+		"api/v1/kind.proto":  "syntax = \"proto3\";\n",
+		"api/v1/owner.proto": "syntax = \"proto3\";\noption go_package = \"example.com/pets/api/v1;ownerpb\";\n",
+		"api/store.proto":    "syntax = \"proto3\";\noption go_package = \"example.com/pets/api;storepb\";\n",
+		"api/v2/shop.proto":  "syntax = \"proto3\";\noption go_package = \"example.com/shop\";\n",
+	})
+	dir := filepath.Join(root, "api")
+
+	testCases := map[string]struct {
+		args      []string
+		goPackage string
+		expected  map[string]string
+		warnings  []string
+	}{
+		"defaults": {
+			expected: map[string]string{
+				"pet.proto":     "example.com/pets/api",
+				"v1/kind.proto": "example.com/pets/api/v1",
+			},
+			warnings: []string{`v2/shop.proto: go_package "example.com/shop" does not match the directory the code is generated in, example.com/pets/api/v2`},
+		},
+		"go generate package": {
+			args:      []string{"pet.proto"},
+			goPackage: "petapi",
+			expected: map[string]string{
+				"pet.proto":     "example.com/pets/api;petapi",
+				"v1/kind.proto": "example.com/pets/api/v1",
+			},
+		},
+		"go generate package mismatch": {
+			args:      []string{"store.proto"},
+			goPackage: "petapi",
+			expected:  map[string]string{},
+			warnings:  []string{`store.proto: go_package "example.com/pets/api;storepb" does not match the package the code is generated in, petapi`},
+		},
+		"package of another directory": {
+			args:      []string{"v1/owner.proto"},
+			goPackage: "petapi",
+			expected:  map[string]string{},
+		},
+		"output directory": {
+			args:     []string{"--go_out=gen", "--go_opt=paths=source_relative", "v1/kind.proto"},
+			expected: map[string]string{"v1/kind.proto": "example.com/pets/api/gen/v1"},
+		},
+		"import paths": {
+			args: []string{"--go_opt=paths=import", "pet.proto"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GOPACKAGE", tc.goPackage)
+			warnings := captureWarnings(t)
+
+			packages := goPackages(dir, tc.args)
+			if !reflect.DeepEqual(packages, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, packages)
+			}
+			for _, warning := range tc.warnings {
+				if !slices.Contains(warnings(), warning) {
+					t.Errorf("Expected warning %q, got %q", warning, warnings())
+				}
+			}
+			if len(tc.warnings) == 0 && len(warnings()) > 0 {
+				t.Errorf("Expected no warnings, got %q", warnings())
+			}
+		})
+	}
+}
+
+func TestGoPackages_OutsideModule(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\n"})
+	if packages := goPackages(dir, nil); packages != nil {
+		t.Errorf("Expected no packages outside a module, got %v", packages)
+	}
+}
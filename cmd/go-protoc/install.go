@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+// platformCache is implemented by caches that can hold the protoc releases of
+// other platforms, such as bincache.ProtocBinCache.
+type platformCache interface {
+	ForPlatform(goos, goarch string) *bincache.ProtocBinCache
+}
+
+// platform is an operating system and architecture pair, as in GOOS/GOARCH.
+type platform struct {
+	goos, goarch string
+}
+
+func (p platform) String() string {
+	return p.goos + "/" + p.goarch
+}
+
+// parsePlatforms parses a comma-separated list of GOOS/GOARCH pairs.
+func parsePlatforms(list string) ([]platform, error) {
+	var platforms []platform
+	for _, item := range strings.Split(list, ",") {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(item), "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid platform %q, expected GOOS/GOARCH such as linux/amd64", item)
+		}
+		platforms = append(platforms, platform{goos: goos, goarch: goarch})
+	}
+	return platforms, nil
+}
+
+// runInstall implements `go-protoc install [--version tag] [--platform
+// os/arch,...]`, which downloads protoc into the cache ahead of time. The
+// version defaults to PROTOC_RELEASE_TAG and the platform to the current one.
+func runInstall(cache BinCache, w io.Writer, args ...string) error {
+	args, tag, ok := ExtractFlagValue(args, "version")
+	if !ok || tag == "" {
+		tag = protocTag(cache)
+	}
+	args, platformList, ok := ExtractFlagValue(args, "platform")
+	if len(args) > 0 {
+		return fmt.Errorf("install: unexpected arguments %v", args)
+	}
+	platforms := []platform{{goos: runtime.GOOS, goarch: runtime.GOARCH}}
+	if ok {
+		var err error
+		if platforms, err = parsePlatforms(platformList); err != nil {
+			return err
+		}
+	}
+
+	// Resolve the tag once, so that every platform gets the same release.
+	if resolver, ok := cache.(versionCache); ok {
+		version, err := resolver.ResolveVersion(tag)
+		if err != nil {
+			return fmt.Errorf("failed to resolve protoc version %s: %w", tag, err)
+		}
+		tag = version
+	}
+	for _, p := range platforms {
+		platformBinCache := cache
+		if pc, ok := cache.(platformCache); ok {
+			platformBinCache = pc.ForPlatform(p.goos, p.goarch)
+		} else if p.goos != runtime.GOOS || p.goarch != runtime.GOARCH {
+			return fmt.Errorf("cache does not support installing protoc for %s", p)
+		}
+		binPath, err := platformBinCache.BinPath(tag)
+		if err != nil {
+			return fmt.Errorf("failed to install protoc %s for %s: %w", tag, p, err)
+		}
+		fmt.Fprintf(w, "installed protoc %s for %s at %s\n", tag, p, binPath)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+type mockVersionResolver struct{}
+
+func (mockVersionResolver) ResolveVersion(tag string) (string, error) {
+	if tag == "latest" {
+		return "32.1", nil
+	}
+	return strings.TrimPrefix(tag, "v"), nil
+}
+
+type mockURLResolver struct{}
+
+func (mockURLResolver) ResolveURL(version, goos, goarch string) (*url.URL, error) {
+	return &url.URL{Scheme: "https", Host: "example.com", Path: "/" + version + "/" + goos + "-" + goarch + ".zip"}, nil
+}
+
+// mockZipDownloader extracts a fake protoc binary, named after the platform
+// in the URL, and records the URLs downloaded.
+type mockZipDownloader struct {
+	urls []string
+}
+
+func (m *mockZipDownloader) DownloadAndExtract(url string, destDir string) error {
+	m.urls = append(m.urls, url)
+	binName := "protoc"
+	if strings.Contains(url, "windows-") {
+		binName += ".exe"
+	}
+	if err := os.MkdirAll(filepath.Join(destDir, "bin"), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(destDir, "bin", binName), []byte(url), 0755)
+}
+
+func newTestProtocBinCache(t *testing.T) (*bincache.ProtocBinCache, *mockZipDownloader) {
+	t.Helper()
+	downloader := &mockZipDownloader{}
+	cache := bincache.NewProtocBinCache(t.TempDir())
+	cache.VersionResolver = mockVersionResolver{}
+	cache.URLResolver = mockURLResolver{}
+	cache.ZipDownloader = downloader
+	cache.Checker = nil
+	return cache, downloader
+}
+
+func TestRunInstall(t *testing.T) {
+	cache, downloader := newTestProtocBinCache(t)
+	t.Setenv("PROTOC_RELEASE_TAG", "latest")
+
+	var out bytes.Buffer
+	err := runInstall(cache, &out, "--platform", "linux/amd64,windows/arm64,"+runtime.GOOS+"/"+runtime.GOARCH)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []string{
+		cache.ForPlatform("linux", "amd64").VersionBinPath("32.1"),
+		cache.ForPlatform("windows", "arm64").VersionBinPath("32.1"),
+		cache.VersionBinPath("32.1"),
+	}
+	for _, binPath := range expected {
+		if _, err := os.Stat(binPath); err != nil {
+			t.Errorf("Expected protoc at %s, got: %v", binPath, err)
+		}
+	}
+	if !strings.Contains(out.String(), "installed protoc 32.1 for windows/arm64 at "+expected[1]+"\n") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	// Installing again uses the cache.
+	downloads := len(downloader.urls)
+	if err := runInstall(cache, &out, "--version", "v32.1", "--platform=linux/amd64"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(downloader.urls) != downloads {
+		t.Errorf("Expected no download, got %v", downloader.urls[downloads:])
+	}
+}
+
+func TestRunInstall_Errors(t *testing.T) {
+	cache, _ := newTestProtocBinCache(t)
+	testCases := map[string]struct {
+		cache    BinCache
+		args     []string
+		expected string
+	}{
+		"invalid platform": {
+			cache:    cache,
+			args:     []string{"--platform", "linux"},
+			expected: `invalid platform "linux"`,
+		},
+		"unexpected argument": {
+			cache:    cache,
+			args:     []string{"v32.1"},
+			expected: "unexpected arguments",
+		},
+		"unsupported cache": {
+			cache:    &mockBinCache{},
+			args:     []string{"--platform", "plan9/386"},
+			expected: "cache does not support installing protoc for plan9/386",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := runInstall(tc.cache, &bytes.Buffer{}, tc.args...)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
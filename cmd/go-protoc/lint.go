@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/esdandreu/go-protoc/pkg/deps"
+	"github.com/esdandreu/go-protoc/pkg/lint"
+)
+
+// ErrLintFailed is returned by the lint subcommand when the protos do not
+// follow the lint rules.
+var ErrLintFailed = errors.New("lint violations found")
+
+// runLint implements `go-protoc lint`. The protos are compiled with the
+// cached protoc and checked against the rules selected by the lint section of
+// the go-protoc.json file of the working directory or its parents. Arguments
+// are forwarded to protoc, e.g. include paths or the proto files to lint.
+// Imports are compiled but not linted.
+func runLint(cache BinCache, w io.Writer, args ...string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	config := &lint.Config{}
+	if configPath := deps.FindConfig(wd); configPath != "" {
+		if config, err = lint.ReadConfig(configPath); err != nil {
+			return fmt.Errorf("failed to read lint config: %w", err)
+		}
+	}
+
+	set, err := compileDescriptorSet(cache, ".", args, false)
+	if err != nil {
+		return fmt.Errorf("failed to compile protos: %w", err)
+	}
+	violations, err := lint.Lint(set, *config)
+	if err != nil {
+		return err
+	}
+	for _, violation := range violations {
+		fmt.Fprintln(w, violation)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %d", ErrLintFailed, len(violations))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"github.com/esdandreu/go-protoc/pkg/deps"
+)
+
+func TestRunLint(t *testing.T) {
+	// Imports are not linted, so they are left out of the descriptor set.
+	cache := &mockBinCache{binPath: createMockBinary(t,
+		mockprotoc.CopiesDescriptorSet("fixture.binpb"),
+		mockprotoc.OnArg("--include_imports", "exit 1"),
+	)}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{"pet.proto": ""})
+	writeDescriptorSetFixture(t, filepath.Join(dir, "fixture.binpb"), "id", "petName")
+
+	var out bytes.Buffer
+	err := runLint(cache, &out)
+	if !errors.Is(err, ErrLintFailed) {
+		t.Fatalf("Expected ErrLintFailed, got: %v", err)
+	}
+	for _, expected := range []string{
+		`pet.proto: field name "petName" is not lower_snake_case (FIELD_LOWER_SNAKE_CASE)`,
+		`pet.proto: file has no go_package option (GO_PACKAGE_DEFINED)`,
+		`pet.proto: message "Pet" has no comment (COMMENT_MESSAGE)`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in output, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunLint_Config(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockBinary(t, mockprotoc.CopiesDescriptorSet("fixture.binpb"))}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":    "module example.com/pets\n",
+		"pet.proto": "",
+		"go-protoc.json": `{"lint": {
+			"except": ["COMMENT_MESSAGE", "GO_PACKAGE_DEFINED"],
+			"ignore": {"PACKAGE_DIRECTORY_MATCH": ["pet.proto"]}
+		}}`,
+	})
+	writeDescriptorSetFixture(t, filepath.Join(dir, "fixture.binpb"), "id", "name")
+
+	var out bytes.Buffer
+	if err := runLint(cache, &out); err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, out.String())
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no violations, got:\n%s", out.String())
+	}
+
+	writeTestFiles(t, dir, map[string]string{"go-protoc.json": `{"lint": {"except": ["NO_SUCH_RULE"]}}`})
+	if err := runLint(cache, &out); err == nil || errors.Is(err, ErrLintFailed) {
+		t.Errorf("Expected an unknown rule error, got: %v", err)
+	}
+}
+
+func TestRunLint_Dependencies(t *testing.T) {
+	// The proto dependencies are added to the include paths, as they are
+	// when generating code.
+	cache, _ := newTestProtocBinCache(t)
+	t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+	mockprotoc.Write(t, cache.VersionBinPath("32.1"),
+		mockprotoc.CopiesDescriptorSet("fixture.binpb"),
+		mockprotoc.OnArg("-I*", `echo "$arg" >> includes.txt`),
+	)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeTestFiles(t, dir, map[string]string{
+		"pet.proto": "",
+		deps.ConfigFileName: `{
+			"deps": [{"name": "googleapis", "module": "github.com/googleapis/googleapis@main"}],
+			"lint": {"except": ["COMMENT_MESSAGE", "GO_PACKAGE_DEFINED", "PACKAGE_DIRECTORY_MATCH"]}
+		}`,
+	})
+	writeDescriptorSetFixture(t, filepath.Join(dir, "fixture.binpb"), "id", "name")
+	fetcher := deps.NewFetcher(cache.Dir())
+	fetcher.ZipDownloader = mockDepsDownloader{}
+	config, err := deps.ReadConfig(filepath.Join(dir, deps.ConfigFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	includeDir, _, err := fetcher.Fetch(config.Deps[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runLint(cache, &out); err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, out.String())
+	}
+	includes, err := os.ReadFile(filepath.Join(dir, "includes.txt"))
+	if err != nil {
+		t.Fatalf("Expected include paths, got: %v", err)
+	}
+	if !strings.Contains(string(includes), "-I"+includeDir+"\n") {
+		t.Errorf("Expected -I%s, got:\n%s", includeDir, includes)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// logger logs what go-protoc does, at the level set by GO_PROTOC_LOG_LEVEL.
+// Only warnings are logged by default.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+// warn logs a warning.
+func warn(format string, args ...any) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+
+// logLevel returns the log level set by GO_PROTOC_LOG_LEVEL. When it is not
+// set, DEBUG, which enabled debug logging in earlier releases, is still
+// honored with a warning.
+func logLevel() string {
+	if level, ok := os.LookupEnv("GO_PROTOC_LOG_LEVEL"); ok {
+		return level
+	}
+	if _, ok := os.LookupEnv("DEBUG"); ok {
+		warn("DEBUG is deprecated, set GO_PROTOC_LOG_LEVEL=debug instead")
+		return "debug"
+	}
+	return ""
+}
+
+// newLogger returns a logger writing the records of at least level, such as
+// "debug" or "warn", to w in format, which is either "text" (the default) or
+// "json". An empty level selects "warn".
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	minLevel := slog.LevelWarn
+	if level != "" {
+		if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid GO_PROTOC_LOG_LEVEL %q: expected debug, info, warn or error", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid GO_PROTOC_LOG_FORMAT %q: expected text or json", format)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// captureWarnings logs the warnings of go-protoc for the rest of the test,
+// and returns a function listing their messages.
+func captureWarnings(t *testing.T) func() []string {
+	t.Helper()
+	var out bytes.Buffer
+	previous := logger
+	logger = slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	t.Cleanup(func() { logger = previous })
+	return func() []string {
+		var messages []string
+		for line := range strings.Lines(out.String()) {
+			var record struct{ Msg string }
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("Expected a JSON record, got: %v\n%s", err, line)
+			}
+			messages = append(messages, record.Msg)
+		}
+		return messages
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	testCases := map[string]struct {
+		level       string
+		format      string
+		expected    []string
+		expectedErr string
+	}{
+		"default": {expected: []string{"level=WARN msg=warn"}},
+		"debug":   {level: "debug", expected: []string{"level=DEBUG msg=debug", "level=WARN msg=warn"}},
+		"warn":    {level: "WARN", expected: []string{"level=WARN msg=warn"}},
+		"invalid level": {
+			level:       "verbose",
+			expectedErr: `invalid GO_PROTOC_LOG_LEVEL "verbose"`,
+		},
+		"invalid format": {
+			level:       "info",
+			format:      "yaml",
+			expectedErr: `invalid GO_PROTOC_LOG_FORMAT "yaml"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			l, err := newLogger(&out, tc.level, tc.format)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			l.Debug("debug")
+			l.Warn("warn")
+			lines := strings.FieldsFunc(out.String(), func(r rune) bool { return r == '\n' })
+			if len(lines) != len(tc.expected) {
+				t.Fatalf("Expected %d records, got:\n%s", len(tc.expected), out.String())
+			}
+			for i, expected := range tc.expected {
+				if !strings.Contains(lines[i], expected) {
+					t.Errorf("Expected record %q, got %q", expected, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	testCases := map[string]struct {
+		env      map[string]string
+		expected string
+		warning  bool
+	}{
+		"unset":           {},
+		"level":           {env: map[string]string{"GO_PROTOC_LOG_LEVEL": "info"}, expected: "info"},
+		"debug alias":     {env: map[string]string{"DEBUG": ""}, expected: "debug", warning: true},
+		"level and debug": {env: map[string]string{"GO_PROTOC_LOG_LEVEL": "warn", "DEBUG": "1"}, expected: "warn"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"GO_PROTOC_LOG_LEVEL", "DEBUG"} {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			warnings := captureWarnings(t)
+
+			if level := logLevel(); level != tc.expected {
+				t.Errorf("Expected level %q, got %q", tc.expected, level)
+			}
+			if hasWarning := slices.ContainsFunc(warnings(), func(warning string) bool {
+				return strings.Contains(warning, "DEBUG is deprecated")
+			}); hasWarning != tc.warning {
+				t.Errorf("Expected warning %v, got %q", tc.warning, warnings())
+			}
+		})
+	}
+}
+
+func TestNewLogger_JSON(t *testing.T) {
+	var out bytes.Buffer
+	l, err := newLogger(&out, "info", "json")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	l.Info("downloaded", "bytes", 42)
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got: %v\n%s", err, out.String())
+	}
+	if record["msg"] != "downloaded" || record["bytes"] != float64(42) {
+		t.Errorf("Unexpected record %v", record)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+)
+
+// options are the go-protoc specific settings. Each can be given either as a
+// flag, which is removed before forwarding the arguments to protoc, or as an
+// environment variable, which is convenient in //go:generate directives and
+// CI.
+type options struct {
+	// check generates into a temporary directory and reports differences
+	// with the checked-in files instead of writing them.
+	check bool
+	// clean removes stale generated files tracked in the manifest, and
+	// cleanDryRun only reports them.
+	clean, cleanDryRun bool
+	// descriptorSet is the path where the FileDescriptorSet of the inputs is
+	// written, if any.
+	descriptorSet string
+	// descriptorSetEmbed generates a Go file embedding descriptorSet, which
+	// defaults to DefaultDescriptorSetPath.
+	descriptorSetEmbed bool
+	// dryRun prints the protoc command instead of running it, as JSON with
+	// dryRunJSON.
+	dryRun, dryRunJSON bool
+	// outputCache is the location of the cache of generated files, see
+	// openOutputCache, if any.
+	outputCache string
+}
+
+// parseOptions extracts the go-protoc options from args and the environment.
+// It returns the options and the arguments to forward to protoc.
+func parseOptions(args []string) (options, []string) {
+	var opts options
+	args, opts.check = ExtractFlag(args, "check")
+	opts.check = opts.check || envBool("GO_PROTOC_CHECK")
+
+	args, opts.clean = ExtractFlag(args, "clean")
+	args, opts.cleanDryRun = ExtractFlag(args, "clean-dry-run")
+	switch cleanEnv := os.Getenv("GO_PROTOC_CLEAN"); {
+	case cleanEnv == "dry-run":
+		opts.cleanDryRun = true
+	case envBool("GO_PROTOC_CLEAN"):
+		opts.clean = true
+	}
+
+	args, opts.descriptorSet, _ = ExtractFlagValue(args, "descriptor-set")
+	if opts.descriptorSet == "" {
+		opts.descriptorSet = os.Getenv("GO_PROTOC_DESCRIPTOR_SET")
+	}
+	args, opts.descriptorSetEmbed = ExtractFlag(args, "descriptor-set-embed")
+	opts.descriptorSetEmbed = opts.descriptorSetEmbed || envBool("GO_PROTOC_DESCRIPTOR_SET_EMBED")
+	if opts.descriptorSetEmbed && opts.descriptorSet == "" {
+		opts.descriptorSet = DefaultDescriptorSetPath
+	}
+
+	args, opts.dryRun = ExtractFlag(args, "dry-run")
+	args, opts.dryRunJSON = ExtractFlag(args, "dry-run-json")
+	switch dryRunEnv := os.Getenv("GO_PROTOC_DRY_RUN"); {
+	case dryRunEnv == "json":
+		opts.dryRunJSON = true
+	case envBool("GO_PROTOC_DRY_RUN"):
+		opts.dryRun = true
+	}
+
+	args, opts.outputCache, _ = ExtractFlagValue(args, "output-cache")
+	if opts.outputCache == "" {
+		opts.outputCache = os.Getenv("GO_PROTOC_OUTPUT_CACHE")
+	}
+
+	return opts, args
+}
+
+// parseDiagnosticsFormat extracts the --format flag from args. It defaults to
+// GO_PROTOC_FORMAT, and to GitHub Actions annotations when running in GitHub
+// Actions.
+func parseDiagnosticsFormat(args []string) ([]string, protoc.Format, error) {
+	args, name, _ := ExtractFlagValue(args, "format")
+	if name == "" {
+		name = os.Getenv("GO_PROTOC_FORMAT")
+	}
+	if name == "" {
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			return args, protoc.FormatGitHub, nil
+		}
+		return args, protoc.FormatText, nil
+	}
+	format, err := protoc.ParseFormat(name)
+	return args, format, err
+}
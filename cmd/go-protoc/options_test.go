@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+)
+
+func TestParseOptions(t *testing.T) {
+	testCases := map[string]struct {
+		args     []string
+		env      map[string]string
+		expected options
+		rest     []string
+	}{
+		"none": {
+			args: []string{"--go_out=.", "x.proto"},
+			rest: []string{"--go_out=.", "x.proto"},
+		},
+		"flags": {
+			args:     []string{"--check", "--clean", "--descriptor-set", "set.binpb", "x.proto"},
+			expected: options{check: true, clean: true, descriptorSet: "set.binpb"},
+			rest:     []string{"x.proto"},
+		},
+		"environment": {
+			env: map[string]string{
+				"GO_PROTOC_CHECK":                "1",
+				"GO_PROTOC_CLEAN":                "dry-run",
+				"GO_PROTOC_DESCRIPTOR_SET_EMBED": "true",
+			},
+			expected: options{check: true, cleanDryRun: true, descriptorSet: DefaultDescriptorSetPath, descriptorSetEmbed: true},
+		},
+		"dry run": {
+			args:     []string{"--dry-run", "x.proto"},
+			expected: options{dryRun: true},
+			rest:     []string{"x.proto"},
+		},
+		"dry run json": {
+			env:      map[string]string{"GO_PROTOC_DRY_RUN": "json"},
+			expected: options{dryRunJSON: true},
+		},
+		"output cache": {
+			args:     []string{"x.proto", "--output-cache", "s3://bucket/outputs"},
+			expected: options{outputCache: "s3://bucket/outputs"},
+			rest:     []string{"x.proto"},
+		},
+		"output cache environment": {
+			env:      map[string]string{"GO_PROTOC_OUTPUT_CACHE": "true"},
+			expected: options{outputCache: "true"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"GO_PROTOC_CHECK", "GO_PROTOC_CLEAN", "GO_PROTOC_DESCRIPTOR_SET", "GO_PROTOC_DESCRIPTOR_SET_EMBED", "GO_PROTOC_DRY_RUN", "GO_PROTOC_OUTPUT_CACHE"} {
+				t.Setenv(key, tc.env[key])
+			}
+			opts, rest := parseOptions(tc.args)
+			if !reflect.DeepEqual(opts, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, opts)
+			}
+			if !reflect.DeepEqual(rest, tc.rest) {
+				t.Errorf("Expected %v, got %v", tc.rest, rest)
+			}
+		})
+	}
+}
+
+func TestParseDiagnosticsFormat(t *testing.T) {
+	testCases := map[string]struct {
+		args     []string
+		env      map[string]string
+		expected protoc.Format
+	}{
+		"default":        {expected: protoc.FormatText},
+		"flag":           {args: []string{"--format=json"}, expected: protoc.FormatJSON},
+		"environment":    {env: map[string]string{"GO_PROTOC_FORMAT": "sarif"}, expected: protoc.FormatSARIF},
+		"github actions": {env: map[string]string{"GITHUB_ACTIONS": "true"}, expected: protoc.FormatGitHub},
+		"flag overrides github actions": {
+			args:     []string{"--format", "text"},
+			env:      map[string]string{"GITHUB_ACTIONS": "true"},
+			expected: protoc.FormatText,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"GO_PROTOC_FORMAT", "GITHUB_ACTIONS"} {
+				t.Setenv(key, tc.env[key])
+			}
+			rest, format, err := parseDiagnosticsFormat(append(tc.args, "x.proto"))
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if format != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, format)
+			}
+			if !reflect.DeepEqual(rest, []string{"x.proto"}) {
+				t.Errorf("Expected format flag to be removed, got %v", rest)
+			}
+		})
+	}
+
+	if _, _, err := parseDiagnosticsFormat([]string{"--format=xml"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
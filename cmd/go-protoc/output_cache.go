@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/compiler"
+	"github.com/esdandreu/go-protoc/pkg/outcache"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+)
+
+// builtinGenerators are the protoc output flags, without the "_out" suffix,
+// that do not run a plugin.
+var builtinGenerators = []string{
+	"cpp", "csharp", "descriptor_set", "dependency", "java", "kotlin",
+	"objc", "php", "pyi", "python", "ruby", "rust",
+}
+
+// openOutputCache opens the output cache at location, which is a directory,
+// an http(s) URL or an s3:// URL, see outcache.Open. A true value selects the
+// local output cache in the directory of the protoc cache, which also keeps
+// copies of the entries of remote caches. A false value disables the cache,
+// returning nil.
+func openOutputCache(cache BinCache, location string) (*outcache.Cache, error) {
+	var local outcache.Backend
+	if cd, ok := cache.(cacheDirer); ok {
+		local = &outcache.DirBackend{Dir: filepath.Join(cd.Dir(), outcache.CacheDir)}
+	}
+	if enabled, err := strconv.ParseBool(location); err == nil {
+		if !enabled {
+			return nil, nil
+		}
+		if local == nil {
+			return nil, fmt.Errorf("cache does not support a local output cache")
+		}
+		return outcache.New(local), nil
+	}
+
+	backend, err := outcache.Open(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output cache: %w", err)
+	}
+	switch b := backend.(type) {
+	case *outcache.DirBackend:
+		return outcache.New(b), nil
+	case *outcache.HTTPBackend:
+		if token := os.Getenv("GO_PROTOC_OUTPUT_CACHE_TOKEN"); token != "" {
+			b.Header = http.Header{"Authorization": {"Bearer " + token}}
+		}
+	}
+	if local != nil {
+		backend = outcache.Tiered{Local: local, Remote: backend}
+	}
+	return outcache.New(backend), nil
+}
+
+// cachedProtoc runs protoc like runProtoc does in dir, unless the output
+// cache has the files generated by a run with the same key, in which case
+// they are written to dir instead, without downloading or running protoc.
+// Otherwise, the generated files are stored in the cache. Failing to use the
+// cache is only logged, as protoc can always run instead. The tag is resolved
+// once, as resolving latest asks GitHub for the latest release. Runs writing
+// to absolute output paths, outside of dir, are not cached.
+func cachedProtoc(cache BinCache, outputs *outcache.Cache, tag, dir string, args ...string) error {
+	if vc, ok := cache.(versionCache); ok {
+		if version, err := vc.ResolveVersion(tag); err == nil {
+			tag = version
+		}
+	}
+	opts := protocOptions(cache, tag, dir, args)
+	command, err := opts.Command()
+	if err != nil {
+		return err
+	}
+	key := outputKey(dir, backendVersion(cache, opts.Version), command).Hash()
+
+	restoreDir, err := os.MkdirTemp("", "go-protoc-outputs-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(restoreDir)
+	found, err := outputs.Restore(key, restoreDir)
+	if err != nil {
+		logger.Warn("failed to restore outputs", "key", key, "error", err)
+	}
+	generatedDir := restoreDir
+	if found {
+		logger.Info("output cache hit", "key", key)
+	} else {
+		logger.Info("output cache miss", "key", key)
+		if generatedDir, err = os.MkdirTemp("", "go-protoc-*"); err != nil {
+			return fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer os.RemoveAll(generatedDir)
+		opts.OutputDir = generatedDir
+		if _, err := runProtocWith(opts); errors.Is(err, protoc.ErrAbsoluteOutput) {
+			logger.Info("output cache skipped", "key", key, "reason", err)
+			opts.OutputDir = ""
+			_, err = runProtocWith(opts)
+			return err
+		} else if err != nil {
+			return err
+		}
+		if err := outputs.Store(key, generatedDir); err != nil {
+			logger.Warn("failed to store outputs", "key", key, "error", err)
+		}
+	}
+	if _, err := protoc.InstallFiles(generatedDir, dir); err != nil {
+		return fmt.Errorf("failed to write generated files: %w", err)
+	}
+	return nil
+}
+
+// backendVersion returns the version the outputs of cache depend on: the
+// version of the compiler for a compiler.Compiler, which does not run protoc,
+// or the protoc version otherwise.
+func backendVersion(cache BinCache, version string) string {
+	if _, ok := cache.(*compiler.Compiler); ok {
+		return compiler.Version
+	}
+	return version
+}
+
+// outputKey returns the key of the outputs of running protoc version with
+// args in dir. It leaves out what only depends on the machine, so that
+// machines sharing a remote cache share entries: include paths outside dir,
+// whose files are identified by their content instead, and plugin paths,
+// whose plugins are identified by their version.
+func outputKey(dir, version string, args []string) outcache.Key {
+	key := outcache.Key{Protoc: version, Plugins: map[string]string{}, Files: map[string]string{}}
+
+	plugins := map[string]string{}
+	var inputs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := extractFlagName(arg)
+		switch {
+		case arg == "--":
+			key.Args = append(key.Args, args[i:]...)
+			i = len(args)
+			continue
+		case protoc.IsInput(arg):
+			inputs = append(inputs, arg)
+		case name == "plugin":
+			// --plugin=protoc-gen-NAME=PATH
+			value := strings.TrimPrefix(arg, "--plugin=")
+			if plugin, path, ok := strings.Cut(value, "="); ok {
+				plugins[plugin] = path
+			}
+			continue
+		case arg == "-I" || arg == "--proto_path":
+			if i+1 < len(args) && filepath.IsAbs(args[i+1]) {
+				i++
+				continue
+			}
+		case strings.HasPrefix(arg, "--proto_path="), strings.HasPrefix(arg, "-I"):
+			include := strings.TrimPrefix(strings.TrimPrefix(arg, "--proto_path="), "-I")
+			if filepath.IsAbs(include) {
+				continue
+			}
+		case strings.HasPrefix(arg, "-") && strings.HasSuffix(name, "_out"):
+			generator := strings.TrimSuffix(name, "_out")
+			if _, ok := plugins["protoc-gen-"+generator]; !ok && !slices.Contains(builtinGenerators, generator) {
+				plugins["protoc-gen-"+generator] = ""
+			}
+		}
+		key.Args = append(key.Args, arg)
+	}
+	for plugin, path := range plugins {
+		if path == "" {
+			path = plugin
+		}
+		key.Plugins[plugin] = pluginIdentity(path)
+	}
+
+	graph := readImportGraph(dir, inputs, args)
+	includes := protoc.IncludePaths(args)
+	for file := range graph.dependents {
+		if content, err := os.ReadFile(file); err == nil {
+			digest := sha256.Sum256(content)
+			key.Files[fileKey(dir, includes, file, graph.names[file])] = hex.EncodeToString(digest[:])
+		}
+	}
+	return key
+}
+
+// fileKey returns the name of file in the Files of an output key: its path
+// relative to dir, or, outside dir, its name in the first include path
+// holding it, prefixed with the position of that include path, as absolute
+// include paths differ between machines. Unlike name, the name of file in
+// protoc, it is unique, as files of different include paths may share a
+// name.
+func fileKey(dir string, includes []string, file, name string) string {
+	if rel, ok := relativePath(dir, file); ok {
+		return rel
+	}
+	for i, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		if rel, ok := relativePath(include, file); ok {
+			return fmt.Sprintf("include%d/%s", i, rel)
+		}
+	}
+	return name
+}
+
+// relativePath returns the slash-separated path of file relative to dir,
+// and whether file is in dir.
+func relativePath(dir, file string) (string, bool) {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// pluginIdentity returns the version of the plugin at path, looked up in the
+// PATH unless it is a path, or the digest of its binary when it has no
+// version. It is empty when the plugin is not found.
+func pluginIdentity(path string) string {
+	version := pluginVersion(path)
+	if version.Error == "" {
+		return version.Version
+	}
+	if version.Path == "" {
+		return ""
+	}
+	content, err := os.ReadFile(version.Path)
+	if err != nil {
+		return ""
+	}
+	digest := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(digest[:])
+}
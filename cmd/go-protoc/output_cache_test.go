@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"github.com/esdandreu/go-protoc/pkg/compiler"
+	"github.com/esdandreu/go-protoc/pkg/outcache"
+)
+
+func TestCachedProtoc(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\n"})
+	t.Chdir(dir)
+	// The mock protoc writes the name of its inputs to pet.pb.go in the Go
+	// output directory.
+	binPath := createMockBinary(t,
+		mockprotoc.OnArg("--go_out=*", "out=${arg#--go_out=}"),
+		mockprotoc.OnArg("*.proto", "inputs=\"$inputs $arg\""),
+		mockprotoc.Then("echo \"$inputs\" > \"$out/pet.pb.go\""),
+	)
+	outputs := outcache.New(&outcache.DirBackend{Dir: t.TempDir()})
+	args := []string{"pet.proto", "--go_out=."}
+
+	cache := &mockBinCache{binPath: binPath}
+	if err := cachedProtoc(cache, outputs, protocTag(cache), dir, args...); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.callCount != 1 {
+		t.Errorf("Expected protoc to run on a miss, got %d calls", cache.callCount)
+	}
+
+	// A hit restores the outputs without getting protoc.
+	os.Remove(filepath.Join(dir, "pet.pb.go"))
+	offline := &mockBinCache{err: errors.New("offline")}
+	if err := cachedProtoc(offline, outputs, protocTag(offline), dir, args...); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if offline.callCount != 0 {
+		t.Errorf("Expected protoc not to run on a hit, got %d calls", offline.callCount)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "pet.pb.go")); err != nil || string(content) != " pet.proto\n" {
+		t.Errorf("Expected pet.pb.go to be restored, got %q (%v)", content, err)
+	}
+
+	// Changing an input misses.
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\npackage pet;\n"})
+	if err := cachedProtoc(offline, outputs, protocTag(offline), dir, args...); err == nil {
+		t.Errorf("Expected protoc to run after a change")
+	}
+}
+
+// countingVersionCache resolves latest to 32.1, counting how many times.
+type countingVersionCache struct {
+	mockVersionCache
+	latestCount int
+}
+
+func (m *countingVersionCache) ResolveVersion(tag string) (string, error) {
+	if tag == "latest" {
+		m.latestCount++
+		return "32.1", nil
+	}
+	return m.mockVersionCache.ResolveVersion(tag)
+}
+
+func TestCachedProtoc_ResolvesOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\n"})
+	t.Chdir(dir)
+	binPath := createMockBinary(t)
+	outputs := outcache.New(&outcache.DirBackend{Dir: t.TempDir()})
+
+	cache := &countingVersionCache{mockVersionCache: mockVersionCache{mockBinCache: mockBinCache{binPath: binPath}}}
+	if err := cachedProtoc(cache, outputs, "latest", dir, "pet.proto", "--go_out=."); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.latestCount != 1 {
+		t.Errorf("Expected latest to be resolved once, got %d times", cache.latestCount)
+	}
+	if cache.lastTag != "32.1" {
+		t.Errorf("Expected protoc 32.1, got %s", cache.lastTag)
+	}
+}
+
+func TestCachedProtoc_AbsoluteOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"pet.proto": "syntax = \"proto3\";\n"})
+	t.Chdir(dir)
+	binPath := createMockBinary(t,
+		mockprotoc.OnArg("--go_out=*", `echo generated > "${arg#--go_out=}/pet.pb.go"`),
+	)
+	cacheDir := t.TempDir()
+	outputs := outcache.New(&outcache.DirBackend{Dir: cacheDir})
+	outDir := t.TempDir()
+
+	// The run falls back to protoc writing the outputs itself.
+	cache := &mockBinCache{binPath: binPath}
+	if err := cachedProtoc(cache, outputs, protocTag(cache), dir, "pet.proto", "--go_out="+outDir); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(outDir, "pet.pb.go")); err != nil || string(content) != "generated\n" {
+		t.Errorf("Expected pet.pb.go in the output directory, got %q (%v)", content, err)
+	}
+	if entries, err := os.ReadDir(cacheDir); err != nil || len(entries) != 0 {
+		t.Errorf("Expected nothing stored in the output cache, got %v (%v)", entries, err)
+	}
+}
+
+func TestBackendVersion(t *testing.T) {
+	testCases := map[string]struct {
+		cache    BinCache
+		expected string
+	}{
+		"protoc":   {&mockBinCache{}, "32.1"},
+		"compiler": {compiler.NewCompiler(t.TempDir()), compiler.Version},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if version := backendVersion(tc.cache, "32.1"); version != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, version)
+			}
+		})
+	}
+}
+
+func TestOutputKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock plugin requires an executable file mode")
+	}
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"api/pet.proto":           "import \"types/money.proto\";\n",
+		"proto/types/money.proto": "syntax = \"proto3\";\n",
+		"bin/protoc-gen-custom":   "plugin",
+	})
+	plugin := filepath.Join(dir, "bin", "protoc-gen-custom")
+	if err := os.Chmod(plugin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{
+		"api/pet.proto", "-Iproto", "-I", ".", "-I" + filepath.Join(dir, "deps"), "--proto_path", filepath.Join(dir, "module"),
+		"--plugin=protoc-gen-custom=" + plugin, "--custom_out=.", "--java_out=java",
+	}
+	key := outputKey(dir, "32.1", args)
+
+	if key.Protoc != "32.1" {
+		t.Errorf("Expected protoc 32.1, got %s", key.Protoc)
+	}
+	expectedArgs := []string{"api/pet.proto", "-Iproto", "-I", ".", "--custom_out=.", "--java_out=java"}
+	if !slices.Equal(key.Args, expectedArgs) {
+		t.Errorf("Expected %v, got %v", expectedArgs, key.Args)
+	}
+	if len(key.Plugins) != 1 || !strings.HasPrefix(key.Plugins["protoc-gen-custom"], "sha256:") {
+		t.Errorf("Expected the digest of the custom plugin, got %v", key.Plugins)
+	}
+	var files []string
+	for name := range key.Files {
+		files = append(files, name)
+	}
+	slices.Sort(files)
+	if expected := []string{"api/pet.proto", "proto/types/money.proto"}; !slices.Equal(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	// Keys do not depend on the directory.
+	other := t.TempDir()
+	writeTestFiles(t, other, map[string]string{
+		"api/pet.proto":           "import \"types/money.proto\";\n",
+		"proto/types/money.proto": "syntax = \"proto3\";\n",
+	})
+	args = slices.Clone(args)
+	args[4] = "-I" + filepath.Join(other, "deps")
+	if otherKey := outputKey(other, "32.1", args); !reflect.DeepEqual(otherKey.Files, key.Files) || !slices.Equal(otherKey.Args, key.Args) {
+		t.Errorf("Expected equal keys, got %+v and %+v", key, otherKey)
+	}
+}
+
+func TestOutputKey_SameName(t *testing.T) {
+	dir := t.TempDir()
+	deps := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"api/pet.proto":             "syntax = \"proto3\";\n",
+		"store.proto":               "import \"api/pet.proto\";\nimport \"types/money.proto\";\n",
+		"third_party/api/pet.proto": "syntax = \"proto2\";\n",
+	})
+	writeTestFiles(t, deps, map[string]string{"types/money.proto": "syntax = \"proto3\";\n"})
+	// store.proto imports the api/pet.proto of third_party, which protoc
+	// knows by the same name as the input api/pet.proto.
+	args := []string{"-Ithird_party", "-I" + deps, "-I.", "api/pet.proto", "store.proto"}
+
+	key := outputKey(dir, "32.1", args)
+	var files []string
+	for name := range key.Files {
+		files = append(files, name)
+	}
+	slices.Sort(files)
+	expected := []string{"api/pet.proto", "include1/types/money.proto", "store.proto", "third_party/api/pet.proto"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+	if key.Files["api/pet.proto"] == key.Files["third_party/api/pet.proto"] {
+		t.Errorf("Expected the digests of both files, got %v", key.Files)
+	}
+}
+
+func TestOpenOutputCache(t *testing.T) {
+	t.Setenv("GO_PROTOC_OUTPUT_CACHE_TOKEN", "token")
+	dir := t.TempDir()
+	local := &outcache.DirBackend{Dir: filepath.Join(dir, outcache.CacheDir)}
+	testCases := map[string]struct {
+		location string
+		cache    BinCache
+		expected outcache.Backend
+		err      bool
+	}{
+		"disabled":  {location: "false", cache: &mockDoctorCache{}},
+		"local":     {location: "true", cache: &mockDoctorCache{mockVersionCache{dir: dir}}, expected: local},
+		"no local":  {location: "1", cache: &mockBinCache{}, err: true},
+		"directory": {location: "/shared/outputs", cache: &mockDoctorCache{mockVersionCache{dir: dir}}, expected: &outcache.DirBackend{Dir: "/shared/outputs"}},
+		"http": {
+			location: "https://cache.example.com",
+			cache:    &mockDoctorCache{mockVersionCache{dir: dir}},
+			expected: outcache.Tiered{
+				Local:  local,
+				Remote: &outcache.HTTPBackend{URL: "https://cache.example.com", Header: http.Header{"Authorization": {"Bearer token"}}},
+			},
+		},
+		"http without local": {
+			location: "https://cache.example.com",
+			cache:    &mockBinCache{},
+			expected: &outcache.HTTPBackend{URL: "https://cache.example.com", Header: http.Header{"Authorization": {"Bearer token"}}},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outputs, err := openOutputCache(tc.cache, tc.location)
+			if tc.err {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			var backend outcache.Backend
+			if outputs != nil {
+				backend = outputs.Backend
+			}
+			if !reflect.DeepEqual(backend, tc.expected) {
+				t.Errorf("Expected %#v, got %#v", tc.expected, backend)
+			}
+		})
+	}
+}
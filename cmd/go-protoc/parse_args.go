@@ -70,3 +70,58 @@ func extractFlagName(arg string) string {
 
 	return name
 }
+
+// ExtractFlag removes every occurrence of the boolean flag name (as -name or
+// --name) from args. It returns the remaining arguments and whether the flag
+// was present. Arguments after a "--" terminator are left untouched.
+func ExtractFlag(args []string, name string) ([]string, bool) {
+	var rest []string
+	found := false
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if arg == "-"+name || arg == "--"+name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// ExtractFlagValue removes every occurrence of the flag name (as -name value,
+// --name value, -name=value or --name=value) from args. It returns the
+// remaining arguments, the last value given and whether the flag was present.
+// Arguments after a "--" terminator are left untouched.
+func ExtractFlagValue(args []string, name string) ([]string, string, bool) {
+	var rest []string
+	var value string
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		if arg == "-"+name || arg == "--"+name {
+			found = true
+			if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			continue
+		}
+		if v, ok := strings.CutPrefix(arg, "-"+name+"="); ok {
+			found, value = true, v
+			continue
+		}
+		if v, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			found, value = true, v
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, value, found
+}
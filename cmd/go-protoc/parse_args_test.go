@@ -34,3 +34,85 @@ func TestParseArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractFlag(t *testing.T) {
+	testCases := map[string]struct {
+		args  []string
+		rest  []string
+		found bool
+	}{
+		"absent": {
+			args:  []string{"--go_out=.", "x.proto"},
+			rest:  []string{"--go_out=.", "x.proto"},
+			found: false,
+		},
+		"double dash": {
+			args:  []string{"--check", "x.proto"},
+			rest:  []string{"x.proto"},
+			found: true,
+		},
+		"single dash": {
+			args:  []string{"x.proto", "-check"},
+			rest:  []string{"x.proto"},
+			found: true,
+		},
+		"after terminator": {
+			args:  []string{"--", "--check"},
+			rest:  []string{"--", "--check"},
+			found: false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rest, found := ExtractFlag(tc.args, "check")
+			if !reflect.DeepEqual(rest, tc.rest) {
+				t.Errorf("Expected %v, got %v", tc.rest, rest)
+			}
+			if found != tc.found {
+				t.Errorf("Expected %v, got %v", tc.found, found)
+			}
+		})
+	}
+}
+
+func TestExtractFlagValue(t *testing.T) {
+	testCases := map[string]struct {
+		args  []string
+		rest  []string
+		value string
+		found bool
+	}{
+		"absent": {
+			args: []string{"x.proto"},
+			rest: []string{"x.proto"},
+		},
+		"separate value": {
+			args:  []string{"--out", "dir", "x.proto"},
+			rest:  []string{"x.proto"},
+			value: "dir",
+			found: true,
+		},
+		"equals value": {
+			args:  []string{"x.proto", "-out=dir"},
+			rest:  []string{"x.proto"},
+			value: "dir",
+			found: true,
+		},
+		"last value wins": {
+			args:  []string{"--out=a", "--out=b"},
+			value: "b",
+			found: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rest, value, found := ExtractFlagValue(tc.args, "out")
+			if !reflect.DeepEqual(rest, tc.rest) {
+				t.Errorf("Expected %v, got %v", tc.rest, rest)
+			}
+			if value != tc.value || found != tc.found {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tc.value, tc.found, value, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+// Phases of a go-protoc run reported by --timings, in order.
+const (
+	phaseResolve  = "resolve version"
+	phaseDownload = "download"
+	phaseExtract  = "extract"
+	phaseProtoc   = "protoc"
+)
+
+var phases = []string{phaseResolve, phaseDownload, phaseExtract, phaseProtoc}
+
+// runTimings records the phases of the current run.
+var runTimings = newTimings()
+
+// timings records how long the phases of a run take. It implements
+// downloader.Observer, logging every download and extraction.
+type timings struct {
+	mu        sync.Mutex
+	start     time.Time
+	durations map[string]time.Duration
+	counts    map[string]int
+	// downloaded is the number of bytes downloaded.
+	downloaded int64
+}
+
+func newTimings() *timings {
+	return &timings{
+		start:     time.Now(),
+		durations: make(map[string]time.Duration),
+		counts:    make(map[string]int),
+	}
+}
+
+// add records that phase took elapsed once more.
+func (t *timings) add(phase string, elapsed time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations[phase] += elapsed
+	t.counts[phase]++
+}
+
+func (t *timings) Downloaded(url string, size int64, elapsed time.Duration) {
+	logger.Info("downloaded", "url", url, "bytes", size, "duration", elapsed)
+	t.add(phaseDownload, elapsed)
+	t.mu.Lock()
+	t.downloaded += size
+	t.mu.Unlock()
+}
+
+func (t *timings) Extracted(url string, elapsed time.Duration) {
+	logger.Debug("extracted", "url", url, "duration", elapsed)
+	t.add(phaseExtract, elapsed)
+}
+
+// write reports the phases that ran, with the download size and speed, and
+// the total time of the run.
+func (t *timings) write(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var report strings.Builder
+	tw := tabwriter.NewWriter(&report, 0, 0, 2, ' ', 0)
+	for _, phase := range phases {
+		count := t.counts[phase]
+		if count == 0 {
+			continue
+		}
+		elapsed := t.durations[phase]
+		var detail string
+		switch {
+		case phase == phaseDownload:
+			detail = fmt.Sprintf("%s at %s/s", formatBytes(t.downloaded), formatBytes(bytesPerSecond(t.downloaded, elapsed)))
+		case count > 1:
+			detail = fmt.Sprintf("%d runs", count)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", phase, elapsed.Round(time.Millisecond), detail)
+	}
+	fmt.Fprintf(tw, "total\t%s\t\n", time.Since(t.start).Round(time.Millisecond))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Lines without details end with the padding of the durations.
+	for line := range strings.Lines(report.String()) {
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " \n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bytesPerSecond(size int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(size) / elapsed.Seconds())
+}
+
+// formatBytes formats size with a decimal unit, such as 5.3 MB.
+func formatBytes(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGT"[prefix])
+}
+
+// timedVersionResolver records the time spent resolving protoc versions.
+type timedVersionResolver struct {
+	bincache.VersionResolver
+	timings *timings
+}
+
+func (r timedVersionResolver) ResolveVersion(tag string) (string, error) {
+	start := time.Now()
+	version, err := r.VersionResolver.ResolveVersion(tag)
+	elapsed := time.Since(start)
+	r.timings.add(phaseResolve, elapsed)
+	logger.Debug("resolved protoc version", "tag", tag, "version", version, "duration", elapsed)
+	return version, err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	testCases := map[string]struct {
+		size     int64
+		expected string
+	}{
+		"bytes":     {size: 999, expected: "999 B"},
+		"kilobytes": {size: 1500, expected: "1.5 kB"},
+		"megabytes": {size: 5_300_000, expected: "5.3 MB"},
+		"gigabytes": {size: 2_000_000_000, expected: "2.0 GB"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if formatted := formatBytes(tc.size); formatted != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestTimings_Write(t *testing.T) {
+	timings := newTimings()
+	resolver := timedVersionResolver{VersionResolver: mockVersionResolver{}, timings: timings}
+	if _, err := resolver.ResolveVersion("latest"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	timings.Downloaded("https://example.com/protoc.zip", 4_000_000, 2*time.Second)
+	timings.Extracted("https://example.com/protoc.zip", 80*time.Millisecond)
+	timings.add(phaseProtoc, 300*time.Millisecond)
+	timings.add(phaseProtoc, 200*time.Millisecond)
+
+	var out bytes.Buffer
+	if err := timings.write(&out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expected := []string{
+		"resolve version  ",
+		"download         2s     4.0 MB at 2.0 MB/s",
+		"extract          80ms",
+		"protoc           500ms  2 runs",
+		"total            ",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got:\n%s", len(expected), out.String())
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Expected line starting with %q, got %q", prefix, lines[i])
+		}
+	}
+}
+
+func TestTimings_WriteNothing(t *testing.T) {
+	var out bytes.Buffer
+	if err := newTimings().write(&out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "total  ") {
+		t.Errorf("Expected only the total, got:\n%s", out.String())
+	}
+}
+
+type failingVersionResolver struct{}
+
+func (failingVersionResolver) ResolveVersion(tag string) (string, error) {
+	return "", errors.New("offline")
+}
+
+func TestTimedVersionResolver_Error(t *testing.T) {
+	timings := newTimings()
+	resolver := timedVersionResolver{VersionResolver: failingVersionResolver{}, timings: timings}
+	if _, err := resolver.ResolveVersion("latest"); err == nil || err.Error() != "offline" {
+		t.Errorf("Expected resolver error, got: %v", err)
+	}
+	if timings.counts[phaseResolve] != 1 {
+		t.Errorf("Expected failed resolutions to be timed, got %d", timings.counts[phaseResolve])
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	runtimedebug "runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+// ModulePath is the module go-protoc is built from.
+const ModulePath = "github.com/esdandreu/go-protoc"
+
+// Plugins are the protoc plugins go-protoc runs by default.
+var Plugins = []string{"protoc-gen-go", "protoc-gen-go-grpc"}
+
+// versionCache is implemented by caches that can tell where a protoc version
+// is cached without downloading it, such as bincache.ProtocBinCache.
+type versionCache interface {
+	ResolveVersion(tag string) (string, error)
+	VersionBinPath(version string) string
+}
+
+// checkingCache is implemented by caches that can check a cached protoc
+// release against what was installed without changing it, such as
+// bincache.ProtocBinCache.
+type checkingCache interface {
+	Check(version string) error
+}
+
+// componentVersion describes the version and location of a tool involved in
+// code generation.
+type componentVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// Error explains why the version could not be determined.
+	Error string `json:"error,omitempty"`
+}
+
+func (c componentVersion) String() string {
+	switch {
+	case c.Error != "":
+		return c.Name + "\t" + c.Error
+	case c.Path == "":
+		return c.Name + "\t" + c.Version
+	}
+	return fmt.Sprintf("%s\t%s\t%s", c.Name, c.Version, c.Path)
+}
+
+type versionReport struct {
+	GoProtoc componentVersion   `json:"go_protoc"`
+	Protoc   componentVersion   `json:"protoc"`
+	Plugins  []componentVersion `json:"plugins"`
+}
+
+// runVersion implements `go-protoc version [--json]`, which reports the
+// versions of go-protoc, of the protoc release selected by PROTOC_RELEASE_TAG
+// and of the plugins found in the PATH. The protoc version is reported
+// without downloading it.
+func runVersion(cache BinCache, w io.Writer, args ...string) error {
+	args, asJSON := ExtractFlag(args, "json")
+	if len(args) > 0 {
+		return fmt.Errorf("version: unexpected arguments %v", args)
+	}
+
+	report := versionReport{
+		GoProtoc: goProtocVersion(),
+		Protoc:   protocVersion(cache, protocTag(cache)),
+	}
+	for _, plugin := range Plugins {
+		report.Plugins = append(report.Plugins, pluginVersion(plugin))
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, report.GoProtoc)
+	fmt.Fprintln(tw, report.Protoc)
+	for _, plugin := range report.Plugins {
+		fmt.Fprintln(tw, plugin)
+	}
+	return tw.Flush()
+}
+
+// goProtocVersion returns the version of the go-protoc module in the running
+// binary. When run with `go tool`, the main module is the one declaring the
+// tool and go-protoc is one of its dependencies.
+func goProtocVersion() componentVersion {
+	version := componentVersion{Name: "go-protoc"}
+	info, ok := runtimedebug.ReadBuildInfo()
+	if !ok {
+		version.Error = "build information not available"
+		return version
+	}
+	module := &info.Main
+	for _, dep := range info.Deps {
+		if dep.Path == ModulePath {
+			module = dep
+		}
+	}
+	if module.Replace != nil {
+		module = module.Replace
+	}
+	version.Version = module.Version
+	return version
+}
+
+// protocVersion resolves tag and reports the protoc version cached for it.
+// Caches that implement checkingCache report releases whose binary does not
+// match the one installed as invalid, as BinPath would download them again.
+func protocVersion(cache BinCache, tag string) componentVersion {
+	version := componentVersion{Name: "protoc"}
+	vc, ok := cache.(versionCache)
+	if !ok {
+		version.Error = "cache does not support version lookup"
+		return version
+	}
+	resolved, err := vc.ResolveVersion(tag)
+	if err != nil {
+		version.Error = fmt.Sprintf("failed to resolve %s: %v", tag, err)
+		return version
+	}
+	version.Version = resolved
+	version.Path = vc.VersionBinPath(resolved)
+	if checker, ok := cache.(checkingCache); ok {
+		err = checker.Check(resolved)
+	} else if _, err = os.Stat(version.Path); errors.Is(err, os.ErrNotExist) {
+		err = bincache.ErrNotCached
+	}
+	switch {
+	case errors.Is(err, bincache.ErrNotCached):
+		version.Version += " (not cached)"
+	case err != nil:
+		version.Error = fmt.Sprintf("cached release %s is invalid: %v", resolved, err)
+	}
+	return version
+}
+
+// pluginVersion looks up a plugin in the PATH and reports the version of the
+// module it was built from, or the version it prints otherwise.
+func pluginVersion(name string) componentVersion {
+	version := componentVersion{Name: name}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		version.Error = "not found in PATH"
+		return version
+	}
+	version.Path = path
+	if info, err := buildinfo.ReadFile(path); err == nil && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version.Version = info.Main.Version
+		return version
+	}
+	output, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		version.Error = fmt.Sprintf("failed to get version: %v", err)
+		return version
+	}
+	// Plugins print their name followed by the version.
+	fields := strings.Fields(string(output))
+	if len(fields) > 0 {
+		version.Version = fields[len(fields)-1]
+	}
+	return version
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+)
+
+type mockVersionCache struct {
+	mockBinCache
+	dir string
+}
+
+func (m *mockVersionCache) ResolveVersion(tag string) (string, error) {
+	return strings.TrimPrefix(tag, "v"), nil
+}
+
+func (m *mockVersionCache) VersionBinPath(version string) string {
+	return filepath.Join(m.dir, version, "protoc")
+}
+
+func TestRunVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock plugins require a POSIX shell")
+	}
+	binDir := t.TempDir()
+	plugin := "#!/bin/sh\necho protoc-gen-go-grpc 1.5.1\n"
+	if err := os.WriteFile(filepath.Join(binDir, "protoc-gen-go-grpc"), []byte(plugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+	t.Setenv("PROTOC_RELEASE_TAG", "v32.1")
+
+	cacheDir := t.TempDir()
+	cache := &mockVersionCache{dir: cacheDir}
+	var out bytes.Buffer
+	if err := runVersion(cache, &out, "--json"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var report versionReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v\n%s", err, out.String())
+	}
+
+	if report.GoProtoc.Name != "go-protoc" {
+		t.Errorf("Unexpected go-protoc version %+v", report.GoProtoc)
+	}
+	expectedProtoc := componentVersion{
+		Name:    "protoc",
+		Version: "32.1 (not cached)",
+		Path:    filepath.Join(cacheDir, "32.1", "protoc"),
+	}
+	if report.Protoc != expectedProtoc {
+		t.Errorf("Expected %+v, got %+v", expectedProtoc, report.Protoc)
+	}
+	expectedPlugins := []componentVersion{
+		{Name: "protoc-gen-go", Error: "not found in PATH"},
+		{Name: "protoc-gen-go-grpc", Version: "1.5.1", Path: filepath.Join(binDir, "protoc-gen-go-grpc")},
+	}
+	for i, expected := range expectedPlugins {
+		if report.Plugins[i] != expected {
+			t.Errorf("Expected %+v, got %+v", expected, report.Plugins[i])
+		}
+	}
+
+	// Once cached, protoc is reported as installed.
+	binPath := cache.VersionBinPath("32.1")
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\necho libprotoc 32.1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runVersion(cache, &out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "protoc              32.1  "+binPath+"\n") {
+		t.Errorf("Expected cached protoc version, got:\n%s", out.String())
+	}
+}
+
+func TestProtocVersion_Check(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock protoc requires a POSIX shell")
+	}
+	cache := bincache.NewProtocBinCache(t.TempDir())
+	binPath := cache.VersionBinPath("32.1")
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\necho libprotoc 32.1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expected := componentVersion{Name: "protoc", Version: "32.1", Path: binPath}
+	if version := protocVersion(cache, "v32.1"); version != expected {
+		t.Errorf("Expected %+v, got %+v", expected, version)
+	}
+	// Reporting the version leaves the cache untouched.
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filepath.Dir(binPath)), bincache.InstalledMarkerName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the release not to be marked as installed, got: %v", err)
+	}
+
+	// A binary changed since it was installed is invalid.
+	if err := cache.Validate("32.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(binPath, []byte("#!/bin/sh\necho libprotoc 32.0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	version := protocVersion(cache, "v32.1")
+	if !strings.HasPrefix(version.Error, "cached release 32.1 is invalid: ") {
+		t.Errorf("Expected invalid release error, got %+v", version)
+	}
+}
+
+func TestRunVersion_UnsupportedCache(t *testing.T) {
+	var out bytes.Buffer
+	if err := runVersion(&mockBinCache{}, &out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(out.String(), "cache does not support version lookup") {
+		t.Errorf("Expected protoc version error, got:\n%s", out.String())
+	}
+}
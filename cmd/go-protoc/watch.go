@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/modproto"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long watch waits for changes to settle before
+// generating code, so that saving several files at once generates it once.
+const DefaultWatchDebounce = 200 * time.Millisecond
+
+// runWatch implements `go-protoc watch [protoc args]`, which generates code
+// like go-protoc does, then watches the input proto files and the files they
+// import, transitively, and generates the code of the directories affected by
+// every change until interrupted.
+func runWatch(cache BinCache, w io.Writer, args ...string) error {
+	opts, args := parseOptions(args)
+	if opts != (options{}) {
+		return fmt.Errorf("watch: check, clean, dry-run, descriptor set and output cache options are not supported")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	args, tag, err := resolveArgs(cache, wd, opts, args)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return newProtoWatcher(cache, tag, wd, args, w).watch(ctx)
+}
+
+// protoWatcher generates the code of the proto files of a directory whenever
+// they change.
+type protoWatcher struct {
+	cache BinCache
+	// tag is the protoc release tag, selected for the inputs when watching
+	// starts.
+	tag string
+	dir string
+	// flags are the protoc arguments other than the inputs, and inputs the
+	// proto files given in the arguments. Without inputs, the proto files
+	// are found in dir like protoc.Run does.
+	flags, inputs []string
+	debounce      time.Duration
+	w             io.Writer
+}
+
+func newProtoWatcher(cache BinCache, tag, dir string, args []string, w io.Writer) *protoWatcher {
+	pw := &protoWatcher{cache: cache, tag: tag, dir: dir, debounce: DefaultWatchDebounce, w: w}
+	for _, arg := range args {
+		if protoc.IsInput(arg) {
+			pw.inputs = append(pw.inputs, arg)
+		} else {
+			pw.flags = append(pw.flags, arg)
+		}
+	}
+	return pw
+}
+
+// watch generates the code of every input, then of the inputs affected by
+// each change, until ctx is done.
+func (pw *protoWatcher) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch files: %w", err)
+	}
+	defer watcher.Close()
+
+	graph, err := pw.graph()
+	if err != nil {
+		return err
+	}
+	dirs := pw.watchDirs(graph)
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	fmt.Fprintf(pw.w, "watching %d proto files in %d directories\n", len(graph.dependents), len(dirs))
+	pw.generate(graph, graph.inputs)
+
+	debounce := time.NewTimer(pw.debounce)
+	debounce.Stop()
+	changed := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Ext(event.Name) != ".proto" && !event.Has(fsnotify.Create) {
+				continue
+			}
+			changed[filepath.Clean(event.Name)] = true
+			debounce.Reset(pw.debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(pw.w, "watch: %v\n", err)
+		case <-debounce.C:
+			next, err := pw.graph()
+			if err != nil {
+				fmt.Fprintf(pw.w, "watch: %v\n", err)
+				continue
+			}
+			// New directories may hold new inputs.
+			for _, dir := range pw.watchDirs(next) {
+				if !slices.Contains(watcher.WatchList(), dir) {
+					if err := watcher.Add(dir); err != nil {
+						fmt.Fprintf(pw.w, "watch: failed to watch %s: %v\n", dir, err)
+					}
+				}
+			}
+			pw.generate(next, affectedInputs(changed, graph, next))
+			graph, changed = next, map[string]bool{}
+		}
+	}
+}
+
+// importGraph records the proto files the inputs depend on.
+type importGraph struct {
+	inputs []string
+	// dependents maps the path of every input, and of every file they
+	// import, transitively, to the inputs depending on it.
+	dependents map[string][]string
+	// names maps the same paths to the names protoc knows the files by: the
+	// path of inputs as given, and the import path of imported files.
+	names map[string]string
+}
+
+// graph reads the inputs and their imports.
+func (pw *protoWatcher) graph() (*importGraph, error) {
+	inputs := pw.inputs
+	if len(inputs) == 0 {
+		var err error
+		if inputs, err = protoInputs(pw.dir, nil); err != nil {
+			return nil, err
+		}
+	}
+	return readImportGraph(pw.dir, inputs, pw.flags), nil
+}
+
+// readImportGraph reads the inputs in dir and their imports. Imports are
+// looked up in the include paths of the arguments, and imports that are not
+// found, such as the well-known types, are left out.
+func readImportGraph(dir string, inputs, args []string) *importGraph {
+	includes := protoc.IncludePaths(args)
+	if len(includes) == 0 {
+		includes = []string{"."}
+	}
+	for i, include := range includes {
+		if !filepath.IsAbs(include) {
+			includes[i] = filepath.Join(dir, include)
+		}
+	}
+
+	graph := &importGraph{inputs: inputs, dependents: map[string][]string{}, names: map[string]string{}}
+	for _, input := range inputs {
+		file := filepath.Join(dir, filepath.FromSlash(input))
+		graph.names[file] = input
+		queue := []string{file}
+		seen := map[string]bool{}
+		for len(queue) > 0 {
+			file := queue[0]
+			queue = queue[1:]
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			graph.dependents[file] = append(graph.dependents[file], input)
+			content, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+			for _, imported := range modproto.Imports(content) {
+				for _, include := range includes {
+					candidate := filepath.Join(include, filepath.FromSlash(imported))
+					if _, err := os.Stat(candidate); err == nil {
+						if _, ok := graph.names[candidate]; !ok {
+							graph.names[candidate] = imported
+						}
+						queue = append(queue, candidate)
+						break
+					}
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// watchDirs returns the directories holding the files of the graph and,
+// when the inputs are found in the directory, the directories new inputs may
+// appear in.
+func (pw *protoWatcher) watchDirs(graph *importGraph) []string {
+	var dirs []string
+	for file := range graph.dependents {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	if len(pw.inputs) == 0 {
+		dirs = append(dirs, pw.dir)
+		entries, _ := os.ReadDir(pw.dir)
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				dirs = append(dirs, filepath.Join(pw.dir, entry.Name()))
+			}
+		}
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// affectedInputs returns the inputs of after depending on the changed files,
+// in the graph before or after the change, as imports may have changed.
+// New inputs are affected too, as those created along with their directory
+// are not reported.
+func affectedInputs(changed map[string]bool, before, after *importGraph) []string {
+	var affected []string
+	for _, input := range after.inputs {
+		if !slices.Contains(before.inputs, input) {
+			affected = append(affected, input)
+		}
+	}
+	for file := range changed {
+		affected = append(affected, before.dependents[file]...)
+		affected = append(affected, after.dependents[file]...)
+	}
+	affected = slices.DeleteFunc(affected, func(input string) bool {
+		return !slices.Contains(after.inputs, input)
+	})
+	slices.Sort(affected)
+	return slices.Compact(affected)
+}
+
+// generate runs protoc once for every directory of the inputs given, with
+// all of the inputs of the graph in that directory, as they belong to the
+// same package, and prints a line summarizing each run.
+func (pw *protoWatcher) generate(graph *importGraph, inputs []string) {
+	var packages []string
+	for _, input := range inputs {
+		packages = append(packages, path.Dir(filepath.ToSlash(input)))
+	}
+	slices.Sort(packages)
+	for _, pkg := range slices.Compact(packages) {
+		var pkgInputs []string
+		for _, input := range graph.inputs {
+			if path.Dir(filepath.ToSlash(input)) == pkg {
+				pkgInputs = append(pkgInputs, input)
+			}
+		}
+		start := time.Now()
+		err := runProtoc(pw.cache, pw.tag, pw.dir, append(slices.Clone(pw.flags), pkgInputs...)...)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(pw.w, "FAIL  %s  %v\n", pkg, err)
+			continue
+		}
+		files := "files"
+		if len(pkgInputs) == 1 {
+			files = "file"
+		}
+		fmt.Fprintf(pw.w, "ok    %s  %d %s  %s\n", pkg, len(pkgInputs), files, elapsed)
+	}
+}
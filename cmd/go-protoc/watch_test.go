@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForLines waits until the file at path has n lines and returns them.
+func waitForLines(t *testing.T, path string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		if len(content) > 0 && len(lines) >= n {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d lines in %s, got:\n%s", n, path, content)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProtoWatcher_Watch(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"common/money.proto": "syntax = \"proto3\";\npackage common;\n",
+		"pets/pet.proto":     "syntax = \"proto3\";\nimport \"common/money.proto\";\n",
+		"pets/owner.proto":   "syntax = \"proto3\";\nimport \"pets/pet.proto\";\n",
+		"shops/shop.proto":   "syntax = \"proto3\";\nimport \"google/protobuf/empty.proto\";\n",
+	})
+	t.Chdir(dir)
+	logPath := filepath.Join(t.TempDir(), "protoc.log")
+	binPath := createMockBinary(t,
+		mockprotoc.OnArg("*.proto", "printf '%s ' \"$arg\" >> '"+logPath+"'"),
+		mockprotoc.Then("echo >> '"+logPath+"'"),
+	)
+
+	out := &syncBuffer{}
+	pw := newProtoWatcher(&mockBinCache{binPath: binPath}, DefaultProtocTag, dir, []string{"--go_out=."}, out)
+	pw.debounce = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- pw.watch(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+	}()
+
+	lines := waitForLines(t, logPath, 3)
+	expected := []string{"common/money.proto ", "pets/owner.proto pets/pet.proto ", "shops/shop.proto "}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected every package to be generated, got %q", lines)
+	}
+
+	// Changing an import regenerates the packages depending on it.
+	writeTestFiles(t, dir, map[string]string{"common/money.proto": "syntax = \"proto3\";\npackage money;\n"})
+	lines = waitForLines(t, logPath, 5)
+	expected = []string{"common/money.proto ", "pets/owner.proto pets/pet.proto "}
+	if !reflect.DeepEqual(lines[3:], expected) {
+		t.Errorf("Expected the importing packages to be generated, got %q", lines[3:])
+	}
+
+	// New proto files are generated, even in new directories.
+	writeTestFiles(t, dir, map[string]string{"toys/toy.proto": "syntax = \"proto3\";\n"})
+	lines = waitForLines(t, logPath, 6)
+	if lines[len(lines)-1] != "toys/toy.proto " {
+		t.Errorf("Expected the new package to be generated, got %q", lines[5:])
+	}
+
+	output := out.String()
+	for _, summary := range []string{"watching 4 proto files in 4 directories", "ok    pets  2 files", "ok    shops  1 file "} {
+		if !strings.Contains(output, summary) {
+			t.Errorf("Expected output to contain %q, got:\n%s", summary, output)
+		}
+	}
+}
+
+func TestProtoWatcher_Graph(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"api/pet.proto":           "import \"types/money.proto\";\nimport public \"api/owner.proto\";\n",
+		"api/owner.proto":         "syntax = \"proto3\";\n",
+		"proto/types/money.proto": "import \"google/protobuf/any.proto\";\n",
+	})
+	pw := newProtoWatcher(&mockBinCache{}, DefaultProtocTag, dir, []string{"-I", ".", "--proto_path=proto", "api/pet.proto"}, &bytes.Buffer{})
+	graph, err := pw.graph()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := map[string][]string{
+		filepath.Join(dir, "api", "pet.proto"):              {"api/pet.proto"},
+		filepath.Join(dir, "api", "owner.proto"):            {"api/pet.proto"},
+		filepath.Join(dir, "proto", "types", "money.proto"): {"api/pet.proto"},
+	}
+	if !reflect.DeepEqual(graph.dependents, expected) {
+		t.Errorf("Expected %v, got %v", expected, graph.dependents)
+	}
+}
+
+func TestAffectedInputs(t *testing.T) {
+	before := &importGraph{
+		inputs: []string{"a.proto", "b.proto"},
+		dependents: map[string][]string{
+			"/a.proto": {"a.proto"},
+			"/b.proto": {"b.proto"},
+			"/c.proto": {"a.proto", "b.proto"},
+		},
+	}
+	// d.proto is new, so it is affected by any change.
+	after := &importGraph{
+		inputs: []string{"a.proto", "d.proto"},
+		dependents: map[string][]string{
+			"/a.proto": {"a.proto"},
+			"/d.proto": {"d.proto"},
+		},
+	}
+	testCases := map[string]struct {
+		changed  []string
+		expected []string
+	}{
+		"removed import": {changed: []string{"/c.proto"}, expected: []string{"a.proto", "d.proto"}},
+		"new input":      {changed: []string{"/d.proto"}, expected: []string{"d.proto"}},
+		"new directory":  {changed: []string{"/d"}, expected: []string{"d.proto"}},
+		"removed input":  {changed: []string{"/b.proto"}, expected: []string{"d.proto"}},
+		"unrelated":      {changed: []string{"/README.md"}, expected: []string{"d.proto"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			changed := map[string]bool{}
+			for _, file := range tc.changed {
+				changed[file] = true
+			}
+			if affected := affectedInputs(changed, before, after); !slices.Equal(affected, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, affected)
+			}
+		})
+	}
+}
+
+func TestRunWatch_Options(t *testing.T) {
+	err := runWatch(&mockBinCache{}, &bytes.Buffer{}, "--check")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("Expected unsupported option error, got: %v", err)
+	}
+}
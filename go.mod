@@ -2,4 +2,18 @@ module github.com/esdandreu/go-protoc
 
 go 1.25.0
 
-require golang.org/x/mod v0.28.0
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/jedisct1/go-minisign v0.0.0-20241212093149-d2f9f49435c7
+	github.com/tetratelabs/wazero v1.8.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/mod v0.28.0
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)
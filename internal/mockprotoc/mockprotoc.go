@@ -0,0 +1,83 @@
+// Package mockprotoc writes mock protoc binaries for tests.
+package mockprotoc
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Option adds behavior to a mock protoc.
+type Option func(*script)
+
+type script struct {
+	cases []string
+	after []string
+}
+
+// OnArg runs the shell command for every argument matching the shell
+// pattern, which the command gets as $arg.
+func OnArg(pattern, command string) Option {
+	return func(s *script) {
+		s.cases = append(s.cases, "    "+pattern+") "+command+" ;;\n")
+	}
+}
+
+// Then runs the shell command once every argument was handled.
+func Then(command string) Option {
+	return func(s *script) {
+		s.after = append(s.after, command+"\n")
+	}
+}
+
+// CopiesDescriptorSet copies the fixture, relative to the working directory
+// of the mock unless absolute, to --descriptor_set_out.
+func CopiesDescriptorSet(fixture string) Option {
+	return OnArg("--descriptor_set_out=*", "cp '"+fixture+"' \"${arg#--descriptor_set_out=}\"")
+}
+
+// New creates a mock protoc that prints its arguments. Options require a
+// POSIX shell, so tests using them are skipped on Windows.
+func New(t testing.TB, opts ...Option) string {
+	t.Helper()
+	binName := "mock-protoc"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binPath := filepath.Join(t.TempDir(), binName)
+	Write(t, binPath, opts...)
+	return binPath
+}
+
+// Write writes a mock protoc like New does at binPath, such as the path of a
+// release in a cache, creating its directory.
+func Write(t testing.TB, binPath string, opts ...Option) {
+	t.Helper()
+	if runtime.GOOS == "windows" && len(opts) > 0 {
+		t.Skip("mock protoc options require a POSIX shell")
+	}
+
+	var content string
+	if runtime.GOOS == "windows" {
+		content = "@echo off\necho mock-protoc called with args: %*\n"
+	} else {
+		var s script
+		for _, opt := range opts {
+			opt(&s)
+		}
+		content = "#!/bin/sh\necho \"mock-protoc called with args: $@\"\n"
+		if len(s.cases) > 0 {
+			content += "for arg in \"$@\"; do\n  case \"$arg\" in\n" + strings.Join(s.cases, "") + "  esac\ndone\n"
+		}
+		content += strings.Join(s.after, "")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary directory: %v", err)
+	}
+	if err := os.WriteFile(binPath, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to create mock binary: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Package protocrun runs protoc command lines without a native protoc
+// binary: it parses the arguments, runs the plugins on compiled descriptors
+// and links protoc to programs that behave as protoc when invoked through
+// the link.
+package protocrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile/options"
+	"github.com/esdandreu/go-protoc/pkg/generate"
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Output is a --NAME_out flag and the --NAME_opt flags of its generator.
+type Output struct {
+	Name, Dir  string
+	Parameters []string
+}
+
+// Invocation is a parsed protoc command line.
+type Invocation struct {
+	Includes          []string
+	Plugins           map[string]string
+	Outputs           []*Output
+	DescriptorSetOut  string
+	IncludeImports    bool
+	IncludeSourceInfo bool
+	ErrorFormat       string
+	Inputs            []string
+	Version           bool
+	// Other are the other flags, with their value after "=" if they take
+	// one, such as --decode=pets.Pet.
+	Other []string
+}
+
+// valueFlags are the flags, other than --NAME_out and --NAME_opt, taking a
+// value, which may be the next argument.
+var valueFlags = []string{
+	"-I", "--proto_path", "--plugin", "--descriptor_set_out", "--error_format",
+	"--decode", "--encode", "--dependency_out", "--descriptor_set_in",
+}
+
+// Parse parses the protoc arguments args.
+func Parse(args []string) (*Invocation, error) {
+	inv := &Invocation{Plugins: map[string]string{}}
+	outputs := map[string]*Output{}
+	output := func(name string) *Output {
+		if outputs[name] == nil {
+			outputs[name] = &Output{Name: name}
+			inv.Outputs = append(inv.Outputs, outputs[name])
+		}
+		return outputs[name]
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			inv.Inputs = append(inv.Inputs, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			inv.Inputs = append(inv.Inputs, arg)
+			continue
+		}
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if strings.HasPrefix(arg, "-I") && arg != "-I" {
+			flag, value, hasValue = "-I", strings.TrimPrefix(arg, "-I"), true
+		}
+		takesValue := strings.HasSuffix(flag, "_out") || strings.HasSuffix(flag, "_opt")
+		for _, valueFlag := range valueFlags {
+			takesValue = takesValue || flag == valueFlag
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for %s", flag)
+			}
+			i++
+			value, hasValue = args[i], true
+		}
+
+		switch {
+		case flag == "-I" || flag == "--proto_path":
+			inv.Includes = append(inv.Includes, filepath.SplitList(value)...)
+		case flag == "--plugin":
+			name, path, ok := strings.Cut(value, "=")
+			if !ok {
+				path = value
+				name = strings.TrimSuffix(filepath.Base(value), filepath.Ext(value))
+			}
+			inv.Plugins[strings.TrimPrefix(name, "protoc-gen-")] = path
+		case flag == "--descriptor_set_out":
+			inv.DescriptorSetOut = value
+		case flag == "--include_imports":
+			inv.IncludeImports = true
+		case flag == "--include_source_info":
+			inv.IncludeSourceInfo = true
+		case flag == "--version":
+			inv.Version = true
+		case flag == "--error_format":
+			inv.ErrorFormat = value
+		case strings.HasSuffix(flag, "_out") && !contains(valueFlags, flag):
+			out := output(strings.TrimSuffix(strings.TrimPrefix(flag, "--"), "_out"))
+			out.Dir = value
+			if parameters, dir, ok := strings.Cut(value, ":"); ok && !filepath.IsAbs(value) {
+				out.Dir = dir
+				out.Parameters = append(strings.Split(parameters, ","), out.Parameters...)
+			}
+		case strings.HasSuffix(flag, "_opt"):
+			out := output(strings.TrimSuffix(strings.TrimPrefix(flag, "--"), "_opt"))
+			out.Parameters = append(out.Parameters, value)
+		case hasValue:
+			inv.Other = append(inv.Other, flag+"="+value)
+		default:
+			inv.Other = append(inv.Other, flag)
+		}
+	}
+	for _, out := range inv.Outputs {
+		if out.Dir == "" {
+			return nil, fmt.Errorf("--%s_opt given without --%s_out", out.Name, out.Name)
+		}
+	}
+	return inv, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludePaths returns the include paths of the invocation, which default to
+// the working directory, like protoc does.
+func (inv *Invocation) IncludePaths() []string {
+	if len(inv.Includes) == 0 {
+		return []string{"."}
+	}
+	return inv.Includes
+}
+
+// FileNames returns the names of the input files run in dir, relative to
+// their include path.
+func (inv *Invocation) FileNames(dir string) []string {
+	names := make([]string, len(inv.Inputs))
+	for i, input := range inv.Inputs {
+		names[i] = protoc.FileName(dir, inv.IncludePaths(), input)
+	}
+	return names
+}
+
+// ResolvePath returns path relative to dir, unless it is absolute.
+func ResolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// ErrPluginNotFound is returned by RunPlugin when the plugin is not given
+// with --plugin and not in the PATH either.
+var ErrPluginNotFound = errors.New("not found in PATH")
+
+// RunPlugin runs the plugin of out in dir, on the files named names, out of
+// files, and writes the files it generates. The plugin is protoc-gen-NAME in
+// the PATH unless given with --plugin. files are in dependency order and keep
+// their source-retention options, which the plugin only receives for the
+// files to generate.
+func (inv *Invocation) RunPlugin(ctx context.Context, dir string, out *Output, files []*descriptorpb.FileDescriptorProto, names []string, stderr io.Writer) error {
+	outDir := ResolvePath(dir, out.Dir)
+	if info, err := os.Stat(outDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s: No such file or directory", out.Dir)
+	}
+	path, ok := inv.Plugins[out.Name]
+	if !ok {
+		var err error
+		if path, err = exec.LookPath("protoc-gen-" + out.Name); err != nil {
+			return fmt.Errorf("protoc-gen-%s %w", out.Name, ErrPluginNotFound)
+		}
+	}
+
+	stripped := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		file, err := options.StripSourceRetentionOptionsFromFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to strip source-retention options: %w", err)
+		}
+		stripped.File = append(stripped.File, file)
+	}
+	request := generate.NewRequest(stripped, names, strings.Join(out.Parameters, ","))
+	request.SourceFileDescriptors = nil
+	for _, file := range files {
+		for _, name := range request.FileToGenerate {
+			if file.GetName() == name {
+				request.SourceFileDescriptors = append(request.SourceFileDescriptors, file)
+			}
+		}
+	}
+	input, err := proto.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("protoc-gen-%s: Plugin failed: %w", out.Name, err)
+	}
+	response := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(output.Bytes(), response); err != nil {
+		return fmt.Errorf("protoc-gen-%s: Plugin output is unparseable: %w", out.Name, err)
+	}
+	if response.Error != nil {
+		return errors.New(response.GetError())
+	}
+	return generate.WriteResponse(outDir, response)
+}
+
+// Link makes binPath a link to executable, a symbolic link or else a hard
+// link, unless it already is one.
+func Link(executable, binPath string) error {
+	target, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	if info, err := os.Stat(binPath); err == nil && os.SameFile(info, target) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(binPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create link directory: %w", err)
+	}
+	// Link under a temporary name first, so that concurrent runs never see
+	// a missing link.
+	tmp := filepath.Join(filepath.Dir(binPath), fmt.Sprintf(".%s-%d", filepath.Base(binPath), os.Getpid()))
+	os.Remove(tmp)
+	if err := os.Symlink(executable, tmp); err != nil {
+		if err := os.Link(executable, tmp); err != nil {
+			return fmt.Errorf("failed to link %s: %w", executable, err)
+		}
+	}
+	if err := os.Rename(tmp, binPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to link %s: %w", executable, err)
+	}
+	return nil
+}
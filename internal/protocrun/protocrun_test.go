@@ -0,0 +1,123 @@
+package protocrun
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := map[string]struct {
+		args        []string
+		expected    *Invocation
+		expectedErr string
+	}{
+		"flags": {
+			args: []string{
+				"-Iapi", "--proto_path", "a:b", "--plugin=protoc-gen-foo=bin/foo", "--go_out=paths=import:gen",
+				"--go_opt=Mpet.proto=example.com/pets", "--foo_opt", "x", "--foo_out", ".", "--descriptor_set_out=set.binpb",
+				"--include_imports", "pet.proto", "--", "-weird.proto",
+			},
+			expected: &Invocation{
+				Includes: []string{"api", "a", "b"},
+				Plugins:  map[string]string{"foo": "bin/foo"},
+				Outputs: []*Output{
+					{Name: "go", Dir: "gen", Parameters: []string{"paths=import", "Mpet.proto=example.com/pets"}},
+					{Name: "foo", Dir: ".", Parameters: []string{"x"}},
+				},
+				DescriptorSetOut: "set.binpb",
+				IncludeImports:   true,
+				Inputs:           []string{"pet.proto", "-weird.proto"},
+			},
+		},
+		"plugin path": {
+			args: []string{"--plugin=bin/protoc-gen-foo", "--foo_out=."},
+			expected: &Invocation{
+				Plugins: map[string]string{"foo": "bin/protoc-gen-foo"},
+				Outputs: []*Output{{Name: "foo", Dir: "."}},
+			},
+		},
+		"other flags": {
+			args: []string{"--decode", "pets.Pet", "--dependency_out=deps.d", "--fatal_warnings", "--error_format=msvs", "pet.proto"},
+			expected: &Invocation{
+				Plugins:     map[string]string{},
+				ErrorFormat: "msvs",
+				Inputs:      []string{"pet.proto"},
+				Other:       []string{"--decode=pets.Pet", "--dependency_out=deps.d", "--fatal_warnings"},
+			},
+		},
+		"missing value":      {args: []string{"-I"}, expectedErr: "missing value for -I"},
+		"option without out": {args: []string{"--go_opt=paths=import"}, expectedErr: "--go_opt given without --go_out"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inv, err := Parse(tc.args)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(inv, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, inv)
+			}
+		})
+	}
+}
+
+func TestInvocation_FileNames(t *testing.T) {
+	testCases := map[string]struct {
+		args     []string
+		expected []string
+	}{
+		"default include": {args: []string{"api/v1/pet.proto"}, expected: []string{"api/v1/pet.proto"}},
+		"include":         {args: []string{"-Iapi", "api/v1/pet.proto"}, expected: []string{"v1/pet.proto"}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "api", "v1", "pet.proto")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("syntax = \"proto3\";\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			inv, err := Parse(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := inv.FileNames(dir); !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "go-protoc")
+	if err := os.WriteFile(executable, []byte("go-protoc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	binPath := filepath.Join(t.TempDir(), "bin", "protoc")
+	for range 2 {
+		if err := Link(executable, binPath); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	linked, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Stat(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(linked, target) {
+		t.Errorf("Expected %s to link to %s", binPath, executable)
+	}
+}
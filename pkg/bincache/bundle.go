@@ -0,0 +1,417 @@
+package bincache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+)
+
+// BundleManifestName is the name of the manifest, the first entry of a
+// bundle.
+const BundleManifestName = "manifest.json"
+
+// BundleManifest describes the protoc releases in a bundle.
+type BundleManifest struct {
+	Created  time.Time       `json:"created"`
+	Releases []BundleRelease `json:"releases"`
+}
+
+// BundleRelease is a cached protoc release. Its files are stored in the
+// bundle under <goos>_<goarch>/<version>/, whatever the platform exporting
+// it, so that the bundle can be imported on any platform.
+type BundleRelease struct {
+	Version string       `json:"version"`
+	GOOS    string       `json:"goos"`
+	GOARCH  string       `json:"goarch"`
+	Files   []BundleFile `json:"files"`
+}
+
+// Dir returns the directory of the release in the bundle.
+func (r BundleRelease) Dir() string {
+	return path.Join(r.GOOS+"_"+r.GOARCH, r.Version)
+}
+
+// BundleFile is a file of a release, with a path relative to the release
+// directory.
+type BundleFile struct {
+	Path   string      `json:"path"`
+	Mode   fs.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	SHA256 string      `json:"sha256"`
+}
+
+// cachedRelease is a release found in the cache directory.
+type cachedRelease struct {
+	version, goos, goarch string
+	dir                   string
+}
+
+// releases lists the releases of every platform in the cache. Versions whose
+// binary is missing, such as interrupted downloads, are skipped.
+func (protoc *ProtocBinCache) releases() ([]cachedRelease, error) {
+	var releases []cachedRelease
+	caches := []*ProtocBinCache{protoc.ForPlatform(runtime.GOOS, runtime.GOARCH)}
+	platforms, err := os.ReadDir(filepath.Join(protoc.root, PlatformsDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	for _, entry := range platforms {
+		goos, goarch, ok := strings.Cut(entry.Name(), "_")
+		isCurrent := goos == runtime.GOOS && goarch == runtime.GOARCH
+		if entry.IsDir() && ok && !isCurrent {
+			caches = append(caches, protoc.ForPlatform(goos, goarch))
+		}
+	}
+	for _, cache := range caches {
+		entries, err := os.ReadDir(cache.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, entry := range entries {
+			version := entry.Name()
+			if !entry.IsDir() || version == PlatformsDir || strings.HasPrefix(version, ".") {
+				continue
+			}
+			if _, err := os.Stat(cache.VersionBinPath(version)); err != nil {
+				continue
+			}
+			releases = append(releases, cachedRelease{
+				version: version,
+				goos:    cache.goos,
+				goarch:  cache.goarch,
+				dir:     filepath.Join(cache.path, version),
+			})
+		}
+	}
+	return releases, nil
+}
+
+// Export writes every cached release to w as a gzip-compressed tar bundle,
+// starting with a manifest holding the SHA-256 digest of each file.
+func (protoc *ProtocBinCache) Export(w io.Writer) (*BundleManifest, error) {
+	cached, err := protoc.releases()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &BundleManifest{Created: time.Now().UTC(), Releases: []BundleRelease{}}
+	for _, release := range cached {
+		bundleRelease := BundleRelease{Version: release.version, GOOS: release.goos, GOARCH: release.goarch}
+		err := filepath.WalkDir(release.dir, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(release.dir, filePath)
+			if err != nil {
+				return err
+			}
+			// Imports mark the releases they install.
+			if rel == InstalledMarkerName {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			digest, err := fileDigest(filePath)
+			if err != nil {
+				return err
+			}
+			bundleRelease.Files = append(bundleRelease.Files, BundleFile{
+				Path:   filepath.ToSlash(rel),
+				Mode:   info.Mode().Perm(),
+				Size:   info.Size(),
+				SHA256: digest,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read release %s: %w", release.version, err)
+		}
+		manifest.Releases = append(manifest.Releases, bundleRelease)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tarWriter, BundleManifestName, 0644, manifest.Created, content); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	for i, release := range manifest.Releases {
+		for _, file := range release.Files {
+			content, err := os.ReadFile(filepath.Join(cached[i].dir, filepath.FromSlash(file.Path)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+			}
+			name := path.Join(release.Dir(), file.Path)
+			if err := writeTarFile(tarWriter, name, file.Mode, manifest.Created, content); err != nil {
+				return nil, fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return manifest, nil
+}
+
+// Import reads a bundle written by Export and adds its releases to the
+// cache. Every file is checked against the digest in the manifest, and the
+// releases for the current platform with the Checker, before any release is
+// moved into place, and releases already cached are left untouched. When the cache has a Verifier, the releases must hold the
+// archive they were extracted from, as kept by caches with a Verifier, whose
+// signature is verified and whose content replaces the files of the release.
+// It returns the releases imported.
+func (protoc *ProtocBinCache) Import(r io.Reader) ([]BundleRelease, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+	header, err := tarReader.Next()
+	if err != nil || header.Name != BundleManifestName {
+		return nil, fmt.Errorf("invalid bundle: %s must be the first entry", BundleManifestName)
+	}
+	var manifest BundleManifest
+	if err := json.NewDecoder(tarReader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+	expected := map[string]BundleFile{}
+	releaseDirs := map[string]bool{}
+	for _, release := range manifest.Releases {
+		if !validPathElement(release.Version) || !validPathElement(release.GOOS) ||
+			!validPathElement(release.GOARCH) || strings.Contains(release.GOOS, "_") || releaseDirs[release.Dir()] {
+			return nil, fmt.Errorf("invalid bundle manifest: invalid release %s %s/%s", release.Version, release.GOOS, release.GOARCH)
+		}
+		releaseDirs[release.Dir()] = true
+		// The binary must be part of the release for the cache to use it.
+		hasBinary := false
+		for _, file := range release.Files {
+			if !fs.ValidPath(file.Path) || file.Path == "." {
+				return nil, fmt.Errorf("invalid bundle manifest: invalid file %q", file.Path)
+			}
+			hasBinary = hasBinary || file.Path == releaseBinPath(release.GOOS)
+			expected[path.Join(release.Dir(), file.Path)] = file
+		}
+		if !hasBinary {
+			return nil, fmt.Errorf("invalid bundle manifest: release %s is missing protoc", release.Dir())
+		}
+	}
+
+	if err := os.MkdirAll(protoc.root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Stage the files inside the cache so that they can be renamed into
+	// place.
+	staging, err := os.MkdirTemp(protoc.root, ".import-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		file, ok := expected[header.Name]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: %s is not in the manifest", header.Name)
+		}
+		delete(expected, header.Name)
+		if header.Typeflag != tar.TypeReg || header.Size != file.Size {
+			return nil, fmt.Errorf("invalid bundle: %s does not match the manifest", header.Name)
+		}
+		if err := extractBundleFile(tarReader, filepath.Join(staging, filepath.FromSlash(header.Name)), file); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+	if len(expected) > 0 {
+		missing := make([]string, 0, len(expected))
+		for name := range expected {
+			missing = append(missing, name)
+		}
+		slices.Sort(missing)
+		return nil, fmt.Errorf("invalid bundle: missing %s", strings.Join(missing, ", "))
+	}
+
+	// Verify every release to import before moving any into place.
+	pending := map[string]error{}
+	signedArchives := map[string]string{}
+	for _, release := range manifest.Releases {
+		cache := protoc.ForPlatform(release.GOOS, release.GOARCH)
+		err := cache.Verify(release.Version)
+		if err == nil {
+			continue
+		}
+		pending[release.Dir()] = err
+		src := filepath.Join(staging, filepath.FromSlash(release.Dir()))
+		if protoc.Verifier != nil {
+			signedArchive, err := cache.verifyImport(src, release)
+			if err != nil {
+				return nil, err
+			}
+			signedArchives[release.Dir()] = signedArchive
+		}
+		if err := cache.checkBinary(filepath.Join(src, filepath.FromSlash(releaseBinPath(release.GOOS))), release.Version); err != nil {
+			return nil, fmt.Errorf("release %s failed validation: %w", release.Dir(), err)
+		}
+	}
+
+	var imported []BundleRelease
+	for _, release := range manifest.Releases {
+		cache := protoc.ForPlatform(release.GOOS, release.GOARCH)
+		err, ok := pending[release.Dir()]
+		if !ok {
+			continue
+		}
+		versionDir := filepath.Join(cache.path, release.Version)
+		// Replace corrupt and incomplete releases.
+		if !errors.Is(err, ErrNotCached) {
+			if _, err := cache.quarantine(release.Version); err != nil {
+				return imported, err
+			}
+		}
+		if err := os.MkdirAll(cache.path, os.ModePerm); err != nil {
+			return imported, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		src := filepath.Join(staging, filepath.FromSlash(release.Dir()))
+		if err := writeInstalledMarker(src, filepath.Join(src, filepath.FromSlash(releaseBinPath(release.GOOS))), release.Version, signedArchives[release.Dir()]); err != nil {
+			return imported, err
+		}
+		if err := os.Rename(src, versionDir); err != nil {
+			return imported, fmt.Errorf("failed to import %s: %w", release.Dir(), err)
+		}
+		imported = append(imported, release)
+	}
+	return imported, nil
+}
+
+// verifyImport verifies the signature of the archive of release kept in its
+// SignedArchiveDir, with the release extracted from the bundle in dir. The
+// files of the release are then replaced with the content of the archive, so
+// that only files whose signature was verified are cached. It returns the
+// path of the archive in the release.
+func (protoc *ProtocBinCache) verifyImport(dir string, release BundleRelease) (string, error) {
+	var signedArchives []string
+	for _, file := range release.Files {
+		if path.Dir(file.Path) == SignedArchiveDir {
+			signedArchives = append(signedArchives, file.Path)
+		}
+	}
+	if len(signedArchives) != 1 {
+		return "", fmt.Errorf("release %s has no signed archive to verify", release.Dir())
+	}
+	signedArchive := signedArchives[0]
+	archiveURL, err := protoc.ResolveURL(release.Version, protoc.goos, protoc.goarch)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve URL: %w", err)
+	}
+	url := archiveURL.String()
+	if name := path.Base(signedArchive); name != assetName(url) {
+		return "", fmt.Errorf("signed archive of release %s is %s, expected %s", release.Dir(), name, assetName(url))
+	}
+	archivePath := filepath.Join(dir, filepath.FromSlash(signedArchive))
+	if err := protoc.Verifier.VerifyArchive(url, archivePath); err != nil {
+		return "", fmt.Errorf("failed to verify release %s: %w", release.Dir(), err)
+	}
+
+	extracted := dir + ".verified"
+	if err := downloader.Extract(archivePath, assetName(url), "", extracted, downloader.DefaultLimits); err != nil {
+		return "", fmt.Errorf("failed to extract signed archive of release %s: %w", release.Dir(), err)
+	}
+	if _, err := installRawBinary(extracted, url, protoc.goos); err != nil {
+		return "", err
+	}
+	if err := os.Rename(filepath.Join(dir, SignedArchiveDir), filepath.Join(extracted, SignedArchiveDir)); err != nil {
+		return "", fmt.Errorf("failed to keep signed archive: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(extracted, dir); err != nil {
+		return "", fmt.Errorf("failed to stage release %s: %w", release.Dir(), err)
+	}
+	return signedArchive, nil
+}
+
+// extractBundleFile writes the content read from r to dst and verifies it
+// against the digest of file.
+func extractBundleFile(r io.Reader, dst string, file BundleFile) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, file.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hash), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); digest != file.SHA256 {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", file.SHA256, digest)
+	}
+	return nil
+}
+
+// validPathElement reports whether name can safely be used as a single path
+// element.
+func validPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func writeTarFile(w *tar.Writer, name string, mode fs.FileMode, modTime time.Time, content []byte) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(content)),
+		ModTime:  modTime,
+	}
+	if err := w.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
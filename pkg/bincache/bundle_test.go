@@ -0,0 +1,280 @@
+package bincache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeRelease creates the files of a release in the cache of goos/goarch.
+func writeRelease(t *testing.T, cache *ProtocBinCache, goos, goarch, version string) {
+	t.Helper()
+	platformCache := cache.ForPlatform(goos, goarch)
+	binPath := platformCache.VersionBinPath(version)
+	includePath := filepath.Join(platformCache.Dir(), version, "include", "google", "protobuf", "empty.proto")
+	for path, mode := range map[string]os.FileMode{binPath: 0755, includePath: 0644} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(goos+goarch+version+filepath.Base(path)), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProtocBinCache_ExportImport(t *testing.T) {
+	source := NewProtocBinCache(t.TempDir())
+	writeRelease(t, source, runtime.GOOS, runtime.GOARCH, "32.1")
+	writeRelease(t, source, "plan9", "arm", "31.0")
+	// Interrupted downloads are not exported.
+	if err := os.MkdirAll(filepath.Join(source.Dir(), "30.0", "include"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var bundle bytes.Buffer
+	manifest, err := source.Export(&bundle)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(manifest.Releases) != 2 {
+		t.Fatalf("Expected 2 releases, got %+v", manifest.Releases)
+	}
+
+	target := NewProtocBinCache(t.TempDir())
+	checker := &mockBinaryChecker{}
+	target.Checker = checker
+	imported, err := target.Import(bytes.NewReader(bundle.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Errorf("Expected 2 releases imported, got %+v", imported)
+	}
+	if checker.callCount != 1 {
+		t.Errorf("Expected the release of the current platform to be checked, got %d checks", checker.callCount)
+	}
+	for _, binPath := range []string{
+		target.VersionBinPath("32.1"),
+		target.ForPlatform("plan9", "arm").VersionBinPath("31.0"),
+	} {
+		info, err := os.Stat(binPath)
+		if err != nil {
+			t.Errorf("Expected protoc at %s, got: %v", binPath, err)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+			t.Errorf("Expected %s to be executable, got %v", binPath, info.Mode())
+		}
+	}
+	entries, err := os.ReadDir(target.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".import-") {
+			t.Errorf("Expected staging directory to be removed, found %s", entry.Name())
+		}
+	}
+
+	// Releases already cached are left untouched.
+	imported, err = target.Import(bytes.NewReader(bundle.Bytes()))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(imported) != 0 {
+		t.Errorf("Expected no release imported, got %+v", imported)
+	}
+}
+
+func TestProtocBinCache_Import_CheckFails(t *testing.T) {
+	source := NewProtocBinCache(t.TempDir())
+	writeRelease(t, source, runtime.GOOS, runtime.GOARCH, "32.1")
+	var bundle bytes.Buffer
+	if _, err := source.Export(&bundle); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	target := NewProtocBinCache(t.TempDir())
+	target.Checker = &mockBinaryChecker{err: errors.New("exec format error")}
+	imported, err := target.Import(&bundle)
+	expectedErr := "release " + runtime.GOOS + "_" + runtime.GOARCH + "/32.1 failed validation: exec format error"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected error %q, got: %v", expectedErr, err)
+	}
+	if len(imported) != 0 {
+		t.Errorf("Expected no release imported, got %+v", imported)
+	}
+	if _, err := os.Stat(filepath.Join(target.Dir(), "32.1")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the release not to be imported, got: %v", err)
+	}
+}
+
+func TestProtocBinCache_Import_Verifier(t *testing.T) {
+	testCases := map[string]struct {
+		sourceVerified bool
+		verifierErr    error
+		expectedErr    string
+	}{
+		"verified": {sourceVerified: true},
+		"invalid signature": {
+			sourceVerified: true,
+			verifierErr:    errors.New("invalid signature"),
+			expectedErr:    "failed to verify release " + runtime.GOOS + "_" + runtime.GOARCH + "/25.3: invalid signature",
+		},
+		"unsigned release": {
+			expectedErr: "release " + runtime.GOOS + "_" + runtime.GOARCH + "/25.3 has no signed archive to verify",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			newCache := func() *ProtocBinCache {
+				cache, _ := newTestInstallCache(t)
+				// Released as a single binary, so that the archive extracts
+				// to the binary.
+				cache.URLResolver = &mockURLResolver{
+					url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc"},
+				}
+				return cache
+			}
+			source := newCache()
+			if tc.sourceVerified {
+				source.Verifier = &mockArchiveVerifier{}
+			}
+			if _, err := source.BinPath("v25.3"); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			var bundle bytes.Buffer
+			if _, err := source.Export(&bundle); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			target := newCache()
+			verifier := &mockArchiveVerifier{err: tc.verifierErr}
+			target.Verifier = verifier
+			imported, err := target.Import(&bundle)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.expectedErr, err)
+				}
+				if _, err := os.Stat(target.VersionBinPath("25.3")); err == nil {
+					t.Errorf("Expected the release not to be imported")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if len(imported) != 1 || verifier.lastURL != "https://example.com/protoc" {
+				t.Errorf("Expected the release to be verified and imported, got %+v", imported)
+			}
+			if err := target.Validate("25.3"); err != nil {
+				t.Errorf("Expected the imported release to be valid, got: %v", err)
+			}
+		})
+	}
+}
+
+// writeBundle writes a bundle with the given manifest and files, which do not
+// need to match it.
+func writeBundle(t *testing.T, manifest BundleManifest, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTarFile(tarWriter, BundleManifestName, 0644, manifest.Created, content); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := writeTarFile(tarWriter, name, 0755, manifest.Created, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestProtocBinCache_Import_Invalid(t *testing.T) {
+	binFile := BundleFile{Path: "bin/protoc", Mode: 0755, Size: 6, SHA256: digest("protoc")}
+	release := func(files ...BundleFile) BundleManifest {
+		return BundleManifest{Releases: []BundleRelease{{Version: "32.1", GOOS: "linux", GOARCH: "amd64", Files: files}}}
+	}
+	testCases := map[string]struct {
+		manifest BundleManifest
+		files    map[string]string
+		expected string
+	}{
+		"digest mismatch": {
+			manifest: release(binFile),
+			files:    map[string]string{"linux_amd64/32.1/bin/protoc": "evil!!"},
+			expected: "digest mismatch",
+		},
+		"size mismatch": {
+			manifest: release(binFile),
+			files:    map[string]string{"linux_amd64/32.1/bin/protoc": "evil"},
+			expected: "does not match the manifest",
+		},
+		"missing file": {
+			manifest: release(binFile),
+			expected: "missing linux_amd64/32.1/bin/protoc",
+		},
+		"unlisted file": {
+			manifest: release(binFile),
+			files: map[string]string{
+				"linux_amd64/32.1/bin/protoc": "protoc",
+				"linux_amd64/32.1/bin/extra":  "extra",
+			},
+			expected: "not in the manifest",
+		},
+		"missing binary": {
+			manifest: release(BundleFile{Path: "include/empty.proto", Size: 5, SHA256: digest("empty")}),
+			files:    map[string]string{"linux_amd64/32.1/include/empty.proto": "empty"},
+			expected: "missing protoc",
+		},
+		"path traversal": {
+			manifest: release(binFile, BundleFile{Path: "../../../evil", Size: 4, SHA256: digest("evil")}),
+			files: map[string]string{
+				"linux_amd64/32.1/bin/protoc": "protoc",
+				"../evil":                     "evil",
+			},
+			expected: `invalid file "../../../evil"`,
+		},
+		"invalid version": {
+			manifest: BundleManifest{Releases: []BundleRelease{{Version: "..", GOOS: "linux", GOARCH: "amd64"}}},
+			expected: "invalid release",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache := NewProtocBinCache(t.TempDir())
+			_, err := cache.Import(bytes.NewReader(writeBundle(t, tc.manifest, tc.files)))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("Expected error containing %q, got: %v", tc.expected, err)
+			}
+			if _, err := os.Stat(cache.ForPlatform("linux", "amd64").VersionBinPath("32.1")); err == nil {
+				t.Errorf("Expected nothing to be imported")
+			}
+		})
+	}
+}
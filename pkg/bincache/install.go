@@ -0,0 +1,309 @@
+package bincache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// InstalledMarkerName is the file of a cached release recording the size,
+	// modification time and digest of its binary, written once the release
+	// is installed.
+	InstalledMarkerName = ".installed.json"
+	// QuarantineDir is the directory of the cache where corrupt and
+	// incomplete releases are moved before they are downloaded again.
+	QuarantineDir = ".quarantine"
+	// SignedArchiveDir is the directory of a cached release keeping the
+	// archive it was extracted from, when the cache has a Verifier, so that
+	// the signature of exported releases can be verified on import.
+	SignedArchiveDir = ".signed"
+)
+
+// ErrNotCached is returned by Validate when a release is not in the cache.
+var ErrNotCached = errors.New("release not cached")
+
+// ErrNotVerified is returned by Validate when the cache has a Verifier and a
+// release was cached without verifying its signature.
+var ErrNotVerified = errors.New("release signature not verified")
+
+// BinaryChecker checks that an installed protoc binary works and is of the
+// expected version.
+type BinaryChecker interface {
+	CheckBinary(binPath, version string) error
+}
+
+// VersionChecker checks binaries by running protoc --version.
+type VersionChecker struct{}
+
+// CheckBinary runs protoc --version and compares the version reported with
+// version, see CheckOutput.
+func (c VersionChecker) CheckBinary(binPath, version string) error {
+	output, err := exec.Command(binPath, "--version").Output()
+	if err != nil {
+		return fmt.Errorf("failed to run protoc --version: %w", err)
+	}
+	return c.CheckOutput(output, version)
+}
+
+// CheckOutput compares the version reported in the output of protoc
+// --version with version. Releases before v21 report a 3.x version, such as
+// 3.20.3 for v20.3.
+func (VersionChecker) CheckOutput(output []byte, version string) error {
+	reported := strings.TrimPrefix(strings.TrimSpace(string(output)), "libprotoc ")
+	if reported != version && reported != "3."+version {
+		return fmt.Errorf("protoc --version reported %q, expected %s", strings.TrimSpace(string(output)), version)
+	}
+	return nil
+}
+
+// installedMarker is the content of the InstalledMarkerName file.
+type installedMarker struct {
+	Version string    `json:"version"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+	// SignedArchive is the slash-separated path of the archive of the
+	// release, relative to its directory, when its signature was verified.
+	SignedArchive string `json:"signedArchive,omitempty"`
+}
+
+// Validate returns nil if the release of version is installed and its binary
+// matches the size and modification time in the installed marker, or an
+// error wrapping ErrNotCached if there is no release at all. Binaries whose
+// modification time changed are hashed and compared with the digest in the
+// marker instead. Releases cached before markers existed are checked
+// with the Checker and marked when they pass. When the cache has a Verifier,
+// releases whose signature was not verified when they were cached, such as
+// releases cached before a key was configured, fail with ErrNotVerified.
+func (protoc *ProtocBinCache) Validate(version string) error {
+	return protoc.validate(version, false, true)
+}
+
+// Check is like Validate, but leaves the cache untouched: releases cached
+// before markers existed are not marked, and the modification time of
+// binaries is not recorded. It suits reports, such as go-protoc version.
+func (protoc *ProtocBinCache) Check(version string) error {
+	return protoc.validate(version, false, false)
+}
+
+// Verify is like Check, but always compares the digest of the binary with
+// the one in the installed marker.
+func (protoc *ProtocBinCache) Verify(version string) error {
+	return protoc.validate(version, true, false)
+}
+
+// validate implements Validate, Check and Verify. The digest is always
+// compared when full is set, and the installed marker is written when mark
+// is set.
+func (protoc *ProtocBinCache) validate(version string, full, mark bool) error {
+	versionDir := filepath.Join(protoc.path, version)
+	binPath := protoc.VersionBinPath(version)
+	info, err := os.Stat(binPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, dirErr := os.Stat(versionDir); errors.Is(dirErr, fs.ErrNotExist) {
+			return ErrNotCached
+		}
+		return fmt.Errorf("incomplete release: protoc binary is missing")
+	} else if err != nil {
+		return fmt.Errorf("failed to check binary: %w", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(versionDir, InstalledMarkerName))
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := protoc.checkBinary(binPath, version); err != nil {
+			return err
+		}
+		if mark {
+			if err := writeInstalledMarker(versionDir, binPath, version, ""); err != nil {
+				return err
+			}
+		}
+		return protoc.checkSigned(versionDir, installedMarker{})
+	} else if err != nil {
+		return fmt.Errorf("failed to read installed marker: %w", err)
+	}
+	var marker installedMarker
+	if err := json.Unmarshal(content, &marker); err != nil {
+		return fmt.Errorf("invalid installed marker: %w", err)
+	}
+	if info.Size() != marker.Size {
+		return fmt.Errorf("protoc binary is %d bytes, expected %d", info.Size(), marker.Size)
+	}
+	if !full && info.ModTime().Equal(marker.ModTime) {
+		return protoc.checkSigned(versionDir, marker)
+	}
+	digest, err := fileDigest(binPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash binary: %w", err)
+	}
+	if digest != marker.SHA256 {
+		return fmt.Errorf("protoc binary digest is %s, expected %s", digest, marker.SHA256)
+	}
+	if mark && !info.ModTime().Equal(marker.ModTime) {
+		// Record the new modification time so that the binary is not hashed
+		// again. Read-only caches keep working without it.
+		writeInstalledMarker(versionDir, binPath, version, marker.SignedArchive)
+	}
+	return protoc.checkSigned(versionDir, marker)
+}
+
+// checkSigned checks that the release in dir was verified when it was
+// cached, if the cache has a Verifier.
+func (protoc *ProtocBinCache) checkSigned(dir string, marker installedMarker) error {
+	if protoc.Verifier == nil {
+		return nil
+	}
+	if marker.SignedArchive == "" {
+		return ErrNotVerified
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(marker.SignedArchive))); err != nil {
+		return fmt.Errorf("%w: signed archive is missing", ErrNotVerified)
+	}
+	return nil
+}
+
+// checkBinary checks the binary with the Checker, unless it is for another
+// platform and cannot run.
+func (protoc *ProtocBinCache) checkBinary(binPath, version string) error {
+	if protoc.Checker == nil || protoc.goos != runtime.GOOS || protoc.goarch != runtime.GOARCH {
+		return nil
+	}
+	return protoc.Checker.CheckBinary(binPath, version)
+}
+
+// writeInstalledMarker records the size, modification time and digest of the
+// binary of the release in dir, and the path of its signed archive, if any.
+func writeInstalledMarker(dir, binPath, version, signedArchive string) error {
+	info, err := os.Stat(binPath)
+	if err != nil {
+		return err
+	}
+	digest, err := fileDigest(binPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash binary: %w", err)
+	}
+	content, err := json.MarshalIndent(installedMarker{
+		Version:       version,
+		Size:          info.Size(),
+		ModTime:       info.ModTime(),
+		SHA256:        digest,
+		SignedArchive: signedArchive,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, InstalledMarkerName), append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write installed marker: %w", err)
+	}
+	return nil
+}
+
+// quarantine moves the release of version out of the way, into the
+// QuarantineDir of the cache, so that it can be downloaded again while
+// remaining available for inspection.
+func (protoc *ProtocBinCache) quarantine(version string) (string, error) {
+	dir := filepath.Join(protoc.root, QuarantineDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	dst := filepath.Join(dir, fmt.Sprintf("%s_%s-%s-%d", protoc.goos, protoc.goarch, version, time.Now().UnixNano()))
+	if err := os.Rename(filepath.Join(protoc.path, version), dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to quarantine release %s: %w", version, err)
+	}
+	return dst, nil
+}
+
+// install downloads the release at url into a staging directory, checks it
+// and moves it into place, so that interrupted or failed installations never
+// leave a release in the cache.
+func (protoc *ProtocBinCache) install(version, url string) error {
+	if err := os.MkdirAll(protoc.path, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(protoc.path, ".download-"+version+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := protoc.downloadAndExtract(url, staging); err != nil {
+		return fmt.Errorf("failed to download and extract: %w", err)
+	}
+
+	binPath, err := installRawBinary(staging, url, protoc.goos)
+	if err != nil {
+		return err
+	}
+	if err := protoc.checkBinary(binPath, version); err != nil {
+		return fmt.Errorf("release %s failed validation: %w", version, err)
+	}
+	signedArchive := ""
+	if protoc.Verifier != nil {
+		signedArchive = path.Join(SignedArchiveDir, assetName(url))
+	}
+	if err := writeInstalledMarker(staging, binPath, version, signedArchive); err != nil {
+		return err
+	}
+
+	if err := os.Rename(staging, filepath.Join(protoc.path, version)); err != nil {
+		// Another process may have installed it concurrently.
+		if protoc.Validate(version) == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to install release %s: %w", version, err)
+	}
+	return nil
+}
+
+// installRawBinary moves the binary of releases published as a single
+// binary, which are extracted under their name, to the path of the protoc
+// binary of the release extracted from url in dir. It returns that path.
+func installRawBinary(dir, url, goos string) (string, error) {
+	binPath := filepath.Join(dir, filepath.FromSlash(releaseBinPath(goos)))
+	rawPath := filepath.Join(dir, "bin", assetName(url))
+	if _, err := os.Stat(binPath); errors.Is(err, fs.ErrNotExist) && rawPath != binPath {
+		if err := os.Rename(rawPath, binPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to install binary: %w", err)
+		}
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		return "", fmt.Errorf("binary not found after extraction: %w", err)
+	}
+	return binPath, nil
+}
+
+// keepArchive copies the verified archive at archivePath, downloaded from
+// url, into the SignedArchiveDir of the release in dir.
+func keepArchive(archivePath, url, dir string) error {
+	dst := filepath.Join(dir, SignedArchiveDir, assetName(url))
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to keep signed archive: %w", err)
+	}
+	src, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to keep signed archive: %w", err)
+	}
+	defer src.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to keep signed archive: %w", err)
+	}
+	_, err = io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to keep signed archive: %w", err)
+	}
+	return nil
+}
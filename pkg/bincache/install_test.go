@@ -0,0 +1,347 @@
+package bincache
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockBinaryChecker struct {
+	err       error
+	callCount int
+}
+
+func (m *mockBinaryChecker) CheckBinary(binPath, version string) error {
+	m.callCount++
+	return m.err
+}
+
+func newTestInstallCache(t *testing.T) (*ProtocBinCache, *mockZipDownloader) {
+	t.Helper()
+	downloader := &mockZipDownloader{}
+	cache := NewProtocBinCache(t.TempDir())
+	cache.VersionResolver = &mockVersionResolver{version: "25.3"}
+	cache.URLResolver = &mockURLResolver{
+		url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
+	}
+	cache.ZipDownloader = downloader
+	cache.Checker = nil
+	return cache, downloader
+}
+
+func quarantined(t *testing.T, cache *ProtocBinCache) []os.DirEntry {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(cache.root, QuarantineDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestProtocBinCache_BinPath_SelfHealing(t *testing.T) {
+	testCases := map[string]struct {
+		damage func(t *testing.T, cache *ProtocBinCache)
+	}{
+		"corrupt binary": {
+			damage: func(t *testing.T, cache *ProtocBinCache) {
+				if err := os.WriteFile(cache.VersionBinPath("25.3"), []byte("mock protoc binarz"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"truncated binary": {
+			damage: func(t *testing.T, cache *ProtocBinCache) {
+				if err := os.Truncate(cache.VersionBinPath("25.3"), 4); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"missing binary": {
+			damage: func(t *testing.T, cache *ProtocBinCache) {
+				if err := os.Remove(cache.VersionBinPath("25.3")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		"invalid marker": {
+			damage: func(t *testing.T, cache *ProtocBinCache) {
+				if err := os.WriteFile(filepath.Join(cache.Dir(), "25.3", InstalledMarkerName), []byte("{"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache, downloader := newTestInstallCache(t)
+			if _, err := cache.BinPath("v25.3"); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			tc.damage(t, cache)
+
+			binPath, err := cache.BinPath("v25.3")
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if downloader.callCount != 2 {
+				t.Errorf("Expected the release to be downloaded again, got %d downloads", downloader.callCount)
+			}
+			content, err := os.ReadFile(binPath)
+			if err != nil || string(content) != "mock protoc binary" {
+				t.Errorf("Expected the binary to be restored, got %q, %v", content, err)
+			}
+			if err := cache.Validate("25.3"); err != nil {
+				t.Errorf("Expected the release to be valid, got: %v", err)
+			}
+			if entries := quarantined(t, cache); len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), runtime.GOOS+"_"+runtime.GOARCH+"-25.3-") {
+				t.Errorf("Expected the damaged release to be quarantined, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestProtocBinCache_Validate_ModTime(t *testing.T) {
+	cache, _ := newTestInstallCache(t)
+	binPath, err := cache.BinPath("v25.3")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	info, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Binaries that were only touched are hashed and marked again.
+	touched := info.ModTime().Add(time.Hour)
+	if err := os.Chtimes(binPath, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Validate("25.3"); err != nil {
+		t.Errorf("Expected the touched release to be valid, got: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(cache.Dir(), "25.3", InstalledMarkerName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marker installedMarker
+	if err := json.Unmarshal(content, &marker); err != nil {
+		t.Fatal(err)
+	}
+	if !marker.ModTime.Equal(touched) {
+		t.Errorf("Expected the marker to record %v, got %v", touched, marker.ModTime)
+	}
+
+	// Changes that keep the size and modification time are only found by
+	// Verify.
+	if err := os.WriteFile(binPath, []byte("mock protoc binarz"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(binPath, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Validate("25.3"); err != nil {
+		t.Errorf("Expected Validate to trust the marker, got: %v", err)
+	}
+	if err := cache.Verify("25.3"); err == nil || !strings.Contains(err.Error(), "protoc binary digest is") {
+		t.Errorf("Expected Verify to report the digest mismatch, got: %v", err)
+	}
+}
+
+func TestProtocBinCache_BinPath_LegacyRelease(t *testing.T) {
+	cache, downloader := newTestInstallCache(t)
+	checker := &mockBinaryChecker{}
+	cache.Checker = checker
+	writeRelease(t, cache, runtime.GOOS, runtime.GOARCH, "25.3")
+
+	if _, err := cache.BinPath("v25.3"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if downloader.callCount != 0 {
+		t.Errorf("Expected the cached release to be used, got %d downloads", downloader.callCount)
+	}
+	if checker.callCount != 1 {
+		t.Errorf("Expected the cached release to be checked once, got %d checks", checker.callCount)
+	}
+	if _, err := os.Stat(filepath.Join(cache.Dir(), "25.3", InstalledMarkerName)); err != nil {
+		t.Errorf("Expected the cached release to be marked, got: %v", err)
+	}
+
+	// Marked releases are not checked again.
+	if _, err := cache.BinPath("v25.3"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if checker.callCount != 1 {
+		t.Errorf("Expected the marked release not to be checked, got %d checks", checker.callCount)
+	}
+}
+
+func TestProtocBinCache_Check_LeavesCacheUntouched(t *testing.T) {
+	cache, _ := newTestInstallCache(t)
+	checker := &mockBinaryChecker{}
+	cache.Checker = checker
+	writeRelease(t, cache, runtime.GOOS, runtime.GOARCH, "25.3")
+	markerPath := filepath.Join(cache.Dir(), "25.3", InstalledMarkerName)
+
+	for name, check := range map[string]func(string) error{"Check": cache.Check, "Verify": cache.Verify} {
+		if err := check("25.3"); err != nil {
+			t.Errorf("Expected %s to pass, got: %v", name, err)
+		}
+		if _, err := os.Stat(markerPath); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s not to mark the release, got: %v", name, err)
+		}
+	}
+	if checker.callCount != 2 {
+		t.Errorf("Expected the unmarked release to be checked every time, got %d checks", checker.callCount)
+	}
+
+	// Touched binaries are hashed without recording their modification
+	// time.
+	if err := cache.Validate("25.3"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(markerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	touched := time.Now().Add(time.Hour)
+	if err := os.Chtimes(cache.VersionBinPath("25.3"), touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Check("25.3"); err != nil {
+		t.Errorf("Expected the touched release to be valid, got: %v", err)
+	}
+	after, err := os.ReadFile(markerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("Expected the marker to be unchanged, got %s", after)
+	}
+}
+
+func TestProtocBinCache_BinPath_UnverifiedRelease(t *testing.T) {
+	cache, downloader := newTestInstallCache(t)
+	// Cached before a key was configured.
+	if _, err := cache.BinPath("v25.3"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	verifier := &mockArchiveVerifier{}
+	cache.Verifier = verifier
+
+	if err := cache.Validate("25.3"); !errors.Is(err, ErrNotVerified) {
+		t.Errorf("Expected ErrNotVerified, got: %v", err)
+	}
+	if _, err := cache.BinPath("v25.3"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if downloader.callCount != 2 || verifier.lastURL == "" {
+		t.Errorf("Expected the release to be downloaded and verified again, got %d downloads", downloader.callCount)
+	}
+	if err := cache.Validate("25.3"); err != nil {
+		t.Errorf("Expected the release to be valid, got: %v", err)
+	}
+	if entries := quarantined(t, cache); len(entries) != 1 {
+		t.Errorf("Expected the unverified release to be quarantined, got %v", entries)
+	}
+}
+
+func TestProtocBinCache_BinPath_CheckFailed(t *testing.T) {
+	cache, downloader := newTestInstallCache(t)
+	cache.Checker = &mockBinaryChecker{err: errors.New("exec format error")}
+	writeRelease(t, cache, runtime.GOOS, runtime.GOARCH, "25.3")
+
+	_, err := cache.BinPath("v25.3")
+	if err == nil || !strings.Contains(err.Error(), "release 25.3 failed validation: exec format error") {
+		t.Errorf("Expected validation error, got: %v", err)
+	}
+	if downloader.callCount != 1 {
+		t.Errorf("Expected the release to be downloaded again, got %d downloads", downloader.callCount)
+	}
+	if len(quarantined(t, cache)) != 1 {
+		t.Errorf("Expected the cached release to be quarantined")
+	}
+	// Failed installations leave nothing in the cache.
+	entries, err := os.ReadDir(cache.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != QuarantineDir {
+			t.Errorf("Expected nothing but quarantined releases in the cache, got %s", entry.Name())
+		}
+	}
+}
+
+func TestProtocBinCache_BinPath_OtherPlatformNotChecked(t *testing.T) {
+	cache, _ := newTestInstallCache(t)
+	checker := &mockBinaryChecker{err: errors.New("exec format error")}
+	cache.Checker = checker
+	platformCache := cache.ForPlatform("plan9", "arm")
+
+	if _, err := platformCache.BinPath("v25.3"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if checker.callCount != 0 {
+		t.Errorf("Expected binaries of other platforms not to be checked, got %d checks", checker.callCount)
+	}
+}
+
+func TestVersionChecker_CheckBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on Windows")
+	}
+	testCases := map[string]struct {
+		output      string
+		version     string
+		expectedErr string
+	}{
+		"matching version": {output: "libprotoc 25.3", version: "25.3"},
+		"legacy version":   {output: "libprotoc 3.20.3", version: "20.3"},
+		"other version": {
+			output:      "libprotoc 24.4",
+			version:     "25.3",
+			expectedErr: `protoc --version reported "libprotoc 24.4", expected 25.3`,
+		},
+		"not protoc": {
+			output:      "hello",
+			version:     "25.3",
+			expectedErr: `protoc --version reported "hello", expected 25.3`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			binPath := filepath.Join(t.TempDir(), "protoc")
+			script := "#!/bin/sh\necho '" + tc.output + "'\n"
+			if err := os.WriteFile(binPath, []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			err := VersionChecker{}.CheckBinary(binPath, tc.version)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestVersionChecker_CheckBinary_NotExecutable(t *testing.T) {
+	binPath := filepath.Join(t.TempDir(), "protoc")
+	if err := os.WriteFile(binPath, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := VersionChecker{}.CheckBinary(binPath, "25.3")
+	if err == nil || !strings.Contains(err.Error(), "failed to run protoc --version") {
+		t.Errorf("Expected run error, got: %v", err)
+	}
+}
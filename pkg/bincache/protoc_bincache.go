@@ -1,12 +1,15 @@
 package bincache
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/esdandreu/go-protoc/pkg/downloader"
 	"github.com/esdandreu/go-protoc/pkg/releases"
@@ -14,6 +17,11 @@ import (
 
 const DefaultProtocBinCachePrefix = "go-protoc"
 
+// PlatformsDir is the directory of the cache holding the releases of
+// platforms other than the current one, in a <goos>_<goarch> subdirectory
+// each, laid out like the cache itself.
+const PlatformsDir = "platforms"
+
 type VersionResolver interface {
 	// ResolveVersion returns the version string for a given tag. As a special
 	// case, if the tag is "latest", the latest version should be returned.
@@ -22,23 +30,57 @@ type VersionResolver interface {
 	ResolveVersion(tag string) (string, error)
 }
 
+// VersionLister is implemented by version resolvers that can list the
+// published protoc releases, such as releases.ProtocVersionResolver.
+type VersionLister interface {
+	// ListVersions returns the versions of the published releases, without
+	// the 'v' prefix.
+	ListVersions() ([]string, error)
+}
+
 type URLResolver interface {
 	// ResolveURL returns the URL to the protoc binary for a given version,
 	// operating system, and architecture.
 	ResolveURL(version, goos, goarch string) (*url.URL, error)
 }
 
+// ZipDownloader downloads and extracts a release archive, such as
+// downloader.ArchiveDownloader, which supports zip, tar.gz, tar.xz and raw
+// binaries.
 type ZipDownloader interface {
 	DownloadAndExtract(url string, destDir string) error
 }
 
+// ArchiveVerifier verifies a release archive before it is extracted, such as
+// signature.Verifier does.
+type ArchiveVerifier interface {
+	VerifyArchive(url, archivePath string) error
+}
+
+// VerifyingZipDownloader is implemented by downloaders that can verify
+// archives before extracting them, such as downloader.ArchiveDownloader.
+type VerifyingZipDownloader interface {
+	DownloadVerifyAndExtract(url string, destDir string, verify func(zipPath string) error) error
+}
+
 type ProtocBinCache struct {
 	VersionResolver
 	URLResolver
 	ZipDownloader
+	// Verifier, when set, verifies every release downloaded or imported.
+	// Releases that fail verification are not cached, and releases cached
+	// without being verified are downloaded again.
+	Verifier ArchiveVerifier
+	// Checker, when set, checks every release installed for the current
+	// platform. Releases that fail the check are not cached.
+	Checker BinaryChecker
+
 	path   string
 	goos   string
 	goarch string
+	// root is the path of the cache of the current platform, which holds
+	// the caches of other platforms.
+	root string
 }
 
 // NewProtocBinCache creates a new protoc binary cache. Typically constructed
@@ -47,15 +89,19 @@ func NewProtocBinCache(cacheDir string) *ProtocBinCache {
 	return &ProtocBinCache{
 		VersionResolver: releases.NewProtocVersionResolver(),
 		URLResolver:     releases.NewProtocURLResolver(),
-		ZipDownloader:   downloader.NewZipDownloader(),
+		ZipDownloader:   downloader.NewArchiveDownloader(),
+		Checker:         VersionChecker{},
 		path:            path.Join(cacheDir, DefaultProtocBinCachePrefix),
+		root:            path.Join(cacheDir, DefaultProtocBinCachePrefix),
 		goos:            runtime.GOOS,
 		goarch:          runtime.GOARCH,
 	}
 }
 
 // BinPath returns the path to the protoc binary in the cache. It will download
-// the release if it is not already cached.
+// the release if it is not already cached. Cached releases whose binary no
+// longer matches the one installed, or that were never fully installed, are
+// quarantined and downloaded again.
 func (protoc *ProtocBinCache) BinPath(tag string) (string, error) {
 	// Resolve the tag to a version.
 	version, err := protoc.ResolveVersion(tag)
@@ -63,18 +109,16 @@ func (protoc *ProtocBinCache) BinPath(tag string) (string, error) {
 		return "", fmt.Errorf("failed to resolve version: %w", err)
 	}
 
-	// Create version-specific cache directory
-	versionDir := filepath.Join(protoc.path, version)
-	binPath := filepath.Join(versionDir, "bin", "protoc")
-	if runtime.GOOS == "windows" {
-		binPath += ".exe"
-	}
-
-	// Check if binary already exists
-	if _, err := os.Stat(binPath); err == nil {
+	binPath := protoc.VersionBinPath(version)
+	err = protoc.Validate(version)
+	if err == nil {
 		return binPath, nil
-	} else if !os.IsNotExist(err) {
-		return "", fmt.Errorf("failed to check binary: %w", err)
+	}
+	if !errors.Is(err, ErrNotCached) {
+		// Replace corrupt and incomplete releases.
+		if _, err := protoc.quarantine(version); err != nil {
+			return "", err
+		}
 	}
 
 	// Binary doesn't exist, need to download and extract
@@ -82,21 +126,125 @@ func (protoc *ProtocBinCache) BinPath(tag string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to resolve URL: %w", err)
 	}
+	if err := protoc.install(version, downloadURL.String()); err != nil {
+		return "", err
+	}
+	return binPath, nil
+}
 
-	// Create the version directory
-	if err := os.MkdirAll(versionDir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("failed to create cache directory: %w", err)
+// downloadAndExtract extracts the release at url into versionDir, verifying
+// it first when the cache has a verifier. Verified archives are kept in the
+// SignedArchiveDir of the release.
+func (protoc *ProtocBinCache) downloadAndExtract(url, versionDir string) error {
+	if protoc.Verifier == nil {
+		return protoc.DownloadAndExtract(url, versionDir)
+	}
+	downloader, ok := protoc.ZipDownloader.(VerifyingZipDownloader)
+	if !ok {
+		return fmt.Errorf("downloader cannot verify releases")
 	}
+	return downloader.DownloadVerifyAndExtract(url, versionDir, func(zipPath string) error {
+		if err := protoc.Verifier.VerifyArchive(url, zipPath); err != nil {
+			return err
+		}
+		return keepArchive(zipPath, url, versionDir)
+	})
+}
+
+// VersionBinPath returns the path the protoc binary of a resolved version has
+// in the cache, whether it is already cached or not.
+func (protoc *ProtocBinCache) VersionBinPath(version string) string {
+	return filepath.Join(protoc.path, version, filepath.FromSlash(releaseBinPath(protoc.goos)))
+}
 
-	// Download and extract the zip file
-	if err := protoc.DownloadAndExtract(downloadURL.String(), versionDir); err != nil {
-		return "", fmt.Errorf("failed to download and extract: %w", err)
+// releaseBinPath returns the slash-separated path of the protoc binary in a
+// release for goos, which is a WebAssembly module for wasip1.
+func releaseBinPath(goos string) string {
+	switch goos {
+	case "windows":
+		return "bin/protoc.exe"
+	case "wasip1":
+		return "bin/protoc.wasm"
 	}
+	return "bin/protoc"
+}
 
-	// Verify the binary now exists
-	if _, err := os.Stat(binPath); err != nil {
-		return "", fmt.Errorf("binary not found after extraction: %w", err)
+// assetName returns the name of the file downloaded from rawURL.
+func assetName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
 	}
+	return path.Base(rawURL)
+}
 
-	return binPath, nil
+// ListVersions returns the versions of the published protoc releases, as
+// listed by the VersionResolver. When it cannot list them, such as offline,
+// the versions cached for the platform of the cache are returned instead.
+func (protoc *ProtocBinCache) ListVersions() ([]string, error) {
+	var listErr error
+	if lister, ok := protoc.VersionResolver.(VersionLister); ok {
+		versions, err := lister.ListVersions()
+		if err == nil {
+			return versions, nil
+		}
+		listErr = err
+	} else {
+		listErr = errors.New("version resolver cannot list releases")
+	}
+	cached, err := protoc.CachedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, version := range cached {
+		if protoc.Validate(version) == nil {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, listErr
+	}
+	return versions, nil
+}
+
+// CachedVersions returns the versions with a directory in the cache of the
+// platform of the cache, whether their release is complete or not.
+func (protoc *ProtocBinCache) CachedVersions() ([]string, error) {
+	entries, err := os.ReadDir(protoc.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	var versions []string
+	for _, entry := range entries {
+		version := entry.Name()
+		if entry.IsDir() && version != PlatformsDir && !strings.HasPrefix(version, ".") {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// Dir returns the directory where protoc releases are cached.
+func (protoc *ProtocBinCache) Dir() string {
+	return protoc.path
+}
+
+// ForPlatform returns a cache of the protoc releases for another operating
+// system and architecture, which shares the resolvers and downloader of
+// protoc. The releases of the current platform stay at the root of the cache
+// so that existing caches remain valid.
+func (protoc *ProtocBinCache) ForPlatform(goos, goarch string) *ProtocBinCache {
+	cache := *protoc
+	cache.goos, cache.goarch = goos, goarch
+	cache.path = protoc.root
+	if goos != runtime.GOOS || goarch != runtime.GOARCH {
+		cache.path = filepath.Join(protoc.root, PlatformsDir, goos+"_"+goarch)
+	}
+	return &cache
+}
+
+// Platform returns the operating system and architecture of the cached
+// releases.
+func (protoc *ProtocBinCache) Platform() (goos, goarch string) {
+	return protoc.goos, protoc.goarch
 }
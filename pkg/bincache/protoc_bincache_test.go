@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 )
@@ -25,11 +26,14 @@ func (m *mockVersionResolver) ResolveVersion(tag string) (string, error) {
 }
 
 type mockURLResolver struct {
-	url *url.URL
-	err error
+	url        *url.URL
+	err        error
+	lastGoos   string
+	lastGoarch string
 }
 
 func (m *mockURLResolver) ResolveURL(version, goos, goarch string) (*url.URL, error) {
+	m.lastGoos, m.lastGoarch = goos, goarch
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -70,6 +74,9 @@ func TestProtocBinCache_Path(t *testing.T) {
 	if cache.path != expectedPath {
 		t.Errorf("expected path %q, got %q", expectedPath, cache.path)
 	}
+	if cache.Dir() != expectedPath {
+		t.Errorf("expected dir %q, got %q", expectedPath, cache.Dir())
+	}
 	// Creating the cache does not create any directory.
 	_, err := os.Stat(expectedPath)
 	if err == nil {
@@ -88,6 +95,7 @@ func TestProtocBinCache_BinPath_Success(t *testing.T) {
 		url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
 	}
 	cache.ZipDownloader = &mockZipDownloader{}
+	cache.Checker = nil
 	tag := "v25.3"
 
 	binPath, err := cache.BinPath(tag)
@@ -111,6 +119,47 @@ func TestProtocBinCache_BinPath_Success(t *testing.T) {
 	}
 }
 
+func TestProtocBinCache_ForPlatform(t *testing.T) {
+	tempDir := t.TempDir()
+	urlResolver := &mockURLResolver{
+		url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
+	}
+	cache := NewProtocBinCache(tempDir)
+	cache.VersionResolver = &mockVersionResolver{version: "25.3", err: nil}
+	cache.URLResolver = urlResolver
+	cache.ZipDownloader = &mockZipDownloader{}
+	cache.Checker = nil
+
+	// Pick a platform other than the current one, with a binary without
+	// extension like the mock downloader creates.
+	goos := "linux"
+	if runtime.GOOS == "linux" {
+		goos = "darwin"
+	}
+	other := cache.ForPlatform(goos, "arm64")
+	binPath, err := other.BinPath("v25.3")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if urlResolver.lastGoos != goos || urlResolver.lastGoarch != "arm64" {
+		t.Errorf("Expected URL for %s/arm64, got %s/%s", goos, urlResolver.lastGoos, urlResolver.lastGoarch)
+	}
+	expectedPath := filepath.Join(tempDir, DefaultProtocBinCachePrefix, PlatformsDir, goos+"_arm64", "25.3", "bin", "protoc")
+	if binPath != expectedPath {
+		t.Errorf("Expected binary path %q, got %q", expectedPath, binPath)
+	}
+	if gotGoos, gotGoarch := other.Platform(); gotGoos != goos || gotGoarch != "arm64" {
+		t.Errorf("Expected platform %s/arm64, got %s/%s", goos, gotGoos, gotGoarch)
+	}
+
+	// The current platform is cached at the root, even from another
+	// platform's cache.
+	current := other.ForPlatform(runtime.GOOS, runtime.GOARCH)
+	if current.Dir() != cache.Dir() {
+		t.Errorf("Expected dir %q, got %q", cache.Dir(), current.Dir())
+	}
+}
+
 func TestProtocBinCache_BinPath_CachedBinary(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -121,6 +170,7 @@ func TestProtocBinCache_BinPath_CachedBinary(t *testing.T) {
 		url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
 	}
 	cache.ZipDownloader = mockDownloader
+	cache.Checker = nil
 	tag := "v25.3"
 
 	// First call should download
@@ -151,6 +201,7 @@ func TestProtocBinCache_BinPath_VersionResolverError(t *testing.T) {
 	cache.VersionResolver = &mockVersionResolver{err: errors.New("version resolution failed")}
 	cache.URLResolver = &mockURLResolver{}
 	cache.ZipDownloader = &mockZipDownloader{}
+	cache.Checker = nil
 	tag := "invalid-tag"
 
 	_, err := cache.BinPath(tag)
@@ -173,6 +224,7 @@ func TestProtocBinCache_BinPath_URLResolverError(t *testing.T) {
 	cache.VersionResolver = &mockVersionResolver{version: "25.3", err: nil}
 	cache.URLResolver = &mockURLResolver{err: errors.New("URL resolution failed")}
 	cache.ZipDownloader = &mockZipDownloader{}
+	cache.Checker = nil
 	tag := "v25.3"
 
 	_, err := cache.BinPath(tag)
@@ -194,6 +246,7 @@ func TestProtocBinCache_BinPath_DownloadError(t *testing.T) {
 		url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
 	}
 	cache.ZipDownloader = &mockZipDownloader{err: errors.New("download failed")}
+	cache.Checker = nil
 	tag := "v25.3"
 
 	_, err := cache.BinPath(tag)
@@ -205,3 +258,174 @@ func TestProtocBinCache_BinPath_DownloadError(t *testing.T) {
 		t.Errorf("Expected error to start with %q, got: %v", expectedMsg, err)
 	}
 }
+
+func (m *mockZipDownloader) DownloadVerifyAndExtract(url string, destDir string, verify func(zipPath string) error) error {
+	zipFile, err := os.CreateTemp("", "mock-protoc-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipFile.Name())
+	_, err = zipFile.WriteString("mock protoc binary")
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := verify(zipFile.Name()); err != nil {
+		return err
+	}
+	return m.DownloadAndExtract(url, destDir)
+}
+
+type mockArchiveVerifier struct {
+	err     error
+	lastURL string
+}
+
+func (m *mockArchiveVerifier) VerifyArchive(url, archivePath string) error {
+	m.lastURL = url
+	return m.err
+}
+
+func TestProtocBinCache_BinPath_Verifier(t *testing.T) {
+	testCases := map[string]struct {
+		verifierErr error
+		expectedErr string
+	}{
+		"valid signature": {},
+		"invalid signature": {
+			verifierErr: errors.New("invalid signature"),
+			expectedErr: "failed to download and extract: invalid signature",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache := NewProtocBinCache(t.TempDir())
+			cache.VersionResolver = &mockVersionResolver{version: "25.3"}
+			cache.URLResolver = &mockURLResolver{
+				url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"},
+			}
+			cache.ZipDownloader = &mockZipDownloader{}
+			cache.Checker = nil
+			verifier := &mockArchiveVerifier{err: tc.verifierErr}
+			cache.Verifier = verifier
+
+			binPath, err := cache.BinPath("v25.3")
+			if verifier.lastURL != "https://example.com/protoc.zip" {
+				t.Errorf("Expected the release to be verified, got %q", verifier.lastURL)
+			}
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got: %v", tc.expectedErr, err)
+				}
+				if _, err := os.Stat(cache.VersionBinPath("25.3")); err == nil {
+					t.Errorf("Expected the release not to be cached")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if _, err := os.Stat(binPath); err != nil {
+				t.Errorf("Expected binary at %s, got: %v", binPath, err)
+			}
+			if _, err := os.Stat(filepath.Join(cache.Dir(), "25.3", SignedArchiveDir, "protoc.zip")); err != nil {
+				t.Errorf("Expected the signed archive to be kept, got: %v", err)
+			}
+		})
+	}
+}
+
+// rawZipDownloader extracts releases published as a single binary, like
+// downloader.ArchiveDownloader does.
+type rawZipDownloader struct{}
+
+func (rawZipDownloader) DownloadAndExtract(url string, destDir string) error {
+	binPath := filepath.Join(destDir, "bin", path.Base(url))
+	if err := os.MkdirAll(filepath.Dir(binPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(binPath, []byte("mock protoc binary"), 0755)
+}
+
+func TestProtocBinCache_BinPath_RawBinary(t *testing.T) {
+	cache := NewProtocBinCache(t.TempDir())
+	cache.VersionResolver = &mockVersionResolver{version: "25.3"}
+	cache.URLResolver = &mockURLResolver{
+		url: &url.URL{Scheme: "https", Host: "mirror.example.com", Path: "/protoc-25.3-linux-x86_64"},
+	}
+	cache.ZipDownloader = rawZipDownloader{}
+	cache.Checker = nil
+
+	binPath, err := cache.BinPath("v25.3")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if binPath != cache.VersionBinPath("25.3") {
+		t.Errorf("Expected binary at %s, got %s", cache.VersionBinPath("25.3"), binPath)
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		t.Errorf("Expected binary to exist, got: %v", err)
+	}
+}
+
+func TestProtocBinCache_BinPath_WasmModule(t *testing.T) {
+	cache := NewProtocBinCache(t.TempDir())
+	cache.VersionResolver = &mockVersionResolver{version: "25.3"}
+	cache.URLResolver = &mockURLResolver{
+		url: &url.URL{Scheme: "https", Host: "mirror.example.com", Path: "/protoc-25.3.wasm"},
+	}
+	cache.ZipDownloader = rawZipDownloader{}
+	wasm := cache.ForPlatform("wasip1", "wasm")
+
+	binPath, err := wasm.BinPath("v25.3")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := filepath.Join(cache.Dir(), PlatformsDir, "wasip1_wasm", "25.3", "bin", "protoc.wasm")
+	if binPath != expected {
+		t.Errorf("Expected module at %s, got %s", expected, binPath)
+	}
+	if _, err := os.Stat(binPath); err != nil {
+		t.Errorf("Expected module to exist, got: %v", err)
+	}
+}
+
+type mockVersionLister struct {
+	mockVersionResolver
+	versions []string
+	err      error
+}
+
+func (m *mockVersionLister) ListVersions() ([]string, error) {
+	return m.versions, m.err
+}
+
+func TestProtocBinCache_ListVersions(t *testing.T) {
+	cache := NewProtocBinCache(t.TempDir())
+	lister := &mockVersionLister{versions: []string{"32.1", "32.0"}}
+	cache.VersionResolver = lister
+	cache.URLResolver = &mockURLResolver{url: &url.URL{Scheme: "https", Host: "example.com", Path: "/protoc.zip"}}
+	cache.ZipDownloader = &mockZipDownloader{}
+	cache.Checker = nil
+
+	versions, err := cache.ListVersions()
+	if err != nil || !reflect.DeepEqual(versions, lister.versions) {
+		t.Errorf("Expected published versions, got %v (%v)", versions, err)
+	}
+
+	// Offline, the cached versions are listed.
+	lister.err = errors.New("offline")
+	if _, err := cache.ListVersions(); err == nil || err.Error() != "offline" {
+		t.Errorf("Expected listing error without cached versions, got: %v", err)
+	}
+	lister.version = "25.3"
+	if _, err := cache.BinPath("v25.3"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = cache.ListVersions()
+	if err != nil || !reflect.DeepEqual(versions, []string{"25.3"}) {
+		t.Errorf("Expected cached versions, got %v (%v)", versions, err)
+	}
+}
@@ -0,0 +1,330 @@
+package breaking
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/sourceinfo"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Violation is a change that breaks wire or source compatibility with the
+// baseline.
+type Violation struct {
+	// Rule identifies the kind of breaking change, e.g. "FIELD_NO_DELETE".
+	Rule string
+	// File is the proto file the violation was found in, and Line and Column
+	// its 1-based position there. Line and Column are zero when the position
+	// is unknown, as for deleted files.
+	File         string
+	Line, Column int
+	Message      string
+}
+
+func (v Violation) String() string {
+	if v.Line == 0 {
+		return fmt.Sprintf("%s: %s (%s)", v.File, v.Message, v.Rule)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", v.File, v.Line, v.Column, v.Message, v.Rule)
+}
+
+// Field numbers of the descriptor messages, used to build source code info
+// paths.
+const (
+	fileMessageTypeNumber    = 4
+	fileEnumTypeNumber       = 5
+	fileServiceNumber        = 6
+	messageFieldNumber       = 2
+	messageNestedTypeNumber  = 3
+	messageEnumTypeNumber    = 4
+	enumValueNumber          = 2
+	serviceMethodNumber      = 2
+	fieldNameNumber          = 1
+	fieldTypeNumber          = 5
+	methodInputTypeNumber    = 2
+	methodOutputTypeNumber   = 3
+	methodClientStreamNumber = 5
+	methodServerStreamNumber = 6
+	filePackageNumber        = 2
+)
+
+// Check compares current with the baseline against and returns every wire or
+// source incompatible change, ordered by file. Only the files present in
+// against are compared, so imports may be included in either set.
+func Check(against, current *descriptorpb.FileDescriptorSet) []Violation {
+	currentFiles := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, file := range current.GetFile() {
+		currentFiles[file.GetName()] = file
+	}
+
+	var violations []Violation
+	for _, old := range against.GetFile() {
+		file, ok := currentFiles[old.GetName()]
+		if !ok {
+			violations = append(violations, Violation{
+				Rule:    "FILE_NO_DELETE",
+				File:    old.GetName(),
+				Message: "file was deleted",
+			})
+			continue
+		}
+		c := &checker{file: file, locations: sourceinfo.New(file)}
+		c.checkFile(old)
+		violations = append(violations, c.violations...)
+	}
+	slices.SortStableFunc(violations, func(a, b Violation) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return violations
+}
+
+type checker struct {
+	file       *descriptorpb.FileDescriptorProto
+	locations  sourceinfo.Locations
+	violations []Violation
+}
+
+func (c *checker) report(rule string, path []int32, format string, args ...any) {
+	line, column := c.locations.Position(path)
+	c.violations = append(c.violations, Violation{
+		Rule:    rule,
+		File:    c.file.GetName(),
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) checkFile(old *descriptorpb.FileDescriptorProto) {
+	if old.GetPackage() != c.file.GetPackage() {
+		c.report("PACKAGE_NO_CHANGE", []int32{filePackageNumber},
+			"package changed from %q to %q", old.GetPackage(), c.file.GetPackage())
+	}
+
+	messages := indexByName(c.file.GetMessageType())
+	for _, oldMessage := range old.GetMessageType() {
+		i, ok := messages[oldMessage.GetName()]
+		if !ok {
+			c.report("MESSAGE_NO_DELETE", nil, "message %q was deleted", c.qualify(oldMessage.GetName()))
+			continue
+		}
+		path := []int32{fileMessageTypeNumber, int32(i)}
+		c.checkMessage(c.qualify(oldMessage.GetName()), path, oldMessage, c.file.GetMessageType()[i])
+	}
+
+	enums := indexByName(c.file.GetEnumType())
+	for _, oldEnum := range old.GetEnumType() {
+		i, ok := enums[oldEnum.GetName()]
+		if !ok {
+			c.report("ENUM_NO_DELETE", nil, "enum %q was deleted", c.qualify(oldEnum.GetName()))
+			continue
+		}
+		path := []int32{fileEnumTypeNumber, int32(i)}
+		c.checkEnum(c.qualify(oldEnum.GetName()), path, oldEnum, c.file.GetEnumType()[i])
+	}
+
+	services := indexByName(c.file.GetService())
+	for _, oldService := range old.GetService() {
+		i, ok := services[oldService.GetName()]
+		if !ok {
+			c.report("SERVICE_NO_DELETE", nil, "service %q was deleted", c.qualify(oldService.GetName()))
+			continue
+		}
+		path := []int32{fileServiceNumber, int32(i)}
+		c.checkService(c.qualify(oldService.GetName()), path, oldService, c.file.GetService()[i])
+	}
+}
+
+func (c *checker) checkMessage(name string, path []int32, old, message *descriptorpb.DescriptorProto) {
+	fieldsByNumber := make(map[int32]int)
+	fieldsByName := make(map[string]int)
+	for i, field := range message.GetField() {
+		fieldsByNumber[field.GetNumber()] = i
+		fieldsByName[field.GetName()] = i
+	}
+	for _, oldField := range old.GetField() {
+		i, ok := fieldsByNumber[oldField.GetNumber()]
+		if !ok {
+			if j, ok := fieldsByName[oldField.GetName()]; ok {
+				field := message.GetField()[j]
+				c.report("FIELD_SAME_NUMBER", appendPath(path, messageFieldNumber, j),
+					"field %q changed number from %d to %d",
+					name+"."+oldField.GetName(), oldField.GetNumber(), field.GetNumber())
+			} else if !isReservedNumber(message.GetReservedRange(), oldField.GetNumber()) {
+				c.report("FIELD_NO_DELETE", path,
+					"field %d %q was deleted from %q without reserving its number",
+					oldField.GetNumber(), oldField.GetName(), name)
+			}
+			continue
+		}
+		field := message.GetField()[i]
+		fieldPath := appendPath(path, messageFieldNumber, i)
+		fieldName := name + "." + field.GetName()
+		if oldField.GetName() != field.GetName() {
+			c.report("FIELD_SAME_NAME", appendPath(fieldPath, fieldNameNumber),
+				"field %d on %q changed name from %q to %q",
+				field.GetNumber(), name, oldField.GetName(), field.GetName())
+		}
+		if oldType, newType := fieldType(oldField), fieldType(field); oldType != newType {
+			c.report("FIELD_SAME_TYPE", appendPath(fieldPath, fieldTypeNumber),
+				"field %q changed type from %s to %s", fieldName, oldType, newType)
+		}
+		if oldField.GetLabel() != field.GetLabel() {
+			c.report("FIELD_SAME_CARDINALITY", fieldPath,
+				"field %q changed cardinality from %s to %s",
+				fieldName, labelName(oldField.GetLabel()), labelName(field.GetLabel()))
+		}
+	}
+
+	messages := indexByName(message.GetNestedType())
+	for _, oldNested := range old.GetNestedType() {
+		if oldNested.GetOptions().GetMapEntry() {
+			// Map entries are checked through the type of their field.
+			continue
+		}
+		i, ok := messages[oldNested.GetName()]
+		if !ok {
+			c.report("MESSAGE_NO_DELETE", path, "message %q was deleted", name+"."+oldNested.GetName())
+			continue
+		}
+		c.checkMessage(name+"."+oldNested.GetName(), appendPath(path, messageNestedTypeNumber, i),
+			oldNested, message.GetNestedType()[i])
+	}
+
+	enums := indexByName(message.GetEnumType())
+	for _, oldEnum := range old.GetEnumType() {
+		i, ok := enums[oldEnum.GetName()]
+		if !ok {
+			c.report("ENUM_NO_DELETE", path, "enum %q was deleted", name+"."+oldEnum.GetName())
+			continue
+		}
+		c.checkEnum(name+"."+oldEnum.GetName(), appendPath(path, messageEnumTypeNumber, i),
+			oldEnum, message.GetEnumType()[i])
+	}
+}
+
+func (c *checker) checkEnum(name string, path []int32, old, enum *descriptorpb.EnumDescriptorProto) {
+	valuesByNumber := make(map[int32]int)
+	for i, value := range enum.GetValue() {
+		if _, ok := valuesByNumber[value.GetNumber()]; !ok {
+			valuesByNumber[value.GetNumber()] = i
+		}
+	}
+	for _, oldValue := range old.GetValue() {
+		i, ok := valuesByNumber[oldValue.GetNumber()]
+		if !ok {
+			if !isReservedEnumNumber(enum.GetReservedRange(), oldValue.GetNumber()) {
+				c.report("ENUM_VALUE_NO_DELETE", path,
+					"enum value %d %q was deleted from %q without reserving its number",
+					oldValue.GetNumber(), oldValue.GetName(), name)
+			}
+			continue
+		}
+		value := enum.GetValue()[i]
+		if oldValue.GetName() != value.GetName() {
+			c.report("ENUM_VALUE_SAME_NAME", appendPath(path, enumValueNumber, i),
+				"enum value %d on %q changed name from %q to %q",
+				value.GetNumber(), name, oldValue.GetName(), value.GetName())
+		}
+	}
+}
+
+func (c *checker) checkService(name string, path []int32, old, service *descriptorpb.ServiceDescriptorProto) {
+	methods := indexByName(service.GetMethod())
+	for _, oldMethod := range old.GetMethod() {
+		i, ok := methods[oldMethod.GetName()]
+		if !ok {
+			c.report("RPC_NO_DELETE", path, "RPC %q was deleted", name+"."+oldMethod.GetName())
+			continue
+		}
+		method := service.GetMethod()[i]
+		methodPath := appendPath(path, serviceMethodNumber, i)
+		methodName := name + "." + method.GetName()
+		if oldMethod.GetInputType() != method.GetInputType() {
+			c.report("RPC_SAME_REQUEST_TYPE", appendPath(methodPath, methodInputTypeNumber),
+				"RPC %q changed request type from %q to %q",
+				methodName, strings.TrimPrefix(oldMethod.GetInputType(), "."),
+				strings.TrimPrefix(method.GetInputType(), "."))
+		}
+		if oldMethod.GetOutputType() != method.GetOutputType() {
+			c.report("RPC_SAME_RESPONSE_TYPE", appendPath(methodPath, methodOutputTypeNumber),
+				"RPC %q changed response type from %q to %q",
+				methodName, strings.TrimPrefix(oldMethod.GetOutputType(), "."),
+				strings.TrimPrefix(method.GetOutputType(), "."))
+		}
+		if oldMethod.GetClientStreaming() != method.GetClientStreaming() {
+			c.report("RPC_SAME_CLIENT_STREAMING", appendPath(methodPath, methodClientStreamNumber),
+				"RPC %q changed client streaming from %t to %t",
+				methodName, oldMethod.GetClientStreaming(), method.GetClientStreaming())
+		}
+		if oldMethod.GetServerStreaming() != method.GetServerStreaming() {
+			c.report("RPC_SAME_SERVER_STREAMING", appendPath(methodPath, methodServerStreamNumber),
+				"RPC %q changed server streaming from %t to %t",
+				methodName, oldMethod.GetServerStreaming(), method.GetServerStreaming())
+		}
+	}
+}
+
+// qualify returns the fully qualified name of a top-level element.
+func (c *checker) qualify(name string) string {
+	if c.file.GetPackage() == "" {
+		return name
+	}
+	return c.file.GetPackage() + "." + name
+}
+
+type named interface{ GetName() string }
+
+func indexByName[T named](elements []T) map[string]int {
+	index := make(map[string]int, len(elements))
+	for i, element := range elements {
+		index[element.GetName()] = i
+	}
+	return index
+}
+
+func appendPath(path []int32, elements ...int) []int32 {
+	result := slices.Clone(path)
+	for _, element := range elements {
+		result = append(result, int32(element))
+	}
+	return result
+}
+
+func fieldType(field *descriptorpb.FieldDescriptorProto) string {
+	if typeName := field.GetTypeName(); typeName != "" {
+		return strings.TrimPrefix(typeName, ".")
+	}
+	return strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+}
+
+func labelName(label descriptorpb.FieldDescriptorProto_Label) string {
+	return strings.ToLower(strings.TrimPrefix(label.String(), "LABEL_"))
+}
+
+func isReservedNumber(ranges []*descriptorpb.DescriptorProto_ReservedRange, number int32) bool {
+	// Message reserved ranges are exclusive at the end.
+	for _, r := range ranges {
+		if r.GetStart() <= number && number < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func isReservedEnumNumber(ranges []*descriptorpb.EnumDescriptorProto_EnumReservedRange, number int32) bool {
+	// Enum reserved ranges are inclusive at the end.
+	for _, r := range ranges {
+		if r.GetStart() <= number && number <= r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package breaking
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+// petFile returns a small file descriptor that tests modify to introduce
+// breaking changes.
+func petFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("pet.proto"),
+		Package: proto.String("petstore"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Pet"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("KIND_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("KIND_DOG"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("PetStore"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetPet"),
+				InputType:  proto.String(".petstore.Pet"),
+				OutputType: proto.String(".petstore.Pet"),
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{4, 0}, Span: []int32{4, 0, 7, 1}},
+				{Path: []int32{4, 0, 2, 1}, Span: []int32{6, 2, 18}},
+				{Path: []int32{4, 0, 2, 1, 5}, Span: []int32{6, 2, 8}},
+			},
+		},
+	}
+}
+
+func set(files ...*descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: files}
+}
+
+func rules(violations []Violation) []string {
+	var result []string
+	for _, v := range violations {
+		result = append(result, v.Rule)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	testCases := map[string]struct {
+		modify func(file *descriptorpb.FileDescriptorProto)
+		rules  []string
+	}{
+		"no change": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {},
+		},
+		"compatible addition": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				message := file.MessageType[0]
+				message.Field = append(message.Field, field("age", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32))
+			},
+		},
+		"package renamed": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Package = proto.String("pets") },
+			rules:  []string{"PACKAGE_NO_CHANGE"},
+		},
+		"field deleted": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				file.MessageType[0].Field = file.MessageType[0].Field[:1]
+			},
+			rules: []string{"FIELD_NO_DELETE"},
+		},
+		"field deleted with reserved number": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				message := file.MessageType[0]
+				message.Field = message.Field[:1]
+				message.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{
+					{Start: proto.Int32(2), End: proto.Int32(3)},
+				}
+			},
+		},
+		"field number changed": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.MessageType[0].Field[1].Number = proto.Int32(5) },
+			rules:  []string{"FIELD_SAME_NUMBER"},
+		},
+		"field type and name changed": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				f := file.MessageType[0].Field[1]
+				f.Name = proto.String("title")
+				f.Type = descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+			},
+			rules: []string{"FIELD_SAME_NAME", "FIELD_SAME_TYPE"},
+		},
+		"enum value deleted": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.EnumType[0].Value = file.EnumType[0].Value[:1] },
+			rules:  []string{"ENUM_VALUE_NO_DELETE"},
+		},
+		"rpc deleted": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Service[0].Method = nil },
+			rules:  []string{"RPC_NO_DELETE"},
+		},
+		"rpc streaming changed": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				file.Service[0].Method[0].ServerStreaming = proto.Bool(true)
+			},
+			rules: []string{"RPC_SAME_SERVER_STREAMING"},
+		},
+		"service deleted": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Service = nil },
+			rules:  []string{"SERVICE_NO_DELETE"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			current := petFile()
+			tc.modify(current)
+			violations := Check(set(petFile()), set(current))
+			if got := rules(violations); !reflect.DeepEqual(got, tc.rules) {
+				t.Errorf("Expected rules %v, got %v", tc.rules, violations)
+			}
+		})
+	}
+}
+
+func TestCheck_FileDeleted(t *testing.T) {
+	violations := Check(set(petFile()), set())
+	expected := []Violation{{Rule: "FILE_NO_DELETE", File: "pet.proto", Message: "file was deleted"}}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("Expected %v, got %v", expected, violations)
+	}
+	if got := violations[0].String(); got != "pet.proto: file was deleted (FILE_NO_DELETE)" {
+		t.Errorf("Unexpected string %q", got)
+	}
+}
+
+func TestCheck_Position(t *testing.T) {
+	current := petFile()
+	current.MessageType[0].Field[1].Type = descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+
+	violations := Check(set(petFile()), set(current))
+	if len(violations) != 1 {
+		t.Fatalf("Expected one violation, got %v", violations)
+	}
+	expected := `pet.proto:7:3: field "petstore.Pet.name" changed type from string to bytes (FIELD_SAME_TYPE)`
+	if got := violations[0].String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,253 @@
+// Package compiler compiles proto files in-process with protocompile, a
+// pure-Go protobuf compiler, as an alternative to the protoc releases cached
+// by bincache. It works on platforms protoc publishes no release for and in
+// hermetic builds, as nothing is downloaded.
+package compiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"github.com/bufbuild/protocompile/reporter"
+	"github.com/esdandreu/go-protoc/internal/protocrun"
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Version is what the compiler prints for --version.
+const Version = "go-protoc pure-Go compiler (protocompile)"
+
+// Dir is the directory of the protoc cache holding the protoc link of the
+// compiler.
+const Dir = "compiler"
+
+// ErrFailed is returned by Compile when compilation fails. The errors are
+// written to the standard error, in the format of protoc.
+var ErrFailed = errors.New("compilation failed")
+
+// Compiler compiles proto files in-process and runs the plugins on the
+// resulting CodeGeneratorRequest, like protoc does. It is a protoc.BinCache
+// whose binary is a link named protoc to Executable, which runs Main when
+// invoked through it, so that programs running the binary keep working.
+// Release tags are ignored.
+type Compiler struct {
+	// CacheDir is the directory of the protoc cache, which also holds the
+	// proto dependencies and the outputs cached by go-protoc.
+	CacheDir string
+	// LinkDir is the directory of the protoc link.
+	LinkDir string
+	// Executable is the program the protoc link points to. Defaults to the
+	// current program, see os.Executable.
+	Executable string
+}
+
+// NewCompiler creates a compiler whose protoc link is in the protoc cache of
+// cacheDir. Typically constructed with the result of os.UserCacheDir().
+func NewCompiler(cacheDir string) *Compiler {
+	dir := filepath.Join(cacheDir, bincache.DefaultProtocBinCachePrefix)
+	return &Compiler{CacheDir: dir, LinkDir: filepath.Join(dir, Dir)}
+}
+
+// Dir returns the directory of the protoc cache, see CacheDir.
+func (c *Compiler) Dir() string {
+	return c.CacheDir
+}
+
+// BinPath returns the path of the protoc link to Executable, creating it if
+// needed.
+func (c *Compiler) BinPath(tag string) (string, error) {
+	executable := c.Executable
+	if executable == "" {
+		var err error
+		if executable, err = os.Executable(); err != nil {
+			return "", fmt.Errorf("failed to find executable: %w", err)
+		}
+	}
+	name := "protoc"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binPath := filepath.Join(c.LinkDir, "bin", name)
+	if err := protocrun.Link(executable, binPath); err != nil {
+		return "", err
+	}
+	return binPath, nil
+}
+
+// IsProtoc reports whether a program was invoked through the protoc link of
+// a Compiler, given its first argument.
+func IsProtoc(arg0 string) bool {
+	return strings.TrimSuffix(filepath.Base(arg0), ".exe") == "protoc"
+}
+
+// Main runs the compiler in the current directory with the protoc arguments
+// args and returns the exit code, like protoc.
+func Main(args []string) int {
+	if err := (&Compiler{}).Compile(context.Background(), ".", args, os.Stdout, os.Stderr); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// parseArgs parses the protoc arguments args. Flags of protoc the compiler
+// does not support, such as --decode, are errors.
+func parseArgs(args []string) (*protocrun.Invocation, error) {
+	inv, err := protocrun.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(inv.Other) > 0 {
+		flag, _, _ := strings.Cut(inv.Other[0], "=")
+		return nil, fmt.Errorf("unsupported flag %s", flag)
+	}
+	if inv.ErrorFormat != "" && inv.ErrorFormat != "gcc" {
+		return nil, fmt.Errorf("unsupported --error_format %s", inv.ErrorFormat)
+	}
+	return inv, nil
+}
+
+// Compile runs the compiler in dir with the protoc arguments args: it
+// compiles the input proto files, writes the descriptor set asked for, and
+// runs the plugins of the --NAME_out flags, which are protoc-gen-NAME
+// binaries in the PATH unless given with --plugin. The built-in generators of
+// protoc, such as --cpp_out, are not available.
+func (c *Compiler) Compile(ctx context.Context, dir string, args []string, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	err := compile(ctx, dir, args, stdout, stderr)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, reporter.ErrInvalidSource) {
+		fmt.Fprintln(stderr, err)
+	}
+	return ErrFailed
+}
+
+func compile(ctx context.Context, dir string, args []string, stdout, stderr io.Writer) error {
+	inv, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if inv.Version {
+		fmt.Fprintln(stdout, Version)
+		return nil
+	}
+	if len(inv.Inputs) == 0 {
+		return fmt.Errorf("missing input file")
+	}
+	if len(inv.Outputs) == 0 && inv.DescriptorSetOut == "" {
+		return fmt.Errorf("missing output directives")
+	}
+
+	includes := inv.IncludePaths()
+	importPaths := make([]string, len(includes))
+	for i, include := range includes {
+		importPaths[i] = protocrun.ResolvePath(dir, include)
+	}
+	names := inv.FileNames(dir)
+
+	compiler := protocompile.Compiler{
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+		Reporter: reporter.NewReporter(
+			func(err reporter.ErrorWithPos) error {
+				fmt.Fprintln(stderr, err)
+				return nil
+			},
+			func(err reporter.ErrorWithPos) {
+				fmt.Fprintf(stderr, "%s: warning: %v\n", err.GetPosition(), err.Unwrap())
+			},
+		),
+	}
+	files, err := compiler.Compile(ctx, names...)
+	if err != nil {
+		return err
+	}
+
+	inputs := make([]protoreflect.FileDescriptor, len(files))
+	for i, file := range files {
+		inputs[i] = file
+	}
+	all := fileDescriptorProtos(inputs, true)
+	if inv.DescriptorSetOut != "" {
+		if err := writeDescriptorSet(protocrun.ResolvePath(dir, inv.DescriptorSetOut), fileDescriptorProtos(inputs, inv.IncludeImports), inv.IncludeSourceInfo); err != nil {
+			return err
+		}
+	}
+	for _, out := range inv.Outputs {
+		err := inv.RunPlugin(ctx, dir, out, all, names, stderr)
+		if errors.Is(err, protocrun.ErrPluginNotFound) {
+			return fmt.Errorf("--%s_out: %w; the built-in generators of protoc are not available in the pure-Go compiler", out.Name, err)
+		} else if err != nil {
+			return fmt.Errorf("--%s_out: %w", out.Name, err)
+		}
+	}
+	return nil
+}
+
+// fileDescriptorProtos returns the descriptors of files, preceded by the
+// files they import in dependency order when withImports is set, like
+// protoc writes them with --include_imports.
+func fileDescriptorProtos(files []protoreflect.FileDescriptor, withImports bool) []*descriptorpb.FileDescriptorProto {
+	var protos []*descriptorpb.FileDescriptorProto
+	seen := map[string]bool{}
+	var add func(file protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		if withImports {
+			imports := file.Imports()
+			for i := range imports.Len() {
+				add(imports.Get(i).FileDescriptor)
+			}
+		}
+		if result, ok := file.(linker.Result); ok {
+			protos = append(protos, result.FileDescriptorProto())
+		} else {
+			protos = append(protos, protodesc.ToFileDescriptorProto(file))
+		}
+	}
+	for _, file := range files {
+		add(file)
+	}
+	return protos
+}
+
+// writeDescriptorSet writes the descriptor set of files to path, without
+// source code information unless withSourceInfo is set.
+func writeDescriptorSet(path string, files []*descriptorpb.FileDescriptorProto, withSourceInfo bool) error {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		if !withSourceInfo {
+			file = proto.Clone(file).(*descriptorpb.FileDescriptorProto)
+			file.SourceCodeInfo = nil
+		}
+		set.File = append(set.File, file)
+	}
+	content, err := proto.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to encode descriptor set: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write descriptor set: %w", err)
+	}
+	return nil
+}
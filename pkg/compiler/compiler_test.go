@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var testProtos = map[string]string{
+	"api/pet.proto": `syntax = "proto3";
+package pets;
+import "v1/kind.proto";
+import "google/protobuf/timestamp.proto";
+// A pet.
+message Pet {
+  v1.Kind kind = 1;
+  google.protobuf.Timestamp born = 2;
+}
+`,
+	"api/v1/kind.proto": "syntax = \"proto3\";\npackage pets.v1;\nenum Kind { KIND_UNSPECIFIED = 0; }\n",
+}
+
+func TestCompile_DescriptorSet(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, testProtos)
+
+	var stderr bytes.Buffer
+	err := (&Compiler{}).Compile(context.Background(), dir, []string{
+		"-Iapi", "--descriptor_set_out=set.binpb", "--include_imports", "api/pet.proto",
+	}, nil, &stderr)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, stderr.String())
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "set.binpb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range set.GetFile() {
+		names = append(names, file.GetName())
+		if file.SourceCodeInfo != nil {
+			t.Errorf("Expected no source info in %s", file.GetName())
+		}
+	}
+	expected := []string{"v1/kind.proto", "google/protobuf/timestamp.proto", "pet.proto"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected files %v, got %v", expected, names)
+	}
+}
+
+func TestCompile_Plugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock plugins require a POSIX shell")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, testProtos)
+	if err := os.Mkdir(filepath.Join(dir, "gen"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	response, err := proto.Marshal(&pluginpb.CodeGeneratorResponse{
+		File: []*pluginpb.CodeGeneratorResponse_File{{Name: proto.String("pets/pet.txt"), Content: proto.String("pet")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{"response.binpb": string(response)})
+	plugin := filepath.Join(dir, "protoc-gen-mock")
+	script := "#!/bin/sh\ncat > request.binpb\ncat response.binpb\n"
+	if err := os.WriteFile(plugin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	err = (&Compiler{}).Compile(context.Background(), dir, []string{
+		"-Iapi", "--plugin=protoc-gen-mock=" + plugin, "--mock_out=a:gen", "--mock_opt=b", "api/pet.proto",
+	}, nil, &stderr)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, stderr.String())
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "gen", "pets", "pet.txt")); err != nil || string(content) != "pet" {
+		t.Errorf("Expected the generated file to be written, got %q, %v", content, err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "request.binpb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(content, request); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(request.GetFileToGenerate(), []string{"pet.proto"}) {
+		t.Errorf("Expected pet.proto to be generated, got %v", request.GetFileToGenerate())
+	}
+	if request.GetParameter() != "a,b" {
+		t.Errorf("Expected parameter a,b, got %q", request.GetParameter())
+	}
+	if len(request.GetProtoFile()) != 3 || len(request.GetSourceFileDescriptors()) != 1 {
+		t.Fatalf("Expected 3 files and 1 source file, got %d and %d", len(request.GetProtoFile()), len(request.GetSourceFileDescriptors()))
+	}
+	if comments := request.GetProtoFile()[2].GetSourceCodeInfo().GetLocation(); !strings.Contains(leadingComments(comments), "A pet.") {
+		t.Errorf("Expected the comments of pet.proto, got %v", comments)
+	}
+}
+
+func leadingComments(locations []*descriptorpb.SourceCodeInfo_Location) string {
+	var comments strings.Builder
+	for _, location := range locations {
+		comments.WriteString(location.GetLeadingComments())
+	}
+	return comments.String()
+}
+
+func TestCompile_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		files    map[string]string
+		args     []string
+		expected string
+	}{
+		"syntax error": {
+			files:    map[string]string{"bad.proto": "syntax = \"proto3\";\nmessage Bad { strin name = 1; }\n"},
+			args:     []string{"--descriptor_set_out=set.binpb", "bad.proto"},
+			expected: "bad.proto:2:15: field Bad.name: unknown type strin\n",
+		},
+		"missing file": {
+			args:     []string{"--descriptor_set_out=set.binpb", "missing.proto"},
+			expected: "missing.proto",
+		},
+		"unsupported flag": {
+			args:     []string{"--encode=pets.Pet", "pet.proto"},
+			expected: "unsupported flag --encode\n",
+		},
+		"built-in generator": {
+			files:    map[string]string{"pet.proto": "syntax = \"proto3\";\n"},
+			args:     []string{"--cpp_out=.", "pet.proto"},
+			expected: "--cpp_out: protoc-gen-cpp not found in PATH",
+		},
+		"missing output directory": {
+			files:    map[string]string{"pet.proto": "syntax = \"proto3\";\n"},
+			args:     []string{"--go_out=gen", "pet.proto"},
+			expected: "--go_out: gen: No such file or directory\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("PATH", "")
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			var stderr bytes.Buffer
+			err := (&Compiler{}).Compile(context.Background(), dir, tc.args, nil, &stderr)
+			if !errors.Is(err, ErrFailed) {
+				t.Errorf("Expected ErrFailed, got: %v", err)
+			}
+			if !strings.Contains(stderr.String(), tc.expected) {
+				t.Errorf("Expected %q in the errors, got:\n%s", tc.expected, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCompile_Version(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := (&Compiler{}).Compile(context.Background(), t.TempDir(), []string{"--version"}, &stdout, nil); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if stdout.String() != Version+"\n" {
+		t.Errorf("Expected %q, got %q", Version+"\n", stdout.String())
+	}
+}
+
+func TestCompiler_BinPath(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "go-protoc")
+	if err := os.WriteFile(executable, []byte("go-protoc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCompiler(t.TempDir())
+	c.Executable = executable
+
+	binPath, err := c.BinPath("v32.1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !IsProtoc(binPath) {
+		t.Errorf("Expected the link to be named protoc, got %s", binPath)
+	}
+	linked, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Stat(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(linked, target) {
+		t.Errorf("Expected %s to link to %s", binPath, executable)
+	}
+	if again, err := c.BinPath("latest"); err != nil || again != binPath {
+		t.Errorf("Expected the link to be reused, got %s, %v", again, err)
+	}
+
+	// The link follows the executable.
+	moved := filepath.Join(t.TempDir(), "go-protoc")
+	if err := os.WriteFile(moved, []byte("go-protoc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.Executable = moved
+	if _, err := c.BinPath("latest"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	linked, err = os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err = os.Stat(moved); err != nil || !os.SameFile(linked, target) {
+		t.Errorf("Expected %s to link to %s", binPath, moved)
+	}
+}
+
+func TestIsProtoc(t *testing.T) {
+	testCases := map[string]bool{
+		"protoc":                 true,
+		"/cache/bin/protoc":      true,
+		"protoc.exe":             true,
+		"go-protoc":              false,
+		"/usr/bin/protoc-gen-go": false,
+	}
+	for arg0, expected := range testCases {
+		if IsProtoc(arg0) != expected {
+			t.Errorf("Expected IsProtoc(%q) to be %v", arg0, expected)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package deps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+const (
+	// ConfigFileName is the name of the go-protoc configuration file.
+	ConfigFileName = "go-protoc.json"
+	// LockFileName is the name of the file recording the hashes of the
+	// dependencies, next to the configuration file.
+	LockFileName = "go-protoc.lock"
+	// CacheDir is the directory of the cache holding the dependencies.
+	CacheDir = "deps"
+)
+
+// Config is the go-protoc configuration file.
+type Config struct {
+	// Deps are the proto dependencies added to the include paths of protoc.
+	Deps []Dependency `json:"deps"`
+}
+
+// Dependency is an archive of proto files, given either as a URL or as a
+// module-style reference to a GitHub repository, such as
+// github.com/googleapis/googleapis@<commit>. Path elements after the
+// repository name select a directory of the repository, as in
+// github.com/bufbuild/protovalidate/proto/protovalidate@v0.14.2.
+type Dependency struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Module string `json:"module,omitempty"`
+	// Path is the directory of the archive to add to the include paths.
+	// Archives with a single top-level directory, like GitHub archives, are
+	// relative to that directory.
+	Path string `json:"path,omitempty"`
+	// Hash pins the content of the archive, as recorded in the lockfile.
+	Hash string `json:"hash,omitempty"`
+}
+
+// Source returns the URL of the archive and the directory of the archive to
+// add to the include paths.
+func (dep Dependency) Source() (string, string, error) {
+	if dep.Name == "" || strings.ContainsAny(dep.Name, `/\@`) || strings.HasPrefix(dep.Name, ".") {
+		return "", "", fmt.Errorf("invalid dependency name %q", dep.Name)
+	}
+	if (dep.URL == "") == (dep.Module == "") {
+		return "", "", fmt.Errorf("dependency %s: exactly one of url and module must be set", dep.Name)
+	}
+	dir := dep.Path
+	url := dep.URL
+	if dep.Module != "" {
+		modulePath, ref, ok := strings.Cut(dep.Module, "@")
+		parts := strings.Split(modulePath, "/")
+		if !ok || ref == "" || len(parts) < 3 || parts[0] != "github.com" {
+			return "", "", fmt.Errorf("dependency %s: module must be github.com/owner/repo[/dir]@ref, got %q", dep.Name, dep.Module)
+		}
+		url = fmt.Sprintf("https://github.com/%s/%s/archive/%s.zip", parts[1], parts[2], ref)
+		dir = path.Join(path.Join(parts[3:]...), dep.Path)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	if !fs.ValidPath(dir) {
+		return "", "", fmt.Errorf("dependency %s: invalid path %q", dep.Name, dir)
+	}
+	return url, dir, nil
+}
+
+// Lock records the hash of the content of every dependency.
+type Lock struct {
+	Deps []Locked `json:"deps"`
+}
+
+// Locked is a dependency recorded in the lockfile.
+type Locked struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Hash is the dirhash of the extracted archive, as in go.sum.
+	Hash string `json:"hash"`
+}
+
+// FindConfig returns the path of the configuration file in dir or its parent
+// directories up to the module root, or an empty string if there is none.
+func FindConfig(dir string) string {
+	for {
+		configPath := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ReadConfig reads a configuration file.
+func ReadConfig(configPath string) (*Config, error) {
+	config := &Config{}
+	if err := readJSON(configPath, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadLock reads a lockfile. A missing lockfile is empty.
+func ReadLock(lockPath string) (*Lock, error) {
+	lock := &Lock{}
+	if err := readJSON(lockPath, lock); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// WriteLock writes a lockfile.
+func WriteLock(lockPath string, lock *Lock) error {
+	content, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(lockPath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", lockPath, err)
+	}
+	return nil
+}
+
+func readJSON(filePath string, v any) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return nil
+}
+
+type ZipDownloader interface {
+	DownloadAndExtract(url string, destDir string) error
+}
+
+// Fetcher downloads dependencies into a cache directory, where each one is
+// stored by name and URL along with the hash of its content.
+type Fetcher struct {
+	ZipDownloader
+	path string
+}
+
+// NewFetcher creates a fetcher caching dependencies in the deps directory of
+// cacheDir, which is typically the directory of bincache.ProtocBinCache.
+func NewFetcher(cacheDir string) *Fetcher {
+	return &Fetcher{
+		ZipDownloader: downloader.NewArchiveDownloader(),
+		path:          filepath.Join(cacheDir, CacheDir),
+	}
+}
+
+// Fetch returns the include directory of dep, downloading it if it is not
+// cached, and the hash of its content. When expectedHash is not empty, the
+// content must match it.
+func (fetcher *Fetcher) Fetch(dep Dependency, expectedHash string) (string, string, error) {
+	url, dir, err := dep.Source()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	cacheDir := filepath.Join(fetcher.path, fmt.Sprintf("%s@%s", dep.Name, hex.EncodeToString(sum[:8])))
+	srcDir := filepath.Join(cacheDir, "src")
+	hashPath := filepath.Join(cacheDir, "hash")
+
+	content, err := os.ReadFile(hashPath)
+	if err == nil {
+		// Content changed since it was downloaded is downloaded again.
+		if verifyErr := verify(dep.Name, cacheDir, string(content)); verifyErr != nil {
+			if err := os.RemoveAll(cacheDir); err != nil {
+				return "", "", fmt.Errorf("failed to remove dependency %s: %w", dep.Name, err)
+			}
+			err = fs.ErrNotExist
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := fetcher.download(dep.Name, url, cacheDir); err != nil {
+			return "", "", err
+		}
+		content, err = os.ReadFile(hashPath)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read hash of %s: %w", dep.Name, err)
+	}
+	hash := string(content)
+	if expectedHash != "" && hash != expectedHash {
+		return "", "", fmt.Errorf("dependency %s: hash mismatch, expected %s, got %s", dep.Name, expectedHash, hash)
+	}
+
+	root := srcDir
+	if entries, err := os.ReadDir(srcDir); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		root = filepath.Join(srcDir, entries[0].Name())
+	}
+	includeDir := filepath.Join(root, filepath.FromSlash(dir))
+	if info, err := os.Stat(includeDir); err != nil || !info.IsDir() {
+		return "", "", fmt.Errorf("dependency %s: directory %s not found in archive", dep.Name, dir)
+	}
+	return includeDir, hash, nil
+}
+
+// download extracts the archive at url into the src directory of cacheDir
+// and records the hash of its content. The cache directory is moved into
+// place once complete, so that interrupted downloads are not used.
+func (fetcher *Fetcher) download(name, url, cacheDir string) error {
+	if err := os.MkdirAll(fetcher.path, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(fetcher.path, ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	srcDir := filepath.Join(tempDir, "src")
+	if err := os.Mkdir(srcDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	if err := fetcher.DownloadAndExtract(url, srcDir); err != nil {
+		return fmt.Errorf("failed to fetch dependency %s: %w", name, err)
+	}
+	hash, err := dirhash.HashDir(srcDir, name, dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("failed to hash dependency %s: %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "hash"), []byte(hash), 0644); err != nil {
+		return fmt.Errorf("failed to write hash of %s: %w", name, err)
+	}
+	if err := writeState(tempDir); err != nil {
+		return fmt.Errorf("failed to record state of %s: %w", name, err)
+	}
+	if err := os.Rename(tempDir, cacheDir); err != nil {
+		// Another process may have fetched it concurrently.
+		if _, statErr := os.Stat(filepath.Join(cacheDir, "hash")); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to cache dependency %s: %w", name, err)
+	}
+	return nil
+}
+
+// stateFileName is the file of a cached dependency recording the number,
+// size and latest modification time of its files, which tell whether its
+// content may have changed without hashing it.
+const stateFileName = "state.json"
+
+// state summarizes the files of a cached dependency.
+type state struct {
+	Files   int   `json:"files"`
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mod_time"`
+}
+
+// readState summarizes the files in the src directory of cacheDir.
+func readState(cacheDir string) (state, error) {
+	var s state
+	err := filepath.WalkDir(filepath.Join(cacheDir, "src"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		s.Files++
+		s.Size += info.Size()
+		s.ModTime = max(s.ModTime, info.ModTime().UnixNano())
+		return nil
+	})
+	return s, err
+}
+
+// writeState records the state of the files in the src directory of
+// cacheDir.
+func writeState(cacheDir string) error {
+	s, err := readState(cacheDir)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, stateFileName), content, 0644)
+}
+
+// verify returns an error if the content of the dependency name cached in
+// cacheDir no longer has hash. Its content is only hashed again when its
+// files changed since the state was recorded, or when there is no state, as
+// for dependencies cached before states were recorded.
+func verify(name, cacheDir, hash string) error {
+	var recorded state
+	if err := readJSON(filepath.Join(cacheDir, stateFileName), &recorded); err == nil {
+		if current, err := readState(cacheDir); err == nil && current == recorded {
+			return nil
+		}
+	}
+	current, err := dirhash.HashDir(filepath.Join(cacheDir, "src"), name, dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("failed to hash dependency %s: %w", name, err)
+	}
+	if current != hash {
+		return fmt.Errorf("dependency %s: cached content changed, expected %s, got %s", name, hash, current)
+	}
+	return writeState(cacheDir)
+}
+
+// Resolve fetches the dependencies of the configuration file and returns
+// their include directories. Hashes are checked against the configuration
+// and the lockfile next to it, and the lockfile is updated with the
+// dependencies that were not recorded yet.
+func Resolve(fetcher *Fetcher, configPath string) ([]string, error) {
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	lockPath := filepath.Join(filepath.Dir(configPath), LockFileName)
+	lock, err := ReadLock(lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var includes []string
+	newLock := &Lock{Deps: []Locked{}}
+	for _, dep := range config.Deps {
+		url, _, err := dep.Source()
+		if err != nil {
+			return nil, err
+		}
+		expectedHash := dep.Hash
+		if expectedHash == "" {
+			index := slices.IndexFunc(lock.Deps, func(locked Locked) bool {
+				return locked.Name == dep.Name && locked.URL == url
+			})
+			if index >= 0 {
+				expectedHash = lock.Deps[index].Hash
+			}
+		}
+		includeDir, hash, err := fetcher.Fetch(dep, expectedHash)
+		if err != nil {
+			return nil, err
+		}
+		includes = append(includes, includeDir)
+		newLock.Deps = append(newLock.Deps, Locked{Name: dep.Name, URL: url, Hash: hash})
+	}
+	if !slices.Equal(lock.Deps, newLock.Deps) {
+		if err := WriteLock(lockPath, newLock); err != nil {
+			return nil, err
+		}
+	}
+	return includes, nil
+}
@@ -0,0 +1,207 @@
+package deps
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockZipDownloader extracts an archive with a single top-level directory,
+// like GitHub archives.
+type mockZipDownloader struct {
+	files     map[string]string
+	callCount int
+}
+
+func (m *mockZipDownloader) DownloadAndExtract(url string, destDir string) error {
+	m.callCount++
+	for name, content := range m.files {
+		path := filepath.Join(destDir, "repo-main", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestDependency_Source(t *testing.T) {
+	testCases := map[string]struct {
+		dep         Dependency
+		expectedURL string
+		expectedDir string
+		expectedErr string
+	}{
+		"url": {
+			dep:         Dependency{Name: "googleapis", URL: "https://example.com/googleapis.zip"},
+			expectedURL: "https://example.com/googleapis.zip",
+			expectedDir: ".",
+		},
+		"module": {
+			dep:         Dependency{Name: "googleapis", Module: "github.com/googleapis/googleapis@abc123"},
+			expectedURL: "https://github.com/googleapis/googleapis/archive/abc123.zip",
+			expectedDir: ".",
+		},
+		"module with directory": {
+			dep:         Dependency{Name: "protovalidate", Module: "github.com/bufbuild/protovalidate/proto/protovalidate@v0.14.2"},
+			expectedURL: "https://github.com/bufbuild/protovalidate/archive/v0.14.2.zip",
+			expectedDir: "proto/protovalidate",
+		},
+		"module without ref": {
+			dep:         Dependency{Name: "googleapis", Module: "github.com/googleapis/googleapis"},
+			expectedErr: "module must be github.com/owner/repo[/dir]@ref",
+		},
+		"both url and module": {
+			dep:         Dependency{Name: "googleapis", URL: "https://example.com/a.zip", Module: "github.com/a/b@c"},
+			expectedErr: "exactly one of url and module must be set",
+		},
+		"escaping path": {
+			dep:         Dependency{Name: "googleapis", URL: "https://example.com/a.zip", Path: "../.."},
+			expectedErr: "invalid path",
+		},
+		"invalid name": {
+			dep:         Dependency{Name: "../x", URL: "https://example.com/a.zip"},
+			expectedErr: "invalid dependency name",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			url, dir, err := tc.dep.Source()
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if url != tc.expectedURL || dir != tc.expectedDir {
+				t.Errorf("Expected %s %s, got %s %s", tc.expectedURL, tc.expectedDir, url, dir)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	downloader := &mockZipDownloader{files: map[string]string{
+		"proto/google/api/annotations.proto": "syntax = \"proto3\";\n",
+	}}
+	fetcher := NewFetcher(t.TempDir())
+	fetcher.ZipDownloader = downloader
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ConfigFileName)
+	config := `{"deps": [{"name": "googleapis", "module": "github.com/googleapis/googleapis@abc123", "path": "proto"}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	includes, err := Resolve(fetcher, configPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(includes) != 1 {
+		t.Fatalf("Expected one include directory, got %v", includes)
+	}
+	if _, err := os.Stat(filepath.Join(includes[0], "google", "api", "annotations.proto")); err != nil {
+		t.Errorf("Expected proto file in include directory, got: %v", err)
+	}
+	lock, err := ReadLock(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Deps) != 1 || lock.Deps[0].URL != "https://github.com/googleapis/googleapis/archive/abc123.zip" ||
+		!strings.HasPrefix(lock.Deps[0].Hash, "h1:") {
+		t.Errorf("Unexpected lock %+v", lock)
+	}
+
+	// The dependency is cached.
+	if _, err := Resolve(fetcher, configPath); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if downloader.callCount != 1 {
+		t.Errorf("Expected one download, got %d", downloader.callCount)
+	}
+
+	// A hash that does not match the lockfile is rejected.
+	lock.Deps[0].Hash = "h1:tampered"
+	if err := WriteLock(filepath.Join(dir, LockFileName), lock); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Resolve(fetcher, configPath)
+	if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Errorf("Expected hash mismatch, got: %v", err)
+	}
+}
+
+func TestFetch_ChangedContent(t *testing.T) {
+	downloader := &mockZipDownloader{files: map[string]string{
+		"proto/pet.proto": "syntax = \"proto3\";\n",
+	}}
+	fetcher := NewFetcher(t.TempDir())
+	fetcher.ZipDownloader = downloader
+	dep := Dependency{Name: "pets", URL: "https://example.com/pets.zip", Path: "proto"}
+	includeDir, hash, err := fetcher.Fetch(dep, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	protoPath := filepath.Join(includeDir, "pet.proto")
+
+	// Touched files with the same content are not downloaded again.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(protoPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fetcher.Fetch(dep, hash); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if downloader.callCount != 1 {
+		t.Errorf("Expected one download, got %d", downloader.callCount)
+	}
+
+	// Changed files are downloaded again.
+	if err := os.WriteFile(protoPath, []byte("syntax = \"proto2\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fetcher.Fetch(dep, hash); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if downloader.callCount != 2 {
+		t.Errorf("Expected the dependency to be downloaded again, got %d downloads", downloader.callCount)
+	}
+	if content, err := os.ReadFile(protoPath); err != nil || string(content) != "syntax = \"proto3\";\n" {
+		t.Errorf("Expected the downloaded content, got %q (%v)", content, err)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"go.mod", ConfigFileName} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subdir := filepath.Join(root, "api", "v1")
+	if err := os.MkdirAll(subdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if configPath := FindConfig(subdir); configPath != filepath.Join(root, ConfigFileName) {
+		t.Errorf("Expected config at the module root, got %q", configPath)
+	}
+
+	// The search stops at the module root.
+	nested := filepath.Join(root, "nested")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "go.mod"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if configPath := FindConfig(nested); configPath != "" {
+		t.Errorf("Expected no config, got %q", configPath)
+	}
+}
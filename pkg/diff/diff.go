@@ -0,0 +1,164 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DefaultContextLines is the number of unchanged lines shown around each
+// change, matching the default of `diff -u`.
+const DefaultContextLines = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type edit struct {
+	kind opKind
+	line string
+	// Line numbers (0-based) in the old and new inputs at this edit.
+	oldLine, newLine int
+}
+
+// Unified returns a unified diff of old and new, labelled with oldName and
+// newName. It returns nil when both inputs are equal.
+func Unified(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	edits := lineEdits(splitLines(old), splitLines(new))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		// Find the next change.
+		for start < len(edits) && edits[start].kind == opEqual {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		// Extend the hunk until there is a run of unchanged lines longer than
+		// twice the context.
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].kind != opEqual {
+				end = i + 1
+			} else if i-end >= 2*DefaultContextLines {
+				break
+			}
+		}
+		first := max(start-DefaultContextLines, 0)
+		last := min(end+DefaultContextLines, len(edits))
+		writeHunk(&out, edits[first:last])
+		start = last
+	}
+	return out.Bytes()
+}
+
+func writeHunk(out *bytes.Buffer, hunk []edit) {
+	var oldCount, newCount int
+	for _, e := range hunk {
+		if e.kind != opInsert {
+			oldCount++
+		}
+		if e.kind != opDelete {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n",
+		hunkRange(hunk[0].oldLine, oldCount), hunkRange(hunk[0].newLine, newCount))
+	for _, e := range hunk {
+		out.WriteByte(byte(e.kind))
+		out.WriteString(e.line)
+		if len(e.line) == 0 || e.line[len(e.line)-1] != '\n' {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits data into lines, keeping the line terminators.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// lineEdits computes a minimal edit script turning a into b. Common prefix
+// and suffix are trimmed before running a longest common subsequence over the
+// remaining lines, which keeps the cost low for the localized changes usually
+// found in generated code.
+func lineEdits(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the LCS of midA[i:] and midB[j:].
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{opEqual, a[i], i, i})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		oldLine, newLine := prefix+i, prefix+j
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			edits = append(edits, edit{opEqual, midA[i], oldLine, newLine})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{opDelete, midA[i], oldLine, newLine})
+			i++
+		default:
+			edits = append(edits, edit{opInsert, midB[j], oldLine, newLine})
+			j++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		oldLine, newLine := len(a)-suffix+k, len(b)-suffix+k
+		edits = append(edits, edit{opEqual, a[oldLine], oldLine, newLine})
+	}
+	return edits
+}
@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	testCases := map[string]struct {
+		old, new string
+		expected string
+	}{
+		"equal": {
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		"changed line": {
+			old: "a\nb\nc\n",
+			new: "a\nB\nc\n",
+			expected: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n" +
+				" a\n-b\n+B\n c\n",
+		},
+		"insertion into empty": {
+			old:      "",
+			new:      "a\n",
+			expected: "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		"missing trailing newline": {
+			old: "a\n",
+			new: "a",
+			expected: "--- old\n+++ new\n@@ -1 +1 @@\n" +
+				"-a\n+a\n\\ No newline at end of file\n",
+		},
+		"separate hunks": {
+			old: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new: "0\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n13\n",
+			expected: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n" +
+				"-1\n+0\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+13\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := string(Unified("old", "new", []byte(tc.old), []byte(tc.new)))
+			if got != tc.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnified_LargeInput(t *testing.T) {
+	old := strings.Repeat("line\n", 10000)
+	new := old + "extra\n"
+	got := string(Unified("old", "new", []byte(old), []byte(new)))
+	if !strings.Contains(got, "@@ -9998,3 +9998,4 @@\n line\n line\n line\n+extra\n") {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+}
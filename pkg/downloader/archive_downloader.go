@@ -0,0 +1,203 @@
+package downloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Format is the format of a downloaded asset.
+type Format string
+
+const (
+	FormatZip   Format = "zip"
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+	FormatTarXz Format = "tar.xz"
+	// FormatRaw is a single file, such as the binary of a plugin release.
+	FormatRaw Format = "raw"
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte("\x1f\x8b")
+	xzMagic       = []byte("\xfd7zXZ\x00")
+	tarMagic      = []byte("ustar")
+)
+
+// DetectFormat detects the format of an asset from its first bytes, or from
+// the extension of its name and then its Content-Type when they are not
+// those of an archive. Assets of no archive format are raw.
+func DetectFormat(name, contentType string, head []byte) Format {
+	switch {
+	case bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, emptyZipMagic):
+		return FormatZip
+	case bytes.HasPrefix(head, gzipMagic):
+		return FormatTarGz
+	case bytes.HasPrefix(head, xzMagic):
+		return FormatTarXz
+	case len(head) >= 262 && bytes.Equal(head[257:262], tarMagic):
+		return FormatTar
+	}
+
+	// Corrupt archives are reported as such rather than taken as raw.
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(name, ".tar.xz") || strings.HasSuffix(name, ".txz"):
+		return FormatTarXz
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed":
+		return FormatZip
+	case "application/gzip", "application/x-gzip":
+		return FormatTarGz
+	case "application/x-xz":
+		return FormatTarXz
+	case "application/x-tar":
+		return FormatTar
+	}
+	return FormatRaw
+}
+
+// ArchiveDownloader downloads and extracts zip, tar.gz, tar.xz and tar
+// archives, detecting their format with DetectFormat. Raw assets are written
+// to the bin directory under the name of the downloaded file, such as
+// bin/protoc-gen-foo-linux-amd64.
+type ArchiveDownloader struct {
+	FileDownloader
+	// Limits bound what extracting an archive may write.
+	Limits Limits
+	// Observer, when set, is notified of every download and extraction.
+	Observer Observer
+}
+
+// Observer is notified of the time spent downloading and extracting assets,
+// such as to report where time goes.
+type Observer interface {
+	// Downloaded is called once size bytes were downloaded from url.
+	Downloaded(url string, size int64, elapsed time.Duration)
+	// Extracted is called once the asset downloaded from url was extracted.
+	Extracted(url string, elapsed time.Duration)
+}
+
+func NewArchiveDownloader() *ArchiveDownloader {
+	return &ArchiveDownloader{Limits: DefaultLimits}
+}
+
+// DownloadAndExtract downloads the asset at url and extracts it to destDir.
+func (downloader *ArchiveDownloader) DownloadAndExtract(url string, destDir string) error {
+	return downloader.DownloadVerifyAndExtract(url, destDir, nil)
+}
+
+// DownloadVerifyAndExtract is like DownloadAndExtract, but calls verify with
+// the path of the downloaded asset before extracting it. Nothing is
+// extracted when verify fails.
+func (downloader *ArchiveDownloader) DownloadVerifyAndExtract(
+	url string, destDir string, verify func(archivePath string) error,
+) error {
+	tempFile, err := os.CreateTemp("", "go-protoc-download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	start := time.Now()
+	size, contentType, err := downloader.DownloadFileWithType(url, tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	tempFile.Close()
+	if downloader.Observer != nil {
+		downloader.Observer.Downloaded(url, size, time.Since(start))
+	}
+
+	if verify != nil {
+		if err := verify(tempFile.Name()); err != nil {
+			return err
+		}
+	}
+	start = time.Now()
+	if err := Extract(tempFile.Name(), assetName(url), contentType, destDir, downloader.Limits); err != nil {
+		return err
+	}
+	if downloader.Observer != nil {
+		downloader.Observer.Extracted(url, time.Since(start))
+	}
+	return nil
+}
+
+// Extract extracts the asset at archivePath, downloaded as name with the
+// given Content-Type, to destDir. Errors caused by the asset wrap
+// ErrInvalidArchive, ErrUnsafeEntry or ErrLimitExceeded.
+func Extract(archivePath, name, contentType, destDir string, limits Limits) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch DetectFormat(name, contentType, head[:n]) {
+	case FormatZip:
+		return extractAll(archivePath, destDir, limits)
+	case FormatTar:
+		return extractTar(file, destDir, limits)
+	case FormatTarGz:
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip file: %w: %v", ErrInvalidArchive, err)
+		}
+		defer gzipReader.Close()
+		return extractTar(gzipReader, destDir, limits)
+	case FormatTarXz:
+		xzReader, err := xz.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open xz file: %w: %v", ErrInvalidArchive, err)
+		}
+		return extractTar(xzReader, destDir, limits)
+	}
+
+	rawName := path.Join("bin", name)
+	x := newExtraction(destDir, limits)
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := x.add(rawName, info.Mode(), info.Size()); err != nil {
+		return err
+	}
+	return x.file(rawName, file)
+}
+
+// assetName returns the name of the file downloaded from rawURL.
+func assetName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
@@ -0,0 +1,320 @@
+package downloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// tarEntry is an entry of a tar archive written by writeTar.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []tarEntry) {
+	t.Helper()
+	tarWriter := tar.NewWriter(w)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Mode:     0600,
+			Size:     int64(len(entry.content)),
+			Linkname: entry.linkname,
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tarGz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	writeTar(t, gzipWriter, entries)
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarXz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	xzWriter, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTar(t, xzWriter, entries)
+	if err := xzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var releaseEntries = []tarEntry{
+	{name: "./", typeflag: tar.TypeDir},
+	{name: "./bin/", typeflag: tar.TypeDir},
+	{name: "./bin/protoc", typeflag: tar.TypeReg, content: "mock protoc binary"},
+	{name: "include/google/protobuf/any.proto", typeflag: tar.TypeReg, content: "syntax = \"proto3\";"},
+}
+
+func TestDetectFormat(t *testing.T) {
+	tarContent := new(bytes.Buffer)
+	writeTar(t, tarContent, releaseEntries)
+	testCases := map[string]struct {
+		name        string
+		contentType string
+		head        []byte
+		expected    Format
+	}{
+		"zip magic":          {name: "protoc", head: createTestZip(t, map[string]string{"a": "a"}), expected: FormatZip},
+		"empty zip magic":    {name: "protoc", head: createTestZip(t, nil), expected: FormatZip},
+		"gzip magic":         {name: "protoc.zip", head: tarGz(t, releaseEntries), expected: FormatTarGz},
+		"xz magic":           {name: "protoc", head: tarXz(t, releaseEntries), expected: FormatTarXz},
+		"tar magic":          {name: "protoc", head: tarContent.Bytes(), expected: FormatTar},
+		"zip extension":      {name: "protoc.ZIP", head: []byte("corrupt"), expected: FormatZip},
+		"tgz extension":      {name: "protoc.tgz", head: []byte("corrupt"), expected: FormatTarGz},
+		"tar.xz extension":   {name: "protoc.tar.xz", head: []byte("corrupt"), expected: FormatTarXz},
+		"zip content type":   {name: "download", contentType: "application/zip", head: []byte("corrupt"), expected: FormatZip},
+		"gzip content type":  {name: "download", contentType: "application/gzip; charset=binary", expected: FormatTarGz},
+		"binary":             {name: "protoc-gen-foo", contentType: "application/octet-stream", head: []byte("\x7fELF"), expected: FormatRaw},
+		"windows executable": {name: "protoc-gen-foo.exe", head: []byte("MZ"), expected: FormatRaw},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if format := DetectFormat(tc.name, tc.contentType, tc.head); format != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestArchiveDownloader_DownloadAndExtract(t *testing.T) {
+	testCases := map[string]struct {
+		path     string
+		content  []byte
+		expected map[string]string
+	}{
+		"zip": {
+			path:     "/protoc.zip",
+			content:  createTestZip(t, map[string]string{"bin/protoc": "mock protoc binary"}),
+			expected: map[string]string{"bin/protoc": "mock protoc binary"},
+		},
+		"tar.gz": {
+			path:    "/protoc.tar.gz",
+			content: tarGz(t, releaseEntries),
+			expected: map[string]string{
+				"bin/protoc":                        "mock protoc binary",
+				"include/google/protobuf/any.proto": "syntax = \"proto3\";",
+			},
+		},
+		"tar.xz without extension": {
+			path:     "/download",
+			content:  tarXz(t, releaseEntries),
+			expected: map[string]string{"bin/protoc": "mock protoc binary"},
+		},
+		"raw": {
+			path:     "/releases/protoc-gen-foo-linux-amd64",
+			content:  []byte("\x7fELF mock plugin"),
+			expected: map[string]string{"bin/protoc-gen-foo-linux-amd64": "\x7fELF mock plugin"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tc.path {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Header().Set("Content-Length", fmt.Sprint(len(tc.content)))
+				w.Write(tc.content)
+			}))
+			defer server.Close()
+
+			destDir := t.TempDir()
+			if err := NewArchiveDownloader().DownloadAndExtract(server.URL+tc.path, destDir); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			for name, expectedContent := range tc.expected {
+				content, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Errorf("Expected %s to be extracted, got: %v", name, err)
+					continue
+				}
+				if string(content) != expectedContent {
+					t.Errorf("Expected %s to contain %q, got %q", name, expectedContent, content)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_TarErrors(t *testing.T) {
+	testCases := map[string]struct {
+		name        string
+		content     []byte
+		limits      Limits
+		expectedErr error
+	}{
+		"path traversal": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, []tarEntry{{name: "../evil", typeflag: tar.TypeReg, content: "evil"}}),
+			expectedErr: ErrUnsafeEntry,
+		},
+		"absolute path": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, []tarEntry{{name: "/etc/passwd", typeflag: tar.TypeReg, content: "evil"}}),
+			expectedErr: ErrUnsafeEntry,
+		},
+		"symbolic link": {
+			name:        "protoc.tar.xz",
+			content:     tarXz(t, []tarEntry{{name: "bin/protoc", typeflag: tar.TypeSymlink, linkname: "/usr/bin/protoc"}}),
+			expectedErr: ErrUnsafeEntry,
+		},
+		"hard link": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, []tarEntry{{name: "bin/protoc", typeflag: tar.TypeLink, linkname: "/etc/passwd"}}),
+			expectedErr: ErrUnsafeEntry,
+		},
+		"device": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, []tarEntry{{name: "dev/null", typeflag: tar.TypeChar}}),
+			expectedErr: ErrUnsafeEntry,
+		},
+		"too many files": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, releaseEntries),
+			limits:      Limits{MaxFiles: 2},
+			expectedErr: ErrLimitExceeded,
+		},
+		"file too large": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, releaseEntries),
+			limits:      Limits{MaxFileSize: 5},
+			expectedErr: ErrLimitExceeded,
+		},
+		"raw file too large": {
+			name:        "protoc-gen-foo",
+			content:     []byte("0123456789"),
+			limits:      Limits{MaxFileSize: 5},
+			expectedErr: ErrLimitExceeded,
+		},
+		"corrupt gzip": {
+			name:        "protoc.tar.gz",
+			content:     []byte("not a gzip file"),
+			expectedErr: ErrInvalidArchive,
+		},
+		"truncated tar.gz": {
+			name:        "protoc.tar.gz",
+			content:     tarGz(t, releaseEntries)[:40],
+			expectedErr: ErrInvalidArchive,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), "download")
+			if err := os.WriteFile(archivePath, tc.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := Extract(archivePath, tc.name, "", t.TempDir(), tc.limits)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestExtract_SkipSymlinks(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "tree.tar.gz")
+	content := tarGz(t, []tarEntry{
+		{name: "api/pet.proto", typeflag: tar.TypeReg, content: "syntax"},
+		{name: "api/link.proto", typeflag: tar.TypeSymlink, linkname: "pet.proto"},
+	})
+	if err := os.WriteFile(archivePath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+	if err := Extract(archivePath, "tree.tar.gz", "", destDir, Limits{SkipSymlinks: true}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "api", "pet.proto")); err != nil {
+		t.Errorf("Expected the regular file to be extracted, got: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, "api", "link.proto")); err == nil {
+		t.Errorf("Expected the symbolic link to be left out")
+	}
+}
+
+type recordingObserver struct {
+	downloaded, extracted []string
+	size                  int64
+}
+
+func (o *recordingObserver) Downloaded(url string, size int64, elapsed time.Duration) {
+	o.downloaded = append(o.downloaded, url)
+	o.size += size
+}
+
+func (o *recordingObserver) Extracted(url string, elapsed time.Duration) {
+	o.extracted = append(o.extracted, url)
+}
+
+func TestArchiveDownloader_Observer(t *testing.T) {
+	content := tarGz(t, releaseEntries)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	observer := &recordingObserver{}
+	archiveDownloader := NewArchiveDownloader()
+	archiveDownloader.Observer = observer
+	url := server.URL + "/protoc.tar.gz"
+	if err := archiveDownloader.DownloadAndExtract(url, t.TempDir()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(observer.downloaded) != 1 || observer.downloaded[0] != url || observer.size != int64(len(content)) {
+		t.Errorf("Expected a download of %d bytes from %s, got %v (%d bytes)", len(content), url, observer.downloaded, observer.size)
+	}
+	if len(observer.extracted) != 1 {
+		t.Errorf("Expected an extraction, got %v", observer.extracted)
+	}
+
+	// Failed verifications are not extracted.
+	observer = &recordingObserver{}
+	archiveDownloader.Observer = observer
+	err := archiveDownloader.DownloadVerifyAndExtract(url, t.TempDir(), func(string) error { return errors.New("untrusted") })
+	if err == nil {
+		t.Errorf("Expected verification error")
+	}
+	if len(observer.downloaded) != 1 || len(observer.extracted) != 0 {
+		t.Errorf("Expected a download without extraction, got %v and %v", observer.downloaded, observer.extracted)
+	}
+}
@@ -0,0 +1,283 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrInvalidArchive is returned when an archive is corrupt or not an
+	// archive at all.
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrUnsafeEntry is returned for archive entries that could write outside
+	// of the destination directory or are not regular files or directories,
+	// such as absolute paths, symbolic links and devices.
+	ErrUnsafeEntry = errors.New("unsafe archive entry")
+	// ErrLimitExceeded is returned when extracting an archive would exceed
+	// its Limits.
+	ErrLimitExceeded = errors.New("archive exceeds extraction limits")
+)
+
+// Limits bound what extracting an archive may write. Zero values select the
+// values of DefaultLimits.
+type Limits struct {
+	// MaxSize is the total uncompressed size of the files, in bytes.
+	MaxSize int64
+	// MaxFileSize is the uncompressed size of a single file, in bytes.
+	MaxFileSize int64
+	// MaxFiles is the number of entries, directories included.
+	MaxFiles int
+	// SkipSymlinks leaves symbolic links out instead of rejecting the
+	// archive, for trusted archives such as git trees.
+	SkipSymlinks bool
+}
+
+// DefaultLimits fit protoc releases and archives of proto repositories such
+// as googleapis with room to spare.
+var DefaultLimits = Limits{
+	MaxSize:     1 << 30,
+	MaxFileSize: 256 << 20,
+	MaxFiles:    100_000,
+}
+
+func (limits Limits) withDefaults() Limits {
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = DefaultLimits.MaxSize
+	}
+	if limits.MaxFileSize <= 0 {
+		limits.MaxFileSize = DefaultLimits.MaxFileSize
+	}
+	if limits.MaxFiles <= 0 {
+		limits.MaxFiles = DefaultLimits.MaxFiles
+	}
+	return limits
+}
+
+// extractAll extracts all files from a zip archive to the destination
+// directory. Errors caused by the archive wrap ErrInvalidArchive,
+// ErrUnsafeEntry or ErrLimitExceeded, while other errors are I/O failures.
+// Permissions are not taken from the archive: files are executable only
+// under a bin directory.
+func extractAll(zipPath, destDir string, limits Limits) error {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %w: %v", ErrInvalidArchive, err)
+	}
+	defer zipReader.Close()
+
+	// Check every entry first, so that nothing is extracted from archives
+	// known to be rejected.
+	check := newExtraction(destDir, limits)
+	for _, file := range zipReader.File {
+		if check.skip(file.Mode()) {
+			continue
+		}
+		if err := check.add(file.Name, file.Mode(), int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
+	}
+
+	x := newExtraction(destDir, limits)
+	for _, file := range zipReader.File {
+		if x.skip(file.Mode()) {
+			continue
+		}
+		if err := x.add(file.Name, file.Mode(), int64(file.UncompressedSize64)); err != nil {
+			return err
+		}
+		if file.Mode().IsDir() {
+			if err := x.dir(file.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		fileReader, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open file in zip: %s: %w: %v", file.Name, ErrInvalidArchive, err)
+		}
+		err = x.file(file.Name, fileReader)
+		fileReader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extraction writes the entries of an archive into destDir within limits.
+type extraction struct {
+	destDir   string
+	limits    Limits
+	files     int
+	declared  int64
+	remaining int64
+}
+
+func newExtraction(destDir string, limits Limits) *extraction {
+	limits = limits.withDefaults()
+	return &extraction{destDir: destDir, limits: limits, remaining: limits.MaxSize}
+}
+
+// skip reports whether an entry of the given mode is left out.
+func (x *extraction) skip(mode fs.FileMode) bool {
+	return x.limits.SkipSymlinks && mode&fs.ModeSymlink != 0
+}
+
+// add checks an entry of the archive of the given uncompressed size before
+// it is extracted.
+func (x *extraction) add(name string, mode fs.FileMode, size int64) error {
+	if err := checkEntry(name, mode); err != nil {
+		return err
+	}
+	x.files++
+	if x.files > x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, x.limits.MaxFiles)
+	}
+	if size > x.limits.MaxFileSize {
+		return fmt.Errorf("%w: %s is %d bytes, at most %d allowed", ErrLimitExceeded, name, size, x.limits.MaxFileSize)
+	}
+	x.declared += size
+	if x.declared > x.limits.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, x.limits.MaxSize)
+	}
+	return nil
+}
+
+// dir creates the directory of an entry.
+func (x *extraction) dir(name string) error {
+	destPath := filepath.Join(x.destDir, filepath.FromSlash(strings.TrimSuffix(name, "/")))
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return nil
+}
+
+// file writes the content of an entry. Sizes are enforced while writing, as
+// headers may lie.
+func (x *extraction) file(name string, r io.Reader) error {
+	destPath := filepath.Join(x.destDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	written, err := writeEntry(destPath, fileMode(name), r, min(x.limits.MaxFileSize, x.remaining))
+	x.remaining -= written
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return nil
+}
+
+// checkEntry returns an error wrapping ErrUnsafeEntry unless the entry is a
+// regular file or directory within the destination directory.
+func checkEntry(name string, mode fs.FileMode) error {
+	clean := strings.TrimSuffix(name, "/")
+	if strings.HasPrefix(name, "/") || strings.Contains(name, `\`) || filepath.IsAbs(name) ||
+		filepath.VolumeName(name) != "" || !fs.ValidPath(clean) || clean == "." {
+		return fmt.Errorf("invalid file path: %s: %w", name, ErrUnsafeEntry)
+	}
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return fmt.Errorf("symbolic link %s: %w", name, ErrUnsafeEntry)
+	case !mode.IsDir() && !mode.IsRegular():
+		return fmt.Errorf("special file %s (%s): %w", name, mode.Type(), ErrUnsafeEntry)
+	}
+	return nil
+}
+
+// fileMode returns the permissions of an extracted file, executable only in
+// a bin directory, like bin/protoc.
+func fileMode(name string) fs.FileMode {
+	if path.Base(path.Dir(name)) == "bin" {
+		return 0755
+	}
+	return 0644
+}
+
+// writeEntry writes the content of r, of at most limit bytes, to destPath.
+// Read errors are failures of the archive and wrap ErrInvalidArchive.
+func writeEntry(destPath string, mode fs.FileMode, r io.Reader, limit int64) (int64, error) {
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer destFile.Close()
+	// Existing files keep their permissions with O_CREATE.
+	if err := destFile.Chmod(mode); err != nil {
+		return 0, err
+	}
+
+	var written int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := r.Read(buf)
+		if written+int64(n) > limit {
+			return written, fmt.Errorf("%w: more than %d bytes uncompressed", ErrLimitExceeded, limit)
+		}
+		if n > 0 {
+			if _, err := destFile.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return written, fmt.Errorf("%w: %v", ErrInvalidArchive, readErr)
+		}
+	}
+	return written, destFile.Close()
+}
+
+// extractTar extracts all files from a tar stream to the destination
+// directory, with the same checks as extractAll. Entries are checked as they
+// are read, so a rejected archive may be partially extracted.
+func extractTar(r io.Reader, destDir string, limits Limits) error {
+	tarReader := tar.NewReader(r)
+	x := newExtraction(destDir, limits)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w: %v", ErrInvalidArchive, err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		// Archives created from a directory with tar -C dir . have entries
+		// prefixed with ./, and the directory itself.
+		name := strings.TrimPrefix(header.Name, "./")
+		if name == "" {
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			return fmt.Errorf("hard link %s: %w", name, ErrUnsafeEntry)
+		}
+		mode := header.FileInfo().Mode()
+		if x.skip(mode) {
+			continue
+		}
+		if err := x.add(name, mode, header.Size); err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			if err := x.dir(name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := x.file(name, tarReader); err != nil {
+			return err
+		}
+	}
+}
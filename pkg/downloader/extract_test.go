@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// zipEntry is an entry of a zip archive written by writeZip.
+type zipEntry struct {
+	name    string
+	mode    fs.FileMode
+	content string
+	// crc32 overrides the checksum of the content when not zero.
+	crc32 uint32
+}
+
+func writeZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Store}
+		header.SetMode(entry.mode)
+		if entry.crc32 == 0 {
+			writer, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.Write([]byte(entry.content))
+			continue
+		}
+		header.CRC32 = entry.crc32
+		header.CompressedSize64 = uint64(len(entry.content))
+		header.UncompressedSize64 = uint64(len(entry.content))
+		writer, err := zipWriter.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(entry.content))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(zipPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return zipPath
+}
+
+func TestExtractAll_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		entries     []zipEntry
+		limits      Limits
+		expectedErr error
+	}{
+		"absolute path": {
+			entries:     []zipEntry{{name: "/etc/passwd", mode: 0644}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"windows path": {
+			entries:     []zipEntry{{name: `..\evil.txt`, mode: 0644}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"path traversal": {
+			entries:     []zipEntry{{name: "include/../../evil.txt", mode: 0644}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"symbolic link": {
+			entries:     []zipEntry{{name: "bin/protoc", mode: fs.ModeSymlink | 0777, content: "/usr/bin/protoc"}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"device": {
+			entries:     []zipEntry{{name: "dev/null", mode: fs.ModeDevice | fs.ModeCharDevice | 0666}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"named pipe": {
+			entries:     []zipEntry{{name: "fifo", mode: fs.ModeNamedPipe | 0666}},
+			expectedErr: ErrUnsafeEntry,
+		},
+		"too many files": {
+			entries:     []zipEntry{{name: "a.txt", mode: 0644}, {name: "b.txt", mode: 0644}},
+			limits:      Limits{MaxFiles: 1},
+			expectedErr: ErrLimitExceeded,
+		},
+		"file too large": {
+			entries:     []zipEntry{{name: "bin/protoc", mode: 0755, content: "0123456789"}},
+			limits:      Limits{MaxFileSize: 5},
+			expectedErr: ErrLimitExceeded,
+		},
+		"archive too large": {
+			entries:     []zipEntry{{name: "a.txt", mode: 0644, content: "0123"}, {name: "b.txt", mode: 0644, content: "4567"}},
+			limits:      Limits{MaxSize: 6},
+			expectedErr: ErrLimitExceeded,
+		},
+		"checksum mismatch": {
+			entries:     []zipEntry{{name: "bin/protoc", mode: 0755, content: "protoc", crc32: crc32.ChecksumIEEE([]byte("other"))}},
+			expectedErr: ErrInvalidArchive,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			destDir := t.TempDir()
+			err := extractAll(writeZip(t, tc.entries), destDir, tc.limits)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestExtractAll_NotAZip(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(zipPath, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractAll(zipPath, t.TempDir(), Limits{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Expected %v, got: %v", ErrInvalidArchive, err)
+	}
+}
+
+func TestExtractAll_Modes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not supported on Windows")
+	}
+	zipPath := writeZip(t, []zipEntry{
+		{name: "bin/", mode: fs.ModeDir | 0700},
+		{name: "bin/protoc", mode: 0600, content: "protoc"},
+		{name: "include/google/protobuf/any.proto", mode: 0777, content: "syntax = \"proto3\";"},
+		{name: "readme.txt", mode: 0755 | fs.ModeSetuid, content: "readme"},
+	})
+	destDir := t.TempDir()
+	if err := extractAll(zipPath, destDir, Limits{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := map[string]fs.FileMode{
+		"bin":                               fs.ModeDir | 0755,
+		"bin/protoc":                        0755,
+		"include/google/protobuf/any.proto": 0644,
+		"readme.txt":                        0644,
+	}
+	for name, mode := range expected {
+		info, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Expected %s to be extracted, got: %v", name, err)
+			continue
+		}
+		if info.Mode() != mode {
+			t.Errorf("Expected %s to have mode %v, got %v", name, mode, info.Mode())
+		}
+	}
+}
@@ -14,34 +14,41 @@ func NewFileDownloader() *FileDownloader {
 }
 
 func (downloader *FileDownloader) DownloadFile(url string, w io.Writer) (int64, error) {
+	written, _, err := downloader.DownloadFileWithType(url, w)
+	return written, err
+}
+
+// DownloadFileWithType is like DownloadFile, but also returns the
+// Content-Type of the response.
+func (downloader *FileDownloader) DownloadFileWithType(url string, w io.Writer) (int64, string, error) {
 	// Get the data.
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	defer resp.Body.Close()
 
 	// Check for HTTP errors.
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("bad status: %s", resp.Status)
+		return 0, "", fmt.Errorf("bad status: %s", resp.Status)
 	}
 
 	contentLength := resp.Header.Get("Content-Length")
 	if contentLength == "" {
-		return 0, fmt.Errorf("Content-Length header is missing")
+		return 0, "", fmt.Errorf("Content-Length header is missing")
 	}
 	expectedLength, err := strconv.ParseInt(contentLength, 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse Content-Length: %w", err)
+		return 0, "", fmt.Errorf("failed to parse Content-Length: %w", err)
 	}
 
 	// Write to destination.
 	written, err := io.Copy(w, io.LimitReader(resp.Body, expectedLength))
 	if err != nil {
-		return written, err
+		return written, "", err
 	}
 	if written != expectedLength {
-		return written, fmt.Errorf("expected %d bytes, got %d", expectedLength, written)
+		return written, "", fmt.Errorf("expected %d bytes, got %d", expectedLength, written)
 	}
-	return written, nil
+	return written, resp.Header.Get("Content-Type"), nil
 }
@@ -157,6 +157,47 @@ func TestZipDownloader_DownloadAndExtract_InvalidZip(t *testing.T) {
 	}
 }
 
+func TestZipDownloader_DownloadVerifyAndExtract(t *testing.T) {
+	zipContent := createTestZip(t, map[string]string{"bin/protoc": "mock protoc binary"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(zipContent)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(zipContent)
+	}))
+	defer server.Close()
+	downloader := NewZipDownloader()
+
+	tempDir := t.TempDir()
+	err := downloader.DownloadVerifyAndExtract(server.URL, tempDir, func(zipPath string) error {
+		content, err := os.ReadFile(zipPath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, zipContent) {
+			t.Errorf("Expected the downloaded zip file to be verified")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "bin", "protoc")); err != nil {
+		t.Errorf("Expected extracted binary, got: %v", err)
+	}
+
+	// Nothing is extracted when verification fails.
+	tempDir = t.TempDir()
+	err = downloader.DownloadVerifyAndExtract(server.URL, tempDir, func(string) error {
+		return fmt.Errorf("untrusted archive")
+	})
+	if err == nil || err.Error() != "untrusted archive" {
+		t.Errorf("Expected verification error, got: %v", err)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("Expected nothing extracted, got %d entries", len(entries))
+	}
+}
+
 func TestZipDownloader_DownloadAndExtract_ZipSlipProtection(t *testing.T) {
 	// Create a malicious zip with path traversal
 	zipContent := createMaliciousZip(t)
@@ -0,0 +1,208 @@
+package editions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// MinProtocVersions are the first protoc releases supporting each edition.
+// Files with syntax "proto2" or "proto3" compile with any release.
+var MinProtocVersions = map[string]string{
+	"2023": "27.0",
+	"2024": "32.0",
+}
+
+// declarationPattern matches the syntax or edition declaration of a proto
+// file, which is its first statement.
+var declarationPattern = regexp.MustCompile(`(?m)^\s*(syntax|edition)\s*=\s*"([^"]*)"\s*;`)
+
+// Declaration returns the syntax or edition declared by the content of a
+// proto file, such as `syntax = "proto3"` or `edition = "2023"`. Files
+// without a declaration are proto2.
+func Declaration(content []byte) (keyword, value string) {
+	match := declarationPattern.FindSubmatch(content)
+	if match == nil {
+		return "syntax", "proto2"
+	}
+	return string(match[1]), string(match[2])
+}
+
+// Requirement is the minimum protoc version required by a proto file.
+type Requirement struct {
+	File    string
+	Edition string
+	// MinVersion is a protoc version without the 'v' prefix, like the
+	// versions of MinProtocVersions.
+	MinVersion string
+}
+
+func (r *Requirement) String() string {
+	return fmt.Sprintf("%s uses edition %s, which requires protoc %s or newer", r.File, r.Edition, r.MinVersion)
+}
+
+// Require returns the strictest requirement of the input files, relative to
+// dir, or nil if any protoc release compiles them. Missing files are left
+// for protoc to report, and editions missing from MinProtocVersions are
+// assumed to be supported.
+func Require(dir string, inputs []string) *Requirement {
+	var strictest *Requirement
+	for _, input := range inputs {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(input)))
+		if err != nil {
+			continue
+		}
+		keyword, edition := Declaration(content)
+		if keyword != "edition" {
+			continue
+		}
+		minVersion, ok := MinProtocVersions[edition]
+		if !ok {
+			continue
+		}
+		if strictest == nil || compare(minVersion, strictest.MinVersion) > 0 {
+			strictest = &Requirement{File: input, Edition: edition, MinVersion: minVersion}
+		}
+	}
+	return strictest
+}
+
+// Satisfies reports whether the protoc version, with or without the 'v'
+// prefix, meets the requirement. A nil requirement is always met, and so is
+// any version that is not a release version.
+func (r *Requirement) Satisfies(version string) bool {
+	if r == nil || !semver.IsValid(canonical(version)) {
+		return true
+	}
+	return compare(version, r.MinVersion) >= 0
+}
+
+// Range is a range of protoc versions given instead of a release tag, such
+// as ">=v27.0" or ">=v25.0 <v30.0".
+type Range struct {
+	// Min is the lowest version of the range, and Max, when not empty, the
+	// version the range ends at. Versions have no 'v' prefix.
+	Min, Max string
+	// MaxInclusive is set when Max is part of the range.
+	MaxInclusive bool
+}
+
+// IsRange reports whether a protoc release tag is a version range.
+func IsRange(tag string) bool {
+	return strings.HasPrefix(tag, ">") || strings.HasPrefix(tag, "<")
+}
+
+// ParseRange parses a version range of space or comma separated bounds,
+// >=V for the lower one and <V or <=V for the upper one.
+func ParseRange(tag string) (Range, error) {
+	var r Range
+	for _, bound := range strings.FieldsFunc(tag, func(c rune) bool { return c == ' ' || c == ',' }) {
+		operator := strings.TrimRight(bound, "v0123456789.")
+		version := strings.TrimPrefix(bound[len(operator):], "v")
+		if !semver.IsValid(canonical(version)) {
+			return Range{}, fmt.Errorf("invalid version range %q: invalid version in %q", tag, bound)
+		}
+		switch operator {
+		case ">=":
+			r.Min = version
+		case "<", "<=":
+			r.Max, r.MaxInclusive = version, operator == "<="
+		default:
+			return Range{}, fmt.Errorf("invalid version range %q: unsupported bound %q", tag, bound)
+		}
+	}
+	if r.Min == "" {
+		return Range{}, fmt.Errorf("invalid version range %q: a lower bound such as >=v27.0 is required", tag)
+	}
+	return r, nil
+}
+
+// Contains reports whether the version, without the 'v' prefix, is in the
+// range.
+func (r Range) Contains(version string) bool {
+	if compare(version, r.Min) < 0 {
+		return false
+	}
+	if r.Max == "" {
+		return true
+	}
+	c := compare(version, r.Max)
+	return c < 0 || c == 0 && r.MaxInclusive
+}
+
+// Select returns the release tag of the lowest published version of the
+// range meeting the requirement, which may be nil. Versions are the
+// published versions, without the 'v' prefix, of which prereleases are
+// skipped. When they are nil, the lowest version of the range meeting the
+// requirement is assumed to be published.
+func (r Range) Select(req *Requirement, versions []string) (string, error) {
+	var selected string
+	if versions == nil {
+		selected = r.Min
+		if !req.Satisfies(selected) {
+			selected = req.MinVersion
+		}
+		selected = release(selected)
+		if !r.Contains(selected) {
+			selected = ""
+		}
+	}
+	for _, version := range versions {
+		if strings.Contains(version, "-") || !r.Contains(version) || !req.Satisfies(version) {
+			continue
+		}
+		if selected == "" || compare(version, selected) < 0 {
+			selected = version
+		}
+	}
+	switch {
+	case selected != "":
+		return "v" + selected, nil
+	case req != nil:
+		return "", fmt.Errorf("no protoc version in range %s: %s", r, req)
+	case versions != nil:
+		return "", fmt.Errorf("no published protoc version in range %s", r)
+	}
+	return "", fmt.Errorf("empty protoc version range %s", r)
+}
+
+func (r Range) String() string {
+	s := ">=v" + r.Min
+	switch {
+	case r.Max != "" && r.MaxInclusive:
+		s += " <=v" + r.Max
+	case r.Max != "":
+		s += " <v" + r.Max
+	}
+	return s
+}
+
+// release completes a major version into the tag of its first release, as
+// protoc releases are tagged with at least a major and a minor version.
+func release(version string) string {
+	if !strings.Contains(version, ".") {
+		return version + ".0"
+	}
+	return version
+}
+
+// canonical returns the semantic version of a protoc version, such as
+// v27.0.0-rc1 for 27.0-rc1.
+func canonical(version string) string {
+	version, prerelease, found := strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	for strings.Count(version, ".") < 2 {
+		version += ".0"
+	}
+	if found {
+		version += "-" + prerelease
+	}
+	return "v" + version
+}
+
+func compare(a, b string) int {
+	return semver.Compare(canonical(a), canonical(b))
+}
@@ -0,0 +1,211 @@
+package editions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeclaration(t *testing.T) {
+	testCases := map[string]struct {
+		content         string
+		expectedKeyword string
+		expectedValue   string
+	}{
+		"proto3": {
+			content:         "// Pets.\nsyntax = \"proto3\";\npackage pets;\n",
+			expectedKeyword: "syntax",
+			expectedValue:   "proto3",
+		},
+		"edition": {
+			content:         "edition = \"2023\";\n",
+			expectedKeyword: "edition",
+			expectedValue:   "2023",
+		},
+		"spacing": {
+			content:         "  edition=\"2024\" ;\n",
+			expectedKeyword: "edition",
+			expectedValue:   "2024",
+		},
+		"no declaration": {
+			content:         "package pets;\n",
+			expectedKeyword: "syntax",
+			expectedValue:   "proto2",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keyword, value := Declaration([]byte(tc.content))
+			if keyword != tc.expectedKeyword || value != tc.expectedValue {
+				t.Errorf("Expected %s %s, got %s %s", tc.expectedKeyword, tc.expectedValue, keyword, value)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.proto":     "syntax = \"proto3\";\n",
+		"b/b.proto":   "edition = \"2023\";\n",
+		"c.proto":     "edition = \"2024\";\n",
+		"next.proto":  "edition = \"2099\";\n",
+		"empty.proto": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := map[string]struct {
+		inputs   []string
+		expected *Requirement
+	}{
+		"syntax":          {inputs: []string{"a.proto", "empty.proto"}},
+		"unknown edition": {inputs: []string{"next.proto"}},
+		"missing file":    {inputs: []string{"missing.proto"}},
+		"edition": {
+			inputs:   []string{"a.proto", "b/b.proto"},
+			expected: &Requirement{File: "b/b.proto", Edition: "2023", MinVersion: "27.0"},
+		},
+		"strictest": {
+			inputs:   []string{"b/b.proto", "c.proto", "a.proto"},
+			expected: &Requirement{File: "c.proto", Edition: "2024", MinVersion: "32.0"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := Require(dir, tc.inputs)
+			if (req == nil) != (tc.expected == nil) || req != nil && *req != *tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, req)
+			}
+		})
+	}
+}
+
+func TestRequirement_Satisfies(t *testing.T) {
+	req := &Requirement{File: "a.proto", Edition: "2023", MinVersion: "27.0"}
+	testCases := map[string]struct {
+		req      *Requirement
+		version  string
+		expected bool
+	}{
+		"older":          {req: req, version: "26.1", expected: false},
+		"old scheme":     {req: req, version: "3.21.12", expected: false},
+		"minimum":        {req: req, version: "27.0", expected: true},
+		"newer":          {req: req, version: "v32.1", expected: true},
+		"release cand":   {req: req, version: "27.0-rc1", expected: false},
+		"not a version":  {req: req, version: "main", expected: true},
+		"no requirement": {version: "3.0.0", expected: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if satisfied := tc.req.Satisfies(tc.version); satisfied != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, satisfied)
+			}
+		})
+	}
+}
+
+func TestRange_Select(t *testing.T) {
+	req := &Requirement{File: "a.proto", Edition: "2023", MinVersion: "27.0"}
+	testCases := map[string]struct {
+		tag         string
+		req         *Requirement
+		versions    []string
+		expected    string
+		expectedErr string
+	}{
+		"lower bound": {
+			tag:      ">=v25.3",
+			expected: "v25.3",
+		},
+		"lower bound meets requirement": {
+			tag:      ">=v28.2",
+			req:      req,
+			expected: "v28.2",
+		},
+		"requirement": {
+			tag:      ">=v25.0 <v30.0",
+			req:      req,
+			expected: "v27.0",
+		},
+		"major version": {
+			tag:      ">=25,<=27",
+			req:      req,
+			expected: "v27.0",
+		},
+		"excluded upper bound": {
+			tag:         ">=v25.0 <v27.0",
+			req:         req,
+			expectedErr: "no protoc version in range >=v25.0 <v27.0: a.proto uses edition 2023",
+		},
+		"empty": {
+			tag:         ">=v25.0 <v25.0",
+			expectedErr: "empty protoc version range",
+		},
+		"published": {
+			tag:      ">=v26.2",
+			versions: []string{"28.0", "27.1", "27.0", "26.1"},
+			expected: "v27.0",
+		},
+		"published requirement": {
+			tag:      ">=v25.0 <v30.0",
+			req:      req,
+			versions: []string{"28.0", "27.2", "26.1", "25.0"},
+			expected: "v27.2",
+		},
+		"prerelease": {
+			tag:      ">=v28.0",
+			versions: []string{"28.1", "28.0-rc1"},
+			expected: "v28.1",
+		},
+		"none published": {
+			tag:         ">=v25.0 <v26.0",
+			versions:    []string{"26.1"},
+			expectedErr: "no published protoc version in range >=v25.0 <v26.0",
+		},
+		"no lower bound": {
+			tag:         "<v30.0",
+			expectedErr: "a lower bound such as >=v27.0 is required",
+		},
+		"unsupported bound": {
+			tag:         ">v25.0",
+			expectedErr: "unsupported bound",
+		},
+		"invalid version": {
+			tag:         ">=latest",
+			expectedErr: "invalid version",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if !IsRange(tc.tag) {
+				t.Fatalf("Expected %q to be a range", tc.tag)
+			}
+			r, err := ParseRange(tc.tag)
+			var selected string
+			if err == nil {
+				selected, err = r.Select(tc.req, tc.versions)
+			}
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if selected != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, selected)
+			}
+		})
+	}
+}
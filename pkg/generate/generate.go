@@ -0,0 +1,236 @@
+package generate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/protoc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// Plugin generates code from a CodeGeneratorRequest, like a protoc-gen-*
+// binary does with the request protoc writes to its standard input.
+type Plugin func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error)
+
+// Invocation runs a plugin, like the --NAME_out=Out and --NAME_opt=Parameter
+// flags of protoc do for a protoc-gen-NAME binary.
+type Invocation struct {
+	// Name identifies the plugin in errors.
+	Name   string
+	Plugin Plugin
+	// Out is the directory, relative to the generator directory, where the
+	// generated files are written.
+	Out       string
+	Parameter string
+}
+
+// Generator runs protoc once to compile the proto files into descriptors and
+// feeds them to plugins running in-process, so that no protoc-gen-* binary
+// needs to be built or installed.
+type Generator struct {
+	protoc.BinCache
+	// Tag is the protoc release tag to use.
+	Tag string
+	// Dir is the directory protoc runs in, which input and output paths are
+	// relative to. The current directory is used when empty.
+	Dir string
+	// ProtocArgs are extra arguments for protoc, such as include paths.
+	ProtocArgs []string
+	// Stderr receives the output of protoc. Defaults to os.Stderr.
+	Stderr io.Writer
+}
+
+// NewGenerator creates a generator using the protoc release tag from cache.
+func NewGenerator(cache protoc.BinCache, tag string) *Generator {
+	return &Generator{BinCache: cache, Tag: tag}
+}
+
+// Generate compiles the input proto files and runs every invocation on them,
+// writing the files of each response under its output directory.
+func (g *Generator) Generate(inputs []string, invocations ...Invocation) error {
+	set, err := g.compile(inputs)
+	if err != nil {
+		return err
+	}
+	includes := protoc.IncludePaths(g.ProtocArgs)
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = protoc.FileName(g.Dir, includes, input)
+	}
+	compilerVersion := g.compilerVersion()
+	for _, invocation := range invocations {
+		request := NewRequest(set, names, invocation.Parameter)
+		request.CompilerVersion = compilerVersion
+		response, err := invocation.Plugin(request)
+		if err != nil {
+			return fmt.Errorf("plugin %s failed: %w", invocation.Name, err)
+		}
+		if response.Error != nil {
+			return fmt.Errorf("plugin %s failed: %s", invocation.Name, response.GetError())
+		}
+		if err := WriteResponse(filepath.Join(g.Dir, invocation.Out), response); err != nil {
+			return fmt.Errorf("plugin %s: %w", invocation.Name, err)
+		}
+	}
+	return nil
+}
+
+// compile runs protoc, or compiles in-process when the cache is a
+// protoc.Compiler or a protoc.BinRunner, to produce the descriptors of the inputs and their
+// imports.
+func (g *Generator) compile(inputs []string) (*descriptorpb.FileDescriptorSet, error) {
+	out, err := os.CreateTemp("", "go-protoc-*.binpb")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	args := append([]string{
+		"--descriptor_set_out=" + out.Name(), "--include_imports", "--include_source_info",
+	}, g.ProtocArgs...)
+	args = append(args, inputs...)
+	stderr := g.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	dir := g.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if compiler, ok := g.BinCache.(protoc.Compiler); ok {
+		if err := compiler.Compile(context.Background(), dir, args, nil, stderr); err != nil {
+			return nil, fmt.Errorf("failed to run protoc: %w", err)
+		}
+	} else {
+		binPath, err := g.BinPath(g.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get protoc binary %s: %w", g.Tag, err)
+		}
+		if runner, ok := g.BinCache.(protoc.BinRunner); ok {
+			err = runner.RunBin(context.Background(), binPath, dir, args, nil, nil, stderr)
+		} else {
+			cmd := exec.Command(binPath, args...)
+			cmd.Dir = g.Dir
+			cmd.Stderr = stderr
+			err = cmd.Run()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to run protoc: %w", err)
+		}
+	}
+
+	content, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set: %w", err)
+	}
+	return set, nil
+}
+
+// compilerVersion returns the version protoc reports to plugins, or nil when
+// the version of the tag is unknown.
+func (g *Generator) compilerVersion() *pluginpb.Version {
+	version := g.Tag
+	if resolver, ok := g.BinCache.(protoc.VersionResolver); ok {
+		if resolved, err := resolver.ResolveVersion(g.Tag); err == nil {
+			version = resolved
+		}
+	}
+	return CompilerVersion(version)
+}
+
+// CompilerVersion returns the compiler version protoc reports to plugins for
+// a release version such as v29.3, or nil if it is not a release version.
+// Since v22, protoc reports the version of its C++ runtime, whose major
+// version is bumped yearly: v29.3 reports 5.29.3.
+func CompilerVersion(release string) *pluginpb.Version {
+	release, suffix, _ := strings.Cut(strings.TrimPrefix(release, "v"), "-")
+	parts := strings.Split(release, ".")
+	numbers := make([]int32, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil
+		}
+		numbers[i] = int32(n)
+	}
+	var major, minor, patch int32
+	switch {
+	case len(numbers) == 3 && numbers[0] == 3:
+		major, minor, patch = numbers[0], numbers[1], numbers[2]
+	case len(numbers) == 2 && numbers[0] >= 22:
+		minor, patch = numbers[0], numbers[1]
+		switch {
+		case minor >= 30:
+			major = 6
+		case minor >= 26:
+			major = 5
+		default:
+			major = 4
+		}
+	default:
+		return nil
+	}
+	version := &pluginpb.Version{Major: proto.Int32(major), Minor: proto.Int32(minor), Patch: proto.Int32(patch)}
+	if suffix != "" {
+		version.Suffix = proto.String(suffix)
+	}
+	return version
+}
+
+// NewRequest builds the request protoc would send to a plugin generating the
+// files named filesToGenerate out of set. Files are named relative to the
+// include path they were found in, see protoc.FileName. The descriptors in set must be in
+// dependency order, as protoc writes them with --include_imports.
+func NewRequest(set *descriptorpb.FileDescriptorSet, filesToGenerate []string, parameter string) *pluginpb.CodeGeneratorRequest {
+	request := &pluginpb.CodeGeneratorRequest{
+		ProtoFile: set.GetFile(),
+	}
+	for _, name := range filesToGenerate {
+		request.FileToGenerate = append(request.FileToGenerate, filepath.ToSlash(name))
+	}
+	if parameter != "" {
+		request.Parameter = proto.String(parameter)
+	}
+	for _, file := range set.GetFile() {
+		if slices.Contains(request.FileToGenerate, file.GetName()) {
+			request.SourceFileDescriptors = append(request.SourceFileDescriptors, file)
+		}
+	}
+	return request
+}
+
+// WriteResponse writes the files of a plugin response under dir. Insertion
+// points are not supported.
+func WriteResponse(dir string, response *pluginpb.CodeGeneratorResponse) error {
+	for _, file := range response.GetFile() {
+		name := file.GetName()
+		if file.GetInsertionPoint() != "" {
+			return fmt.Errorf("insertion point %q in %s is not supported", file.GetInsertionPoint(), name)
+		}
+		if name == "" || filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(filepath.FromSlash(name)), "..") {
+			return fmt.Errorf("invalid generated file name %q", name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(file.GetContent()), 0644); err != nil {
+			return fmt.Errorf("failed to write generated file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package generate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+type mockBinCache struct {
+	binPath string
+}
+
+func (m *mockBinCache) BinPath(tag string) (string, error) {
+	return m.binPath, nil
+}
+
+// createMockProtoc creates a mock protoc that writes set to
+// --descriptor_set_out.
+func createMockProtoc(t *testing.T, set *descriptorpb.FileDescriptorSet) string {
+	t.Helper()
+	content, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := filepath.Join(t.TempDir(), "fixture.binpb")
+	if err := os.WriteFile(fixture, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return mockprotoc.New(t, mockprotoc.CopiesDescriptorSet(fixture))
+}
+
+func testSet() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("google/protobuf/empty.proto")},
+		{Name: proto.String("api/pet.proto"), Dependency: []string{"google/protobuf/empty.proto"}},
+	}}
+}
+
+func TestGenerator_Generate(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockProtoc(t, testSet())}
+	dir := t.TempDir()
+
+	var request *pluginpb.CodeGeneratorRequest
+	plugin := func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		request = req
+		var names []string
+		for _, file := range req.GetProtoFile() {
+			names = append(names, file.GetName())
+		}
+		return &pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{{
+			Name:    proto.String("api/pet.txt"),
+			Content: proto.String(strings.Join(names, ",") + " " + req.GetParameter()),
+		}}}, nil
+	}
+
+	generator := NewGenerator(cache, "v32.1")
+	generator.Dir = dir
+	err := generator.Generate([]string{"api/pet.proto"}, Invocation{
+		Name:      "names",
+		Plugin:    plugin,
+		Out:       "gen",
+		Parameter: "paths=source_relative",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !reflect.DeepEqual(request.GetFileToGenerate(), []string{"api/pet.proto"}) {
+		t.Errorf("Unexpected files to generate: %v", request.GetFileToGenerate())
+	}
+	if len(request.GetSourceFileDescriptors()) != 1 || request.GetSourceFileDescriptors()[0].GetName() != "api/pet.proto" {
+		t.Errorf("Unexpected source file descriptors: %v", request.GetSourceFileDescriptors())
+	}
+	if !proto.Equal(request.GetCompilerVersion(), CompilerVersion("v32.1")) {
+		t.Errorf("Unexpected compiler version: %v", request.GetCompilerVersion())
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "gen", "api", "pet.txt"))
+	if err != nil {
+		t.Fatalf("Expected generated file, got: %v", err)
+	}
+	expected := "google/protobuf/empty.proto,api/pet.proto paths=source_relative"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, content)
+	}
+}
+
+// mockCompiler compiles in-process, writing set to --descriptor_set_out.
+type mockCompiler struct {
+	mockBinCache
+	set *descriptorpb.FileDescriptorSet
+}
+
+func (m *mockCompiler) Compile(ctx context.Context, dir string, args []string, stdout, stderr io.Writer) error {
+	content, err := proto.Marshal(m.set)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if path, ok := strings.CutPrefix(arg, "--descriptor_set_out="); ok {
+			return os.WriteFile(path, content, 0644)
+		}
+	}
+	return errors.New("missing --descriptor_set_out")
+}
+
+func TestGenerator_Generate_Compiler(t *testing.T) {
+	// The binary of the cache is not run.
+	cache := &mockCompiler{mockBinCache: mockBinCache{binPath: filepath.Join(t.TempDir(), "missing")}, set: testSet()}
+	dir := t.TempDir()
+	var request *pluginpb.CodeGeneratorRequest
+	plugin := func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		request = req
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	}
+
+	generator := NewGenerator(cache, "latest")
+	generator.Dir = dir
+	if err := generator.Generate([]string{"api/pet.proto"}, Invocation{Name: "mock", Plugin: plugin, Out: "."}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(request.GetProtoFile()) != 2 {
+		t.Errorf("Expected the descriptors of the compiler, got %v", request.GetProtoFile())
+	}
+}
+
+// mockBinRunner runs its binary in-process, like mockCompiler compiles.
+type mockBinRunner struct {
+	compiler mockCompiler
+	binPath  string
+}
+
+func (m *mockBinRunner) BinPath(tag string) (string, error) {
+	return m.compiler.BinPath(tag)
+}
+
+func (m *mockBinRunner) RunBin(ctx context.Context, binPath, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.binPath = binPath
+	return m.compiler.Compile(ctx, dir, args, stdout, stderr)
+}
+
+func TestGenerator_Generate_BinRunner(t *testing.T) {
+	// The binary of the cache is not executed.
+	binPath := filepath.Join(t.TempDir(), "protoc")
+	cache := &mockBinRunner{compiler: mockCompiler{mockBinCache: mockBinCache{binPath: binPath}, set: testSet()}}
+	var request *pluginpb.CodeGeneratorRequest
+	plugin := func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		request = req
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	}
+
+	generator := NewGenerator(cache, "latest")
+	generator.Dir = t.TempDir()
+	if err := generator.Generate([]string{"api/pet.proto"}, Invocation{Name: "mock", Plugin: plugin, Out: "."}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.binPath != binPath {
+		t.Errorf("Expected %s to be run, got %q", binPath, cache.binPath)
+	}
+	if len(request.GetProtoFile()) != 2 {
+		t.Errorf("Expected the descriptors of the binary, got %v", request.GetProtoFile())
+	}
+}
+
+func TestGenerator_Generate_IncludePath(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("pet.proto")},
+	}}
+	cache := &mockBinCache{binPath: createMockProtoc(t, set)}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "api", "pet.proto"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var request *pluginpb.CodeGeneratorRequest
+	plugin := func(req *pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+		request = req
+		return &pluginpb.CodeGeneratorResponse{}, nil
+	}
+	generator := NewGenerator(cache, "v32.1")
+	generator.Dir = dir
+	generator.ProtocArgs = []string{"-I", "api"}
+	if err := generator.Generate([]string{"api/pet.proto"}, Invocation{Name: "test", Plugin: plugin}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Files are named relative to their include path, like protoc does.
+	if !reflect.DeepEqual(request.GetFileToGenerate(), []string{"pet.proto"}) {
+		t.Errorf("Unexpected files to generate: %v", request.GetFileToGenerate())
+	}
+	if len(request.GetSourceFileDescriptors()) != 1 {
+		t.Errorf("Unexpected source file descriptors: %v", request.GetSourceFileDescriptors())
+	}
+}
+
+func TestCompilerVersion(t *testing.T) {
+	testCases := map[string]struct {
+		release  string
+		expected *pluginpb.Version
+	}{
+		"v3":        {release: "v3.21.12", expected: &pluginpb.Version{Major: proto.Int32(3), Minor: proto.Int32(21), Patch: proto.Int32(12)}},
+		"v25":       {release: "v25.1", expected: &pluginpb.Version{Major: proto.Int32(4), Minor: proto.Int32(25), Patch: proto.Int32(1)}},
+		"v29":       {release: "v29.3", expected: &pluginpb.Version{Major: proto.Int32(5), Minor: proto.Int32(29), Patch: proto.Int32(3)}},
+		"v32":       {release: "32.1", expected: &pluginpb.Version{Major: proto.Int32(6), Minor: proto.Int32(32), Patch: proto.Int32(1)}},
+		"candidate": {release: "v30.0-rc1", expected: &pluginpb.Version{Major: proto.Int32(6), Minor: proto.Int32(30), Patch: proto.Int32(0), Suffix: proto.String("rc1")}},
+		"latest":    {release: "latest"},
+		"range":     {release: ">=v25.0"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := CompilerVersion(tc.release); !proto.Equal(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGenerator_Generate_PluginErrors(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockProtoc(t, testSet())}
+	testCases := map[string]struct {
+		plugin   Plugin
+		expected string
+	}{
+		"error": {
+			plugin: func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+				return nil, errors.New("boom")
+			},
+			expected: "plugin test failed: boom",
+		},
+		"response error": {
+			plugin: func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+				return &pluginpb.CodeGeneratorResponse{Error: proto.String("bad input")}, nil
+			},
+			expected: "plugin test failed: bad input",
+		},
+		"escaping file name": {
+			plugin: func(*pluginpb.CodeGeneratorRequest) (*pluginpb.CodeGeneratorResponse, error) {
+				return &pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{{
+					Name: proto.String("../outside.go"),
+				}}}, nil
+			},
+			expected: `invalid generated file name "../outside.go"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			generator := NewGenerator(cache, "v32.1")
+			generator.Dir = t.TempDir()
+			err := generator.Generate([]string{"api/pet.proto"}, Invocation{Name: "test", Plugin: tc.plugin})
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got: %v", tc.expected, err)
+			}
+		})
+	}
+}
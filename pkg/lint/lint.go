@@ -0,0 +1,277 @@
+// Package lint checks proto files against style rules, using the descriptors
+// and source info protoc compiles them into.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/sourceinfo"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Violation is a proto element that does not follow a lint rule.
+type Violation struct {
+	// Rule identifies the rule that was not followed, e.g.
+	// "FIELD_LOWER_SNAKE_CASE".
+	Rule string
+	// File is the proto file the violation was found in, and Line and Column
+	// its 1-based position there, or zero when unknown.
+	File         string
+	Line, Column int
+	Message      string
+}
+
+func (v Violation) String() string {
+	if v.Line == 0 {
+		return fmt.Sprintf("%s: %s (%s)", v.File, v.Message, v.Rule)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", v.File, v.Line, v.Column, v.Message, v.Rule)
+}
+
+// Rules are the lint rules, all of which apply unless the configuration
+// selects some of them.
+var Rules = []string{
+	// Files declare a package.
+	"PACKAGE_DEFINED",
+	// The package matches the directory of the file relative to its include
+	// path, e.g. package foo.v1 is in foo/v1.
+	"PACKAGE_DIRECTORY_MATCH",
+	// Files set the go_package option.
+	"GO_PACKAGE_DEFINED",
+	// The zero value of enums ends with _UNSPECIFIED.
+	"ENUM_ZERO_VALUE_SUFFIX",
+	// Field names are lower_snake_case.
+	"FIELD_LOWER_SNAKE_CASE",
+	// Service names are PascalCase.
+	"SERVICE_PASCAL_CASE",
+	// Service names end with Service.
+	"SERVICE_SUFFIX",
+	// RPC names are PascalCase.
+	"RPC_PASCAL_CASE",
+	// Messages, enums, services and RPCs have a leading or trailing comment.
+	"COMMENT_MESSAGE",
+	"COMMENT_ENUM",
+	"COMMENT_SERVICE",
+	"COMMENT_RPC",
+}
+
+// Config selects the lint rules, as read from the "lint" section of the
+// go-protoc.json configuration file:
+//
+//	{"lint": {"except": ["COMMENT_RPC"], "ignore": {"SERVICE_SUFFIX": ["legacy"]}}}
+type Config struct {
+	// Use are the rules to apply, all of them when empty.
+	Use []string `json:"use,omitempty"`
+	// Except are rules not to apply.
+	Except []string `json:"except,omitempty"`
+	// Ignore maps rules to the files or directories, relative to the include
+	// path, they are not applied to.
+	Ignore map[string][]string `json:"ignore,omitempty"`
+}
+
+// ReadConfig reads the lint section of a go-protoc.json configuration file.
+func ReadConfig(configPath string) (*Config, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Lint Config `json:"lint"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+	return &file.Lint, nil
+}
+
+// validate returns an error if the configuration names an unknown rule.
+func (config Config) validate() error {
+	names := slices.Concat(config.Use, config.Except)
+	for rule := range config.Ignore {
+		names = append(names, rule)
+	}
+	for _, rule := range names {
+		if !slices.Contains(Rules, rule) {
+			return fmt.Errorf("unknown lint rule %q", rule)
+		}
+	}
+	return nil
+}
+
+// applies reports whether rule applies to file.
+func (config Config) applies(rule, file string) bool {
+	if len(config.Use) > 0 && !slices.Contains(config.Use, rule) {
+		return false
+	}
+	if slices.Contains(config.Except, rule) {
+		return false
+	}
+	for _, ignored := range config.Ignore[rule] {
+		ignored = strings.TrimSuffix(ignored, "/")
+		if file == ignored || strings.HasPrefix(file, ignored+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// Field numbers of the descriptor messages, used to build source code info
+// paths.
+const (
+	filePackageNumber       = 2
+	fileMessageTypeNumber   = 4
+	fileEnumTypeNumber      = 5
+	fileServiceNumber       = 6
+	messageFieldNumber      = 2
+	messageNestedTypeNumber = 3
+	messageEnumTypeNumber   = 4
+	enumValueNumber         = 2
+	serviceMethodNumber     = 2
+	nameNumber              = 1
+)
+
+var (
+	lowerSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	pascalCase     = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+)
+
+// Lint checks every file of set against the rules selected by config and
+// returns the violations, ordered by file and position. Sets are expected to
+// hold the files to lint only, not their imports.
+func Lint(set *descriptorpb.FileDescriptorSet, config Config) ([]Violation, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	var violations []Violation
+	for _, file := range set.GetFile() {
+		l := &linter{config: config, file: file, locations: sourceinfo.New(file)}
+		l.lintFile()
+		violations = append(violations, l.violations...)
+	}
+	slices.SortStableFunc(violations, func(a, b Violation) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return violations, nil
+}
+
+type linter struct {
+	config     Config
+	file       *descriptorpb.FileDescriptorProto
+	locations  sourceinfo.Locations
+	violations []Violation
+}
+
+func (l *linter) report(rule string, path []int32, format string, args ...any) {
+	if !l.config.applies(rule, l.file.GetName()) {
+		return
+	}
+	line, column := l.locations.Position(path)
+	l.violations = append(l.violations, Violation{
+		Rule:    rule,
+		File:    l.file.GetName(),
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// requireComment reports rule unless the element at path is commented.
+func (l *linter) requireComment(rule string, path []int32, kind, name string) {
+	if l.locations.Comments(path) == "" {
+		l.report(rule, path, "%s %q has no comment", kind, name)
+	}
+}
+
+func (l *linter) lintFile() {
+	pkg := l.file.GetPackage()
+	if pkg == "" {
+		l.report("PACKAGE_DEFINED", nil, "file has no package")
+	} else {
+		dir := "."
+		if i := strings.LastIndex(l.file.GetName(), "/"); i >= 0 {
+			dir = l.file.GetName()[:i]
+		}
+		if expected := strings.ReplaceAll(pkg, ".", "/"); dir != expected {
+			l.report("PACKAGE_DIRECTORY_MATCH", appendPath(nil, filePackageNumber),
+				"package %q is in directory %q, expected %q", pkg, dir, expected)
+		}
+	}
+	if l.file.GetOptions().GetGoPackage() == "" {
+		l.report("GO_PACKAGE_DEFINED", appendPath(nil, filePackageNumber), "file has no go_package option")
+	}
+
+	for i, message := range l.file.GetMessageType() {
+		l.lintMessage(appendPath(nil, fileMessageTypeNumber, i), message)
+	}
+	for i, enum := range l.file.GetEnumType() {
+		l.lintEnum(appendPath(nil, fileEnumTypeNumber, i), enum)
+	}
+	for i, service := range l.file.GetService() {
+		path := appendPath(nil, fileServiceNumber, i)
+		name := service.GetName()
+		if !pascalCase.MatchString(name) {
+			l.report("SERVICE_PASCAL_CASE", appendPath(path, nameNumber), "service name %q is not PascalCase", name)
+		}
+		if !strings.HasSuffix(name, "Service") {
+			l.report("SERVICE_SUFFIX", appendPath(path, nameNumber), "service name %q does not end with Service", name)
+		}
+		l.requireComment("COMMENT_SERVICE", path, "service", name)
+		for j, method := range service.GetMethod() {
+			methodPath := appendPath(path, serviceMethodNumber, j)
+			if !pascalCase.MatchString(method.GetName()) {
+				l.report("RPC_PASCAL_CASE", appendPath(methodPath, nameNumber),
+					"RPC name %q is not PascalCase", method.GetName())
+			}
+			l.requireComment("COMMENT_RPC", methodPath, "RPC", name+"."+method.GetName())
+		}
+	}
+}
+
+func (l *linter) lintMessage(path []int32, message *descriptorpb.DescriptorProto) {
+	// Map entries are generated by protoc for map fields.
+	if message.GetOptions().GetMapEntry() {
+		return
+	}
+	l.requireComment("COMMENT_MESSAGE", path, "message", message.GetName())
+	for i, field := range message.GetField() {
+		if !lowerSnakeCase.MatchString(field.GetName()) {
+			l.report("FIELD_LOWER_SNAKE_CASE", appendPath(path, messageFieldNumber, i, nameNumber),
+				"field name %q is not lower_snake_case", field.GetName())
+		}
+	}
+	for i, nested := range message.GetNestedType() {
+		l.lintMessage(appendPath(path, messageNestedTypeNumber, i), nested)
+	}
+	for i, enum := range message.GetEnumType() {
+		l.lintEnum(appendPath(path, messageEnumTypeNumber, i), enum)
+	}
+}
+
+func (l *linter) lintEnum(path []int32, enum *descriptorpb.EnumDescriptorProto) {
+	l.requireComment("COMMENT_ENUM", path, "enum", enum.GetName())
+	for i, value := range enum.GetValue() {
+		if value.GetNumber() == 0 && !strings.HasSuffix(value.GetName(), "_UNSPECIFIED") {
+			l.report("ENUM_ZERO_VALUE_SUFFIX", appendPath(path, enumValueNumber, i, nameNumber),
+				"enum zero value %q does not end with _UNSPECIFIED", value.GetName())
+		}
+	}
+}
+
+func appendPath(path []int32, elements ...int) []int32 {
+	result := slices.Clone(path)
+	for _, element := range elements {
+		result = append(result, int32(element))
+	}
+	return result
+}
@@ -0,0 +1,218 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// petFile returns a file descriptor following every rule, which tests modify
+// to introduce violations.
+func petFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("petstore/v1/pet.proto"),
+		Package: proto.String("petstore.v1"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/petstore/v1")},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Pet"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("pet_id"), Number: proto.Int32(1)},
+				{Name: proto.String("tags"), Number: proto.Int32(2)},
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name:    proto.String("TagsEntry"),
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Kind"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("KIND_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("KIND_DOG"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("PetStoreService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name: proto.String("GetPet"),
+			}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{2}, Span: []int32{2, 0, 20}},
+				{Path: []int32{4, 0}, Span: []int32{6, 0, 9, 1}, LeadingComments: proto.String(" A pet.\n")},
+				{Path: []int32{4, 0, 2, 0, 1}, Span: []int32{7, 9, 15}},
+				{Path: []int32{5, 0}, Span: []int32{11, 0, 14, 1}, LeadingComments: proto.String(" A kind.\n")},
+				{Path: []int32{5, 0, 2, 0, 1}, Span: []int32{12, 2, 18}},
+				{Path: []int32{6, 0}, Span: []int32{16, 0, 19, 1}, LeadingComments: proto.String(" A store.\n")},
+				{Path: []int32{6, 0, 1}, Span: []int32{16, 8, 23}},
+				{Path: []int32{6, 0, 2, 0}, Span: []int32{18, 2, 40}, LeadingComments: proto.String(" Gets a pet.\n")},
+				{Path: []int32{6, 0, 2, 0, 1}, Span: []int32{18, 6, 12}},
+			},
+		},
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := map[string]struct {
+		modify   func(file *descriptorpb.FileDescriptorProto)
+		expected []string
+	}{
+		"clean": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {},
+		},
+		"no package": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Package = nil },
+			expected: []string{
+				"petstore/v1/pet.proto: file has no package (PACKAGE_DEFINED)",
+			},
+		},
+		"package directory mismatch": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Name = proto.String("pet.proto") },
+			expected: []string{
+				`pet.proto:3:1: package "petstore.v1" is in directory ".", expected "petstore/v1" (PACKAGE_DIRECTORY_MATCH)`,
+			},
+		},
+		"no go_package": {
+			modify: func(file *descriptorpb.FileDescriptorProto) { file.Options = nil },
+			expected: []string{
+				"petstore/v1/pet.proto:3:1: file has no go_package option (GO_PACKAGE_DEFINED)",
+			},
+		},
+		"enum zero value": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				file.EnumType[0].Value[0].Name = proto.String("KIND_UNKNOWN")
+			},
+			expected: []string{
+				`petstore/v1/pet.proto:13:3: enum zero value "KIND_UNKNOWN" does not end with _UNSPECIFIED (ENUM_ZERO_VALUE_SUFFIX)`,
+			},
+		},
+		"field case": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				file.MessageType[0].Field[0].Name = proto.String("petId")
+			},
+			expected: []string{
+				`petstore/v1/pet.proto:8:10: field name "petId" is not lower_snake_case (FIELD_LOWER_SNAKE_CASE)`,
+			},
+		},
+		"service naming": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				file.Service[0].Name = proto.String("pet_store")
+				file.Service[0].Method[0].Name = proto.String("get_pet")
+			},
+			expected: []string{
+				`petstore/v1/pet.proto:17:9: service name "pet_store" is not PascalCase (SERVICE_PASCAL_CASE)`,
+				`petstore/v1/pet.proto:17:9: service name "pet_store" does not end with Service (SERVICE_SUFFIX)`,
+				`petstore/v1/pet.proto:19:7: RPC name "get_pet" is not PascalCase (RPC_PASCAL_CASE)`,
+			},
+		},
+		"missing comments": {
+			modify: func(file *descriptorpb.FileDescriptorProto) {
+				for _, loc := range file.SourceCodeInfo.Location {
+					loc.LeadingComments = nil
+				}
+			},
+			expected: []string{
+				`petstore/v1/pet.proto:7:1: message "Pet" has no comment (COMMENT_MESSAGE)`,
+				`petstore/v1/pet.proto:12:1: enum "Kind" has no comment (COMMENT_ENUM)`,
+				`petstore/v1/pet.proto:17:1: service "PetStoreService" has no comment (COMMENT_SERVICE)`,
+				`petstore/v1/pet.proto:19:3: RPC "PetStoreService.GetPet" has no comment (COMMENT_RPC)`,
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := petFile()
+			tt.modify(file)
+			violations, err := Lint(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}}, Config{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var got []string
+			for _, violation := range violations {
+				got = append(got, violation.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected violations %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLint_Config(t *testing.T) {
+	noComments := func() *descriptorpb.FileDescriptorSet {
+		file := petFile()
+		file.SourceCodeInfo = nil
+		return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}}
+	}
+	tests := map[string]struct {
+		config   Config
+		expected []string
+	}{
+		"all rules": {
+			expected: []string{"COMMENT_MESSAGE", "COMMENT_ENUM", "COMMENT_SERVICE", "COMMENT_RPC"},
+		},
+		"use": {
+			config:   Config{Use: []string{"COMMENT_RPC"}},
+			expected: []string{"COMMENT_RPC"},
+		},
+		"except": {
+			config:   Config{Except: []string{"COMMENT_MESSAGE", "COMMENT_ENUM"}},
+			expected: []string{"COMMENT_SERVICE", "COMMENT_RPC"},
+		},
+		"ignore file": {
+			config:   Config{Ignore: map[string][]string{"COMMENT_RPC": {"petstore/v1/pet.proto"}}},
+			expected: []string{"COMMENT_MESSAGE", "COMMENT_ENUM", "COMMENT_SERVICE"},
+		},
+		"ignore directory": {
+			config:   Config{Ignore: map[string][]string{"COMMENT_SERVICE": {"petstore/"}}},
+			expected: []string{"COMMENT_MESSAGE", "COMMENT_ENUM", "COMMENT_RPC"},
+		},
+		"ignore other directory": {
+			config:   Config{Ignore: map[string][]string{"COMMENT_SERVICE": {"pet"}}},
+			expected: []string{"COMMENT_MESSAGE", "COMMENT_ENUM", "COMMENT_SERVICE", "COMMENT_RPC"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			violations, err := Lint(noComments(), tt.config)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var rules []string
+			for _, violation := range violations {
+				rules = append(rules, violation.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.expected) {
+				t.Errorf("Expected rules %q, got %q", tt.expected, rules)
+			}
+		})
+	}
+}
+
+func TestLint_UnknownRule(t *testing.T) {
+	_, err := Lint(&descriptorpb.FileDescriptorSet{}, Config{Ignore: map[string][]string{"NO_SUCH_RULE": {"a.proto"}}})
+	if err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "go-protoc.json")
+	content := `{"deps": [], "lint": {"except": ["COMMENT_RPC"], "ignore": {"SERVICE_SUFFIX": ["legacy"]}}}`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := &Config{Except: []string{"COMMENT_RPC"}, Ignore: map[string][]string{"SERVICE_SUFFIX": {"legacy"}}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config)
+	}
+}
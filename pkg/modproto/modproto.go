@@ -0,0 +1,252 @@
+package modproto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// CacheDir is the directory of the cache holding the include roots of Go
+// modules.
+const CacheDir = "gomod"
+
+// Module is a module of the build list, as printed by go list -m -json.
+type Module struct {
+	Path    string
+	Version string
+	Dir     string
+	Main    bool
+	Replace *Module
+}
+
+// ListModules returns the build list of the Go module in dir.
+func ListModules(dir string) ([]Module, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list -m all failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var modules []Module
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var m Module
+		if err := decoder.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %w", err)
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// DownloadModule downloads a module into the module cache and returns its
+// directory.
+func DownloadModule(dir string, m Module) (string, error) {
+	cmd := exec.Command("go", "mod", "download", "-json", m.Path+"@"+m.Version)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	var download struct {
+		Dir   string
+		Error string
+	}
+	if jsonErr := json.Unmarshal(output, &download); jsonErr == nil && download.Error != "" {
+		return "", fmt.Errorf("failed to download %s@%s: %s", m.Path, m.Version, download.Error)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s@%s: %w", m.Path, m.Version, err)
+	}
+	return download.Dir, nil
+}
+
+// importPattern matches import statements of proto files.
+var importPattern = regexp.MustCompile(`(?m)^\s*import\s+(?:(?:public|weak)\s+)?"([^"]+)"\s*;`)
+
+// Imports returns the files imported by the content of a proto file.
+func Imports(content []byte) []string {
+	var imports []string
+	for _, match := range importPattern.FindAllSubmatch(content, -1) {
+		imports = append(imports, string(match[1]))
+	}
+	return imports
+}
+
+// Resolver finds the Go modules providing the proto files imported by a
+// module's proto files, such as github.com/org/dep/api/v1/thing.proto for
+// the module github.com/org/dep, and makes them importable.
+type Resolver struct {
+	// Dir is the directory of the Go module, which include paths are
+	// relative to.
+	Dir string
+	// Includes are the include paths of protoc.
+	Includes []string
+	// CacheDir is where the include roots are created.
+	CacheDir string
+	// ListModules and DownloadModule default to the functions of this
+	// package.
+	ListModules    func(dir string) ([]Module, error)
+	DownloadModule func(dir string, m Module) (string, error)
+
+	modules []Module
+}
+
+// NewResolver creates a resolver for the Go module in dir with the given
+// protoc include paths, creating include roots in the go-protoc cacheDir.
+func NewResolver(dir string, includes []string, cacheDir string) *Resolver {
+	return &Resolver{
+		Dir:            dir,
+		Includes:       includes,
+		CacheDir:       filepath.Join(cacheDir, CacheDir),
+		ListModules:    ListModules,
+		DownloadModule: DownloadModule,
+	}
+}
+
+// Resolve follows the imports of the input files and returns the include
+// roots making the ones not found in the include paths importable from the
+// modules of the build list. Imports of well-known types, which come with
+// protoc, are ignored, as are imports that no module provides, which protoc
+// reports. The build list is only listed when an import is not found.
+func (r *Resolver) Resolve(inputs []string) ([]string, error) {
+	var roots []string
+	seen := map[string]bool{}
+	var queue []string
+	for _, input := range inputs {
+		queue = append(queue, filepath.Join(r.Dir, filepath.FromSlash(input)))
+	}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		content, err := os.ReadFile(file)
+		if err != nil {
+			// protoc reports missing files.
+			continue
+		}
+		for _, imp := range Imports(content) {
+			if seen[imp] || strings.HasPrefix(imp, "google/protobuf/") {
+				continue
+			}
+			seen[imp] = true
+			if local := r.findLocal(imp); local != "" {
+				queue = append(queue, local)
+				continue
+			}
+			m, err := r.moduleOf(imp)
+			if err != nil {
+				return nil, err
+			}
+			if m == nil {
+				continue
+			}
+			root, err := r.includeRoot(*m)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(roots, root) {
+				roots = append(roots, root)
+			}
+			queue = append(queue, filepath.Join(root, filepath.FromSlash(imp)))
+		}
+	}
+	return roots, nil
+}
+
+// findLocal returns the path of an import in the include paths, or an empty
+// string if it is not found.
+func (r *Resolver) findLocal(imp string) string {
+	for _, include := range r.Includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(r.Dir, include)
+		}
+		path := filepath.Join(include, filepath.FromSlash(imp))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// moduleOf returns the module of the build list with the longest path
+// prefixing imp, or nil if there is none.
+func (r *Resolver) moduleOf(imp string) (*Module, error) {
+	if r.modules == nil {
+		modules, err := r.ListModules(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		r.modules = modules
+	}
+	var found *Module
+	for i, m := range r.modules {
+		if m.Main || !strings.HasPrefix(imp, m.Path+"/") {
+			continue
+		}
+		if found == nil || len(m.Path) > len(found.Path) {
+			found = &r.modules[i]
+		}
+	}
+	return found, nil
+}
+
+// includeRoot returns a directory where the module's files are found under
+// the module path, through a symbolic link to the module directory. Modules
+// from the module cache are immutable and get one root per version, while
+// replacements by local directories get one root per directory.
+func (r *Resolver) includeRoot(m Module) (string, error) {
+	dir, version := m.Dir, m.Version
+	if m.Replace != nil {
+		dir, version = m.Replace.Dir, m.Replace.Version
+		if version == "" {
+			sum := sha256.Sum256([]byte(dir))
+			version = "local-" + hex.EncodeToString(sum[:8])
+		}
+	}
+	if dir == "" {
+		var err error
+		if dir, err = r.DownloadModule(r.Dir, m); err != nil {
+			return "", err
+		}
+	}
+	escapedPath, err := module.EscapePath(m.Path)
+	if err != nil {
+		return "", fmt.Errorf("invalid module path %s: %w", m.Path, err)
+	}
+	root := filepath.Join(r.CacheDir, escapedPath+"@"+version)
+	link := filepath.Join(root, filepath.FromSlash(m.Path))
+	if target, err := os.Readlink(link); err == nil && target == dir {
+		return root, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(link), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create include root: %w", err)
+	}
+	// Replace the link atomically, as other processes may use it.
+	tempLink := fmt.Sprintf("%s.tmp-%d", link, os.Getpid())
+	os.Remove(tempLink)
+	if err := os.Symlink(dir, tempLink); err != nil {
+		return "", fmt.Errorf("failed to link %s: %w", m.Path, err)
+	}
+	if err := os.Rename(tempLink, link); err != nil {
+		os.Remove(tempLink)
+		if errors.Is(err, fs.ErrExist) {
+			return root, nil
+		}
+		return "", fmt.Errorf("failed to link %s: %w", m.Path, err)
+	}
+	return root, nil
+}
@@ -0,0 +1,123 @@
+package modproto
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	content := []byte(`syntax = "proto3";
+import "a.proto";
+import public "b/b.proto";
+  import weak "c.proto" ;
+// import "commented.proto";
+message M {}
+`)
+	expected := []string{"a.proto", "b/b.proto", "c.proto"}
+	if imports := Imports(content); !reflect.DeepEqual(imports, expected) {
+		t.Errorf("Expected %v, got %v", expected, imports)
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"pet.proto": `import "google/protobuf/empty.proto";
+import "local/owner.proto";
+import "github.com/org/dep/api/v1/thing.proto";
+import "unknown/missing.proto";
+`,
+		"local/owner.proto": `import "github.com/org/dep/api/v1/thing.proto";`,
+	})
+	depDir := t.TempDir()
+	writeFiles(t, depDir, map[string]string{
+		"api/v1/thing.proto": `import "github.com/other/lib/common.proto";`,
+	})
+	libDir := t.TempDir()
+	writeFiles(t, libDir, map[string]string{"common.proto": ""})
+
+	listCount := 0
+	resolver := NewResolver(dir, []string{"."}, t.TempDir())
+	resolver.ListModules = func(string) ([]Module, error) {
+		listCount++
+		return []Module{
+			{Path: "example.com/pets", Main: true, Dir: dir},
+			{Path: "github.com/org", Version: "v1.0.0", Dir: t.TempDir()},
+			{Path: "github.com/org/dep", Version: "v1.2.3", Dir: depDir},
+			{Path: "github.com/other/lib", Version: "v0.1.0"},
+		}, nil
+	}
+	resolver.DownloadModule = func(_ string, m Module) (string, error) {
+		if m.Path != "github.com/other/lib" {
+			t.Errorf("Unexpected download of %s", m.Path)
+		}
+		return libDir, nil
+	}
+
+	roots, err := resolver.Resolve([]string{"pet.proto"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(roots) != 2 {
+		t.Fatalf("Expected 2 include roots, got %v", roots)
+	}
+	for _, file := range []string{"github.com/org/dep/api/v1/thing.proto", "github.com/other/lib/common.proto"} {
+		found := false
+		for _, root := range roots {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); err == nil {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s to be importable from %v", file, roots)
+		}
+	}
+	if listCount != 1 {
+		t.Errorf("Expected the build list to be listed once, got %d", listCount)
+	}
+
+	// Include roots are reused.
+	again, err := resolver.Resolve([]string{"pet.proto"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(again, roots) {
+		t.Errorf("Expected %v, got %v", roots, again)
+	}
+}
+
+func TestResolver_Resolve_AllLocal(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"pet.proto":         `import "proto/owner.proto";`,
+		"proto/owner.proto": "",
+	})
+	resolver := NewResolver(dir, []string{"."}, t.TempDir())
+	resolver.ListModules = func(string) ([]Module, error) {
+		t.Error("Expected the build list not to be listed")
+		return nil, nil
+	}
+	roots, err := resolver.Resolve([]string{"pet.proto"})
+	if err != nil || len(roots) != 0 {
+		t.Errorf("Expected no include roots, got %v (%v)", roots, err)
+	}
+}
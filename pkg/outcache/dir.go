@@ -0,0 +1,56 @@
+package outcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DirBackend stores entries as files of a local directory, such as a
+// directory shared by the builds of a CI runner.
+type DirBackend struct {
+	Dir string
+}
+
+// path returns the file of the entry for key, in a subdirectory named after
+// the first characters of the key so that no directory grows too large.
+func (b *DirBackend) path(key string) string {
+	prefix := key
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return filepath.Join(b.Dir, prefix, key+".tar.gz")
+}
+
+func (b *DirBackend) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return file, err
+}
+
+// Put writes the entry to a temporary file first, so that concurrent runs
+// never read a partial entry.
+func (b *DirBackend) Put(key string, content []byte) error {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,19 @@
+package outcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirBackend(t *testing.T) {
+	dir := t.TempDir()
+	testBackend(t, &DirBackend{Dir: dir})
+	if _, err := os.Stat(filepath.Join(dir, "ab", "abc.tar.gz")); err != nil {
+		t.Errorf("Expected the entry in a subdirectory, got: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "ab"))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %v", entries)
+	}
+}
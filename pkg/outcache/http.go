@@ -0,0 +1,67 @@
+package outcache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HTTPBackend stores entries on an HTTP server, reading them with GET and
+// writing them with PUT at URL/<key>.tar.gz, like the HTTP caches of Bazel
+// and Gradle do.
+type HTTPBackend struct {
+	URL string
+	// Header is added to every request, such as an Authorization header.
+	Header http.Header
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (b *HTTPBackend) url(key string) string {
+	return strings.TrimSuffix(b.URL, "/") + "/" + key + ".tar.gz"
+}
+
+func (b *HTTPBackend) do(method, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range b.Header {
+		req.Header[name] = values
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (b *HTTPBackend) Get(key string) (io.ReadCloser, error) {
+	resp, err := b.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("bad status: %s", resp.Status)
+}
+
+func (b *HTTPBackend) Put(key string, content []byte) error {
+	resp, err := b.do(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package outcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPBackend(t *testing.T) {
+	entries := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			content, ok := entries[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(content)
+		case http.MethodPut:
+			entries[r.URL.Path], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	b := &HTTPBackend{URL: server.URL + "/cache/", Header: http.Header{"Authorization": {"Bearer token"}}}
+	testBackend(t, b)
+	if _, ok := entries["/cache/abc.tar.gz"]; !ok {
+		t.Errorf("Expected an entry at /cache/abc.tar.gz, got %v", entries)
+	}
+
+	b.Header = nil
+	if err := b.Put("abc", []byte("content")); err == nil {
+		t.Errorf("Expected an error for an unauthorized request")
+	}
+}
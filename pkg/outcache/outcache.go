@@ -0,0 +1,206 @@
+// Package outcache stores the outputs of protoc runs in a content-addressed
+// cache, keyed by a hash of everything the outputs depend on, so that runs
+// with the same inputs can reuse them instead of running protoc, also across
+// machines sharing a remote backend.
+package outcache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+)
+
+// CacheDir is the directory of the cache of bincache.ProtocBinCache holding
+// the local output cache.
+const CacheDir = "outputs"
+
+// ErrNotFound is returned by backends when there is no entry for a key.
+var ErrNotFound = errors.New("not found in output cache")
+
+// Backend stores entries by key.
+type Backend interface {
+	// Get returns the content of the entry, or an error wrapping ErrNotFound.
+	Get(key string) (io.ReadCloser, error)
+	// Put stores the content of the entry, replacing any existing one.
+	Put(key string, content []byte) error
+}
+
+// Key lists what the outputs of a protoc run depend on, so that runs with
+// equal keys produce the same outputs.
+type Key struct {
+	// Protoc is the protoc version.
+	Protoc string `json:"protoc"`
+	// Plugins maps the name of every plugin to its version.
+	Plugins map[string]string `json:"plugins"`
+	// Args are the protoc arguments, without the ones that only depend on
+	// the machine, such as absolute include paths.
+	Args []string `json:"args"`
+	// Files maps the name of every input and imported proto file to the
+	// SHA-256 digest of its content.
+	Files map[string]string `json:"files"`
+}
+
+// keyVersion changes whenever the meaning of keys or entries changes.
+const keyVersion = "go-protoc-outputs-v1"
+
+// Hash returns the hex-encoded SHA-256 digest of the key, which entries are
+// stored by.
+func (k Key) Hash() string {
+	content, err := json.Marshal(k)
+	if err != nil {
+		panic(err)
+	}
+	digest := sha256.Sum256(append([]byte(keyVersion+"\n"), content...))
+	return hex.EncodeToString(digest[:])
+}
+
+// Cache stores the generated files of protoc runs in a Backend, as gzipped
+// tar archives.
+type Cache struct {
+	Backend Backend
+	// Limits bound what restoring an entry may write.
+	Limits downloader.Limits
+}
+
+// New creates a cache storing entries in backend.
+func New(backend Backend) *Cache {
+	return &Cache{Backend: backend, Limits: downloader.DefaultLimits}
+}
+
+// Restore writes the files of the entry for key into destDir and reports
+// whether there was one.
+func (c *Cache) Restore(key, destDir string) (bool, error) {
+	content, err := c.Backend.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer content.Close()
+
+	archive, err := os.CreateTemp("", "go-protoc-outputs-*.tar.gz")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	if _, err := io.Copy(archive, content); err != nil {
+		return false, fmt.Errorf("failed to read entry %s: %w", key, err)
+	}
+	archive.Close()
+	if err := downloader.Extract(archive.Name(), key+".tar.gz", "", destDir, c.Limits); err != nil {
+		return false, fmt.Errorf("failed to extract entry %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Store stores the files under srcDir as the entry for key.
+func (c *Cache) Store(key, srcDir string) error {
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, srcDir); err != nil {
+		return fmt.Errorf("failed to archive outputs: %w", err)
+	}
+	if err := c.Backend.Put(key, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to store entry %s: %w", key, err)
+	}
+	return nil
+}
+
+// writeArchive writes the regular files under dir to w as a gzipped tar
+// archive, in lexical order and without timestamps, so that equal files make
+// equal archives.
+func writeArchive(w io.Writer, dir string) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:     filepath.ToSlash(rel),
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// Tiered is a backend reading from Local first and from Remote otherwise,
+// keeping a local copy of the entries found remotely. Entries are stored in
+// both.
+type Tiered struct {
+	Local, Remote Backend
+}
+
+func (t Tiered) Get(key string) (io.ReadCloser, error) {
+	content, err := t.Local.Get(key)
+	if !errors.Is(err, ErrNotFound) {
+		return content, err
+	}
+	content, err = t.Remote.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	// The local copy only saves a later download.
+	t.Local.Put(key, data)
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (t Tiered) Put(key string, content []byte) error {
+	if err := t.Local.Put(key, content); err != nil {
+		return err
+	}
+	return t.Remote.Put(key, content)
+}
+
+// Open returns the backend at location, which is either an http(s) URL for
+// an HTTPBackend, an s3://bucket/prefix URL for an S3Backend configured from
+// the AWS environment variables, or the path of a local directory.
+func Open(location string) (Backend, error) {
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return &HTTPBackend{URL: location}, nil
+	case strings.HasPrefix(location, "s3://"):
+		return S3FromEnv(location)
+	case location == "":
+		return nil, fmt.Errorf("empty output cache location")
+	}
+	return &DirBackend{Dir: location}, nil
+}
@@ -0,0 +1,150 @@
+package outcache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testBackend checks that b reports missing entries and stores and replaces
+// entries.
+func testBackend(t *testing.T, b Backend) {
+	t.Helper()
+	if _, err := b.Get("abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	for _, content := range []string{"first", "second"} {
+		if err := b.Put("abc", []byte(content)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		r, err := b.Get("abc")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+	}
+}
+
+func TestKey_Hash(t *testing.T) {
+	key := func() Key {
+		return Key{
+			Protoc:  "32.1",
+			Plugins: map[string]string{"go": "v1.36.0", "go-grpc": "v1.5.1"},
+			Args:    []string{"--go_out=.", "pet.proto"},
+			Files:   map[string]string{"pet.proto": "a", "money.proto": "b"},
+		}
+	}
+	hash := key().Hash()
+	if len(hash) != 64 {
+		t.Errorf("Expected a hex SHA-256 digest, got %s", hash)
+	}
+	testCases := map[string]func(k *Key){
+		"protoc":  func(k *Key) { k.Protoc = "32.0" },
+		"plugin":  func(k *Key) { k.Plugins["go"] = "v1.36.1" },
+		"args":    func(k *Key) { k.Args = []string{"--go_out=paths=source_relative:.", "pet.proto"} },
+		"file":    func(k *Key) { k.Files["money.proto"] = "c" },
+		"renamed": func(k *Key) { k.Files = map[string]string{"pet.proto": "a", "price.proto": "b"} },
+	}
+	for name, change := range testCases {
+		t.Run(name, func(t *testing.T) {
+			k := key()
+			change(&k)
+			if k.Hash() == hash {
+				t.Errorf("Expected the hash to change")
+			}
+		})
+	}
+	if key().Hash() != hash {
+		t.Errorf("Expected equal keys to have equal hashes")
+	}
+}
+
+func TestCache_StoreRestore(t *testing.T) {
+	cache := New(&DirBackend{Dir: t.TempDir()})
+	src := t.TempDir()
+	files := map[string]string{"pet.pb.go": "package pet\n", "api/v1/api.pb.go": "package v1\n"}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := t.TempDir()
+	if found, err := cache.Restore("abc", dest); found || err != nil {
+		t.Errorf("Expected a miss, got %v, %v", found, err)
+	}
+	if err := cache.Store("abc", src); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if found, err := cache.Restore("abc", dest); !found || err != nil {
+		t.Fatalf("Expected a hit, got %v, %v", found, err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("Expected %s to be %q, got %q (%v)", name, content, got, err)
+		}
+	}
+}
+
+func TestCache_RestoreInvalid(t *testing.T) {
+	backend := &DirBackend{Dir: t.TempDir()}
+	backend.Put("abc", []byte("not an archive"))
+	if _, err := New(backend).Restore("abc", t.TempDir()); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+}
+
+func TestTiered(t *testing.T) {
+	local, remote := &DirBackend{Dir: t.TempDir()}, &DirBackend{Dir: t.TempDir()}
+	testBackend(t, Tiered{Local: local, Remote: remote})
+	if _, err := remote.Get("abc"); err != nil {
+		t.Errorf("Expected the entry to be stored remotely, got: %v", err)
+	}
+
+	// Entries found remotely are copied locally.
+	remote.Put("def", []byte("remote"))
+	r, err := Tiered{Local: local, Remote: remote}.Get("def")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Close()
+	if r, err := local.Get("def"); err != nil {
+		t.Errorf("Expected a local copy, got: %v", err)
+	} else {
+		r.Close()
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	testCases := map[string]struct {
+		location string
+		expected any
+	}{
+		"http":      {location: "https://cache.example.com/protoc", expected: &HTTPBackend{}},
+		"s3":        {location: "s3://bucket/prefix", expected: &S3Backend{}},
+		"directory": {location: "/var/cache/go-protoc", expected: &DirBackend{}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b, err := Open(tc.location)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if reflect.TypeOf(b) != reflect.TypeOf(tc.expected) {
+				t.Errorf("Expected %T, got %T", tc.expected, b)
+			}
+		})
+	}
+}
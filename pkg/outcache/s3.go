@@ -0,0 +1,196 @@
+package outcache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Backend stores entries as objects of an S3-compatible bucket, such as
+// AWS S3, MinIO or Cloudflare R2, at Prefix/<key>.tar.gz. Requests are
+// path-style and signed with AWS Signature Version 4.
+type S3Backend struct {
+	// Endpoint is the URL of the S3 API, such as https://s3.amazonaws.com.
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	Region   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials.
+	SessionToken string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+	// now defaults to time.Now.
+	now func() time.Time
+}
+
+// S3FromEnv returns the backend at an s3://bucket/prefix location, with the
+// endpoint, region and credentials of the standard AWS environment
+// variables.
+func S3FromEnv(location string) (*S3Backend, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 location %q: expected s3://bucket/prefix", location)
+	}
+	b := &S3Backend{
+		Bucket:          u.Host,
+		Prefix:          strings.Trim(u.Path, "/"),
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		Endpoint:        firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if b.Region == "" {
+		b.Region = "us-east-1"
+	}
+	if b.Endpoint == "" {
+		b.Endpoint = "https://s3." + b.Region + ".amazonaws.com"
+	}
+	if b.AccessKeyID == "" || b.SecretAccessKey == "" {
+		return nil, fmt.Errorf("missing S3 credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return b, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (b *S3Backend) url(key string) string {
+	object := key + ".tar.gz"
+	if b.Prefix != "" {
+		object = b.Prefix + "/" + object
+	}
+	return strings.TrimSuffix(b.Endpoint, "/") + "/" + b.Bucket + "/" + object
+}
+
+func (b *S3Backend) do(method, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	b.sign(req, body, now())
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (b *S3Backend) Get(key string) (io.ReadCloser, error) {
+	resp, err := b.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	defer resp.Body.Close()
+	return nil, fmt.Errorf("bad status: %s: %s", resp.Status, s3ErrorCode(resp.Body))
+}
+
+func (b *S3Backend) Put(key string, content []byte) error {
+	resp, err := b.do(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s: %s", resp.Status, s3ErrorCode(resp.Body))
+	}
+	return nil
+}
+
+// s3ErrorCode returns the code of an S3 error response, such as
+// AccessDenied, or an empty string.
+func s3ErrorCode(body io.Reader) string {
+	content, _ := io.ReadAll(io.LimitReader(body, 4096))
+	_, code, ok := strings.Cut(string(content), "<Code>")
+	if !ok {
+		return ""
+	}
+	code, _, _ = strings.Cut(code, "</Code>")
+	return code
+}
+
+// sign adds the headers of AWS Signature Version 4 to req, signing the host
+// and every header already set.
+func (b *S3Backend) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + b.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+b.SecretAccessKey), date)
+	for _, part := range []string{b.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,78 @@
+package protoc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Severity of a diagnostic reported by protoc.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is an error or warning reported by protoc or one of its plugins.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// File is the proto file the diagnostic refers to, if any, and Line and
+	// Column its 1-based position there, or zero when unknown.
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic like protoc does.
+func (d Diagnostic) String() string {
+	message := d.Message
+	if d.Severity == SeverityWarning {
+		message = "warning: " + message
+	}
+	switch {
+	case d.File == "":
+		return message
+	case d.Line == 0:
+		return fmt.Sprintf("%s: %s", d.File, message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, message)
+	}
+}
+
+var (
+	positionDiagnostic = regexp.MustCompile(`^(.+?):(\d+):(\d+): (.*)$`)
+	fileDiagnostic     = regexp.MustCompile(`^(\S+\.proto): (.*)$`)
+)
+
+// ParseDiagnostics parses the standard error output of protoc into
+// diagnostics. Lines in the "file:line:column: message" and "file: message"
+// formats are attributed to their file, and any other non-empty line is kept
+// as a diagnostic without position.
+func ParseDiagnostics(stderr string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for line := range strings.Lines(stderr) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var d Diagnostic
+		if match := positionDiagnostic.FindStringSubmatch(line); match != nil {
+			d.File, d.Message = match[1], match[4]
+			d.Line, _ = strconv.Atoi(match[2])
+			d.Column, _ = strconv.Atoi(match[3])
+		} else if match := fileDiagnostic.FindStringSubmatch(line); match != nil {
+			d.File, d.Message = match[1], match[2]
+		} else {
+			d.Message = line
+		}
+		d.Severity = SeverityError
+		if message, ok := strings.CutPrefix(d.Message, "warning: "); ok {
+			d.Severity, d.Message = SeverityWarning, message
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
@@ -0,0 +1,36 @@
+package protoc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	stderr := "pet.proto:12:5: \"Foo\" is not defined.\n" +
+		"pet.proto:3:1: warning: Import a.proto is unused.\n" +
+		"missing.proto: File not found.\n" +
+		"\n" +
+		"--go_out: protoc-gen-go: Plugin failed with status code 1.\n"
+	expected := []Diagnostic{
+		{Severity: SeverityError, File: "pet.proto", Line: 12, Column: 5, Message: `"Foo" is not defined.`},
+		{Severity: SeverityWarning, File: "pet.proto", Line: 3, Column: 1, Message: "Import a.proto is unused."},
+		{Severity: SeverityError, File: "missing.proto", Message: "File not found."},
+		{Severity: SeverityError, Message: "--go_out: protoc-gen-go: Plugin failed with status code 1."},
+	}
+	diagnostics := ParseDiagnostics(stderr)
+	if !reflect.DeepEqual(diagnostics, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, diagnostics)
+	}
+
+	// Diagnostics print back as protoc reported them.
+	for i, line := range []string{
+		`pet.proto:12:5: "Foo" is not defined.`,
+		"pet.proto:3:1: warning: Import a.proto is unused.",
+		"missing.proto: File not found.",
+		"--go_out: protoc-gen-go: Plugin failed with status code 1.",
+	} {
+		if got := diagnostics[i].String(); got != line {
+			t.Errorf("Expected %q, got %q", line, got)
+		}
+	}
+}
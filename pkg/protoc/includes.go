@@ -0,0 +1,68 @@
+package protoc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IncludePaths returns the include paths given to protoc in args, with -I or
+// --proto_path. Like protoc, values holding a list of paths, such as "a:b",
+// are split.
+func IncludePaths(args []string) []string {
+	var includes []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return includes
+		case arg == "-I" || arg == "--proto_path":
+			if i+1 < len(args) {
+				i++
+				includes = append(includes, filepath.SplitList(args[i])...)
+			}
+		case strings.HasPrefix(arg, "--proto_path="):
+			includes = append(includes, filepath.SplitList(strings.TrimPrefix(arg, "--proto_path="))...)
+		case strings.HasPrefix(arg, "-I"):
+			includes = append(includes, filepath.SplitList(strings.TrimPrefix(arg, "-I"))...)
+		}
+	}
+	return includes
+}
+
+// FileName returns the name protoc gives to the input proto file when run in
+// dir with the include paths: its slash-separated path relative to the first
+// include path containing it, the directory itself when there is none. Inputs
+// that are not files, or not in any include path, are returned as given, as
+// protoc looks them up by name in the include paths.
+func FileName(dir string, includes []string, input string) string {
+	name := filepath.ToSlash(input)
+	if len(includes) == 0 {
+		includes = []string{"."}
+	}
+	path := input
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return name
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return name
+	}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		include, err := filepath.Abs(include)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(include, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+package protoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIncludePaths(t *testing.T) {
+	list := "c" + string(filepath.ListSeparator) + "d"
+	args := []string{"-Iproto", "-I", "third_party", "--proto_path=a", "--proto_path", "b", "-I" + list, "x.proto", "--", "-Inot"}
+	expected := []string{"proto", "third_party", "a", "b", "c", "d"}
+	if includes := IncludePaths(args); !reflect.DeepEqual(includes, expected) {
+		t.Errorf("Expected %v, got %v", expected, includes)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"api/v1/pet.proto", "pet.proto"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := map[string]struct {
+		includes []string
+		input    string
+		expected string
+	}{
+		"default include":      {input: "api/v1/pet.proto", expected: "api/v1/pet.proto"},
+		"include":              {includes: []string{"api"}, input: "api/v1/pet.proto", expected: "v1/pet.proto"},
+		"first include":        {includes: []string{"api/v1", "api"}, input: "api/v1/pet.proto", expected: "pet.proto"},
+		"skips other includes": {includes: []string{"other", "api"}, input: "api/v1/pet.proto", expected: "v1/pet.proto"},
+		"dot include":          {includes: []string{"./api/"}, input: "./api/v1/pet.proto", expected: "v1/pet.proto"},
+		"absolute input":       {includes: []string{"api"}, input: filepath.Join(dir, "api", "v1", "pet.proto"), expected: "v1/pet.proto"},
+		"outside includes":     {includes: []string{"api"}, input: "pet.proto", expected: "pet.proto"},
+		"name in include":      {includes: []string{"api"}, input: "v1/pet.proto", expected: "v1/pet.proto"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := FileName(dir, tc.includes, tc.input); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package protoc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrAbsoluteOutput is returned by Run when an output path is absolute and
+// Options set an OutputDir.
+var ErrAbsoluteOutput = errors.New("absolute output path is not supported")
+
+// fileOutputs are the output flags, without the "--" prefix, whose value is a
+// file rather than a directory.
+var fileOutputs = []string{"descriptor_set_out", "dependency_out"}
+
+// redirectOutputs rewrites every output flag (flags ending in "_out", and -o)
+// so that it points inside dir, creating the directories protoc expects to
+// exist. Absolute output paths are left as they are when keepAbsolute is set,
+// and rejected otherwise.
+func redirectOutputs(args []string, dir string, keepAbsolute bool) ([]string, error) {
+	redirected := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			redirected = append(redirected, args[i:]...)
+			break
+		}
+		flag, value, hasValue := strings.Cut(arg, "=")
+		name := strings.TrimLeft(flag, "-")
+		switch {
+		case strings.HasPrefix(arg, "-o"):
+			// -oFILE and -o FILE are shorthands of --descriptor_set_out=FILE.
+			name, flag = "descriptor_set_out", "--descriptor_set_out"
+			value, hasValue = strings.TrimPrefix(arg, "-o"), arg != "-o"
+		case !strings.HasPrefix(arg, "--") || !strings.HasSuffix(name, "_out"):
+			redirected = append(redirected, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value for %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+		isFile := slices.Contains(fileOutputs, name)
+		// Plugin output flags may carry parameters as "params:dir".
+		params, out, hasParams := strings.Cut(value, ":")
+		if !hasParams || isFile {
+			params, out = "", value
+		}
+		if filepath.IsAbs(out) {
+			if !keepAbsolute {
+				return nil, fmt.Errorf("%w: %s", ErrAbsoluteOutput, out)
+			}
+			redirected = append(redirected, flag+"="+value)
+			continue
+		}
+		out = filepath.Join(dir, out)
+		mkdir := out
+		if isFile || isArchiveOutput(out) {
+			mkdir = filepath.Dir(out)
+		}
+		if err := os.MkdirAll(mkdir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if hasParams && params != "" {
+			out = params + ":" + out
+		}
+		redirected = append(redirected, flag+"="+out)
+	}
+	return redirected, nil
+}
+
+// isArchiveOutput reports whether protoc would write the output as a single
+// archive file instead of a directory.
+func isArchiveOutput(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".zip" || ext == ".jar"
+}
+
+// InstallFiles copies every file under src to the same path under dst,
+// leaving the files whose content did not change untouched. It returns the
+// sorted slash-separated paths of the files, relative to src.
+func InstallFiles(src, dst string) ([]string, error) {
+	files, err := listFiles(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generated files: %w", err)
+	}
+	for _, name := range files {
+		path := filepath.FromSlash(name)
+		if err := installFile(filepath.Join(src, path), filepath.Join(dst, path)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return files, nil
+}
+
+// listFiles returns the sorted slash-separated paths of every regular file
+// under dir, relative to dir.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	slices.Sort(files)
+	return files, err
+}
+
+// installFile copies src to dst unless dst already has the same content.
+func installFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(dst); err == nil && bytes.Equal(current, content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, 0644)
+}
@@ -0,0 +1,94 @@
+package protoc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRedirectOutputs(t *testing.T) {
+	dir := t.TempDir()
+	args, err := redirectOutputs([]string{
+		"--go_out=gen",
+		"--go-grpc_out", "plugins=grpc:.",
+		"--descriptor_set_out=out/set.binpb",
+		"--dependency_out=deps/pet.d",
+		"-o", "short/set.binpb",
+		"-oshort/other.binpb",
+		"--go_opt=paths=source_relative",
+		"x.proto",
+	}, dir, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []string{
+		"--go_out=" + filepath.Join(dir, "gen"),
+		"--go-grpc_out=plugins=grpc:" + dir,
+		"--descriptor_set_out=" + filepath.Join(dir, "out", "set.binpb"),
+		"--dependency_out=" + filepath.Join(dir, "deps", "pet.d"),
+		"--descriptor_set_out=" + filepath.Join(dir, "short", "set.binpb"),
+		"--descriptor_set_out=" + filepath.Join(dir, "short", "other.binpb"),
+		"--go_opt=paths=source_relative",
+		"x.proto",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+	for _, d := range []string{"gen", "out", "deps", "short"} {
+		if info, err := os.Stat(filepath.Join(dir, d)); err != nil || !info.IsDir() {
+			t.Errorf("Expected directory %q to be created: %v", d, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "deps", "pet.d")); err == nil {
+		t.Error("Expected no directory to be created for a file output")
+	}
+}
+
+func TestRedirectOutputs_Absolute(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(t.TempDir(), "gen")
+	if _, err := redirectOutputs([]string{"--go_out=" + abs}, dir, false); err == nil {
+		t.Error("Expected error for absolute output path")
+	}
+	args, err := redirectOutputs([]string{"--go_out", abs, "-o" + abs + ".binpb"}, dir, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []string{"--go_out=" + abs, "--descriptor_set_out=" + abs + ".binpb"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestInstallFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{"a.pb.go": "a", "sub/b.pb.go": "b"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged := filepath.Join(dst, "a.pb.go")
+	if err := os.WriteFile(unchanged, []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := InstallFiles(src, dst)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected := []string{"a.pb.go", "sub/b.pb.go"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+	if content, err := os.ReadFile(filepath.Join(dst, "sub", "b.pb.go")); err != nil || string(content) != "b" {
+		t.Errorf("Expected file to be installed, got %q: %v", content, err)
+	}
+	// Files with the same content are left untouched.
+	if info, err := os.Stat(unchanged); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected unchanged file to be left untouched: %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package protoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"github.com/esdandreu/go-protoc/pkg/editions"
+)
+
+// DefaultTag is the protoc release tag used when none is given.
+const DefaultTag = "latest"
+
+// ProtoFilesPatterns are the patterns matching the proto files compiled when
+// no input is given.
+var ProtoFilesPatterns = []string{"*.proto", "**/*.proto"}
+
+// DefaultPlugins generate Go code and gRPC stubs next to the proto files, as
+// recommended by the gRPC quick start guide.
+var DefaultPlugins = []Plugin{
+	{Name: "go", Out: ".", Options: []string{"paths=source_relative"}},
+	{Name: "go-grpc", Out: ".", Options: []string{"paths=source_relative"}},
+}
+
+// BinCache provides the path to a protoc binary for a release tag.
+type BinCache interface {
+	BinPath(tag string) (string, error)
+}
+
+// Compiler is implemented by caches that compile in-process instead of
+// running their protoc binary, such as compiler.Compiler. Compile runs in dir
+// with the protoc arguments args, and writes the output and the errors of
+// protoc to stdout and stderr.
+type Compiler interface {
+	Compile(ctx context.Context, dir string, args []string, stdout, stderr io.Writer) error
+}
+
+// BinRunner is implemented by caches whose binaries are not native programs,
+// such as wasm.Runtime. RunBin runs the binary at binPath, returned by
+// BinPath, in dir with the protoc arguments args, like executing it would.
+type BinRunner interface {
+	RunBin(ctx context.Context, binPath, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// VersionResolver is implemented by caches that can tell which version a tag
+// refers to, such as bincache.ProtocBinCache.
+type VersionResolver interface {
+	ResolveVersion(tag string) (string, error)
+}
+
+// Plugin runs a protoc-gen-NAME plugin, like the --NAME_out and --NAME_opt
+// flags of protoc.
+type Plugin struct {
+	Name string
+	// Out is the output directory, relative to the run directory.
+	Out     string
+	Options []string
+	// Path to the plugin binary. When empty, protoc looks for
+	// protoc-gen-NAME in the PATH.
+	Path string
+}
+
+// flags returns the protoc flags running the plugin, leaving out the output
+// flag when Out is empty.
+func (plugin Plugin) flags() []string {
+	var flags []string
+	if plugin.Path != "" {
+		flags = append(flags, fmt.Sprintf("--plugin=protoc-gen-%s=%s", plugin.Name, plugin.Path))
+	}
+	if plugin.Out != "" {
+		flags = append(flags, fmt.Sprintf("--%s_out=%s", plugin.Name, plugin.Out))
+	}
+	for _, option := range plugin.Options {
+		flags = append(flags, fmt.Sprintf("--%s_opt=%s", plugin.Name, option))
+	}
+	return flags
+}
+
+// Options configure a protoc run.
+type Options struct {
+	// Cache provides the protoc binary. Defaults to a ProtocBinCache in the
+	// user cache directory.
+	Cache BinCache
+	// Version is the protoc release tag. Defaults to DefaultTag. A version
+	// range, such as ">=v25.0", selects the lowest published version of the
+	// range supporting the editions of the inputs, see PublishedVersions.
+	Version string
+	// Inputs are the proto files to compile, relative to Dir. Defaults to
+	// the files in Dir matching ProtoFilesPatterns, unless Args name some.
+	Inputs []string
+	// Includes are the import paths, given to protoc as -I flags.
+	Includes []string
+	// Plugins to run. Defaults to DefaultPlugins, leaving out the output and
+	// option flags given in Args.
+	Plugins []Plugin
+	// Args are extra arguments for protoc, which may include output flags
+	// and inputs.
+	Args []string
+	// GoPackages map proto files without a go_package option, named relative
+	// to their include path, to the Go import path of their generated code.
+	// They are given to the go and go-grpc plugins as M options.
+	GoPackages map[string]string
+	// Dir is the directory protoc runs in. Defaults to the current directory.
+	Dir string
+	// OutputDir is the directory the outputs are written to instead of Dir,
+	// such as a temporary directory to compare them with the files in Dir.
+	// Absolute output paths are only supported when it is empty, in which
+	// case they are written by protoc directly and not reported.
+	OutputDir string
+	// Stdin is the input of protoc, as used by --decode and --encode.
+	Stdin io.Reader
+	// Stdout and Stderr receive the output of protoc. It is discarded when
+	// nil, errors and warnings are available as diagnostics in any case.
+	Stdout, Stderr io.Writer
+}
+
+// Result describes a protoc run.
+type Result struct {
+	// ProtocPath is the path of the protoc binary used, and ProtocVersion its
+	// version when the cache could resolve it.
+	ProtocPath    string
+	ProtocVersion string
+	// Files are the files written, as slash-separated paths relative to the
+	// output directory.
+	Files []string
+	// Diagnostics are the errors and warnings reported by protoc.
+	Diagnostics []Diagnostic
+	// Duration is how long protoc ran, leaving out downloads.
+	Duration time.Duration
+}
+
+// PublishedVersions returns the versions of the published protoc releases
+// when the cache can list them, such as bincache.ProtocBinCache, or nil, in
+// which case the lowest version of a range is assumed to be published.
+func PublishedVersions(cache BinCache) []string {
+	if lister, ok := cache.(bincache.VersionLister); ok {
+		if versions, err := lister.ListVersions(); err == nil {
+			return versions
+		}
+	}
+	return nil
+}
+
+// Command returns the arguments Run gives protoc, before the outputs are
+// redirected into a temporary directory: the include paths, the plugin
+// flags, Args and the inputs.
+func (opts Options) Command() ([]string, error) {
+	args, _, err := opts.command()
+	return args, err
+}
+
+// command returns the arguments of protoc and the input proto files.
+func (opts Options) command() ([]string, []string, error) {
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	inputs := opts.Inputs
+	argInputs := slices.ContainsFunc(opts.Args, IsInput) || slices.Contains(opts.Args, "--")
+	if len(inputs) == 0 && !argInputs {
+		var err error
+		inputs, err = FindProtoFiles(os.DirFS(dir))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var args []string
+	for _, include := range opts.Includes {
+		args = append(args, "-I"+include)
+	}
+	if opts.Plugins == nil {
+		for _, plugin := range DefaultPlugins {
+			if hasFlag(opts.Args, plugin.Name+"_out") {
+				plugin.Out = ""
+			}
+			if hasFlag(opts.Args, plugin.Name+"_opt") {
+				plugin.Options = nil
+			}
+			args = append(args, plugin.flags()...)
+		}
+	}
+	for _, plugin := range opts.Plugins {
+		args = append(args, plugin.flags()...)
+	}
+	args = append(args, goPackageFlags(slices.Concat(args, opts.Args), opts.GoPackages)...)
+	args = append(args, opts.Args...)
+	args = append(args, inputs...)
+	for _, arg := range opts.Args {
+		if IsInput(arg) {
+			inputs = append(inputs, arg)
+		}
+	}
+	return args, inputs, nil
+}
+
+// goPackageFlags returns the M options mapping the files of goPackages to
+// their import path, for the go and go-grpc plugins args run.
+func goPackageFlags(args []string, goPackages map[string]string) []string {
+	var flags []string
+	for _, plugin := range []string{"go", "go-grpc"} {
+		if !hasFlag(args, plugin+"_out") {
+			continue
+		}
+		for _, file := range slices.Sorted(maps.Keys(goPackages)) {
+			flags = append(flags, fmt.Sprintf("--%s_opt=M%s=%s", plugin, file, goPackages[file]))
+		}
+	}
+	return flags
+}
+
+// IsInput reports whether the protoc argument is an input proto file.
+func IsInput(arg string) bool {
+	return !strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, ".proto")
+}
+
+// hasFlag reports whether args set the protoc flag name, as --name=value or
+// --name value.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// Run compiles the proto files with protoc and the plugins given in opts, or
+// in-process when the cache is a Compiler or a BinRunner. The
+// outputs are generated into a temporary directory first and then copied
+// into the output directory, which allows reporting the files written and
+// leaves files whose content did not change untouched. The result is
+// returned along with any error, so that diagnostics are available when
+// compilation fails.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	result := &Result{}
+	cache := opts.Cache
+	if cache == nil {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return result, fmt.Errorf("failed to get user cache dir: %w", err)
+		}
+		cache = bincache.NewProtocBinCache(cacheDir)
+	}
+	tag := opts.Version
+	if tag == "" {
+		tag = DefaultTag
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	outputDir := opts.OutputDir
+	if outputDir == "" {
+		outputDir = dir
+	}
+	args, inputs, err := opts.command()
+	if err != nil {
+		return result, err
+	}
+	if editions.IsRange(tag) {
+		r, err := editions.ParseRange(tag)
+		if err != nil {
+			return result, err
+		}
+		if tag, err = r.Select(editions.Require(dir, inputs), PublishedVersions(cache)); err != nil {
+			return result, err
+		}
+	}
+	if resolver, ok := cache.(VersionResolver); ok {
+		version, err := resolver.ResolveVersion(tag)
+		if err != nil {
+			return result, fmt.Errorf("failed to resolve protoc version %s: %w", tag, err)
+		}
+		tag, result.ProtocVersion = version, version
+	}
+	binPath, err := cache.BinPath(tag)
+	if err != nil {
+		return result, fmt.Errorf("failed to get protoc binary %s: %w", tag, err)
+	}
+	result.ProtocPath = binPath
+
+	tempDir, err := os.MkdirTemp("", "go-protoc-*")
+	if err != nil {
+		return result, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if args, err = redirectOutputs(args, tempDir, opts.OutputDir == ""); err != nil {
+		return result, err
+	}
+
+	var stderr bytes.Buffer
+	var stderrWriter io.Writer = &stderr
+	if opts.Stderr != nil {
+		stderrWriter = io.MultiWriter(&stderr, opts.Stderr)
+	}
+	start := time.Now()
+	var runErr error
+	if compiler, ok := cache.(Compiler); ok {
+		runErr = compiler.Compile(ctx, dir, args, opts.Stdout, stderrWriter)
+	} else if runner, ok := cache.(BinRunner); ok {
+		runErr = runner.RunBin(ctx, binPath, dir, args, opts.Stdin, opts.Stdout, stderrWriter)
+	} else {
+		cmd := exec.CommandContext(ctx, binPath, args...)
+		cmd.Dir = dir
+		cmd.Stdin = opts.Stdin
+		cmd.Stdout = opts.Stdout
+		cmd.Stderr = stderrWriter
+		runErr = cmd.Run()
+	}
+	result.Duration = time.Since(start)
+	result.Diagnostics = ParseDiagnostics(stderr.String())
+	if runErr != nil {
+		return result, fmt.Errorf("protoc failed: %w", runErr)
+	}
+
+	if result.Files, err = InstallFiles(tempDir, outputDir); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// FindProtoFiles returns the files in fsys matching ProtoFilesPatterns.
+func FindProtoFiles(fsys fs.FS) ([]string, error) {
+	var files []string
+	for _, pattern := range ProtoFilesPatterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to glob proto files: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -0,0 +1,338 @@
+package protoc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/esdandreu/go-protoc/internal/mockprotoc"
+)
+
+type mockBinCache struct {
+	binPath  string
+	versions []string
+	lastTag  string
+}
+
+func (m *mockBinCache) BinPath(tag string) (string, error) {
+	m.lastTag = tag
+	return m.binPath, nil
+}
+
+func (m *mockBinCache) ResolveVersion(tag string) (string, error) {
+	if tag == "latest" {
+		return "32.1", nil
+	}
+	return strings.TrimPrefix(tag, "v"), nil
+}
+
+func (m *mockBinCache) ListVersions() ([]string, error) {
+	if m.versions == nil {
+		return nil, errors.New("offline")
+	}
+	return m.versions, nil
+}
+
+// createMockProtoc creates a mock protoc that writes a file named after each
+// input into the --go_out directory, reports a warning and exits with
+// exitCode.
+func createMockProtoc(t *testing.T, exitCode int) string {
+	t.Helper()
+	return mockprotoc.New(t,
+		mockprotoc.OnArg("--go_out=*", `out="${arg#--go_out=}"`),
+		mockprotoc.OnArg("*.proto", `printf 'package x\n' > "$out/$(basename "$arg" .proto).pb.go"`),
+		mockprotoc.Then("echo 'pet.proto:3:1: warning: Import a.proto is unused.' >&2"),
+		mockprotoc.Then("exit "+strconv.Itoa(exitCode)),
+	)
+}
+
+func TestRun(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockProtoc(t, 0)}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pet.proto"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(context.Background(), Options{
+		Cache:   cache,
+		Dir:     dir,
+		Plugins: []Plugin{{Name: "go", Out: "gen"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if cache.lastTag != "32.1" {
+		t.Errorf("Expected binary to be requested for the resolved version, got %q", cache.lastTag)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Expected protoc duration to be measured, got %v", result.Duration)
+	}
+	result.Duration = 0
+	expected := &Result{
+		ProtocPath:    cache.binPath,
+		ProtocVersion: "32.1",
+		Files:         []string{"gen/pet.pb.go"},
+		Diagnostics: []Diagnostic{{
+			Severity: SeverityWarning,
+			File:     "pet.proto",
+			Line:     3,
+			Column:   1,
+			Message:  "Import a.proto is unused.",
+		}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen", "pet.pb.go")); err != nil {
+		t.Errorf("Expected generated file to be written: %v", err)
+	}
+}
+
+func TestRun_Failure(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockProtoc(t, 1)}
+	result, err := Run(context.Background(), Options{
+		Cache:  cache,
+		Dir:    t.TempDir(),
+		Inputs: []string{"pet.proto"},
+	})
+	var exitError interface{ ExitCode() int }
+	if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+		t.Fatalf("Expected protoc exit error, got: %v", err)
+	}
+	if len(result.Diagnostics) != 1 {
+		t.Errorf("Expected diagnostics to be returned on failure, got %v", result.Diagnostics)
+	}
+	if len(result.Files) != 0 {
+		t.Errorf("Expected no files to be written on failure, got %v", result.Files)
+	}
+}
+
+// mockCompiler compiles in-process, writing a file named after each input
+// into the --go_out directory.
+type mockCompiler struct {
+	mockBinCache
+	dir  string
+	args []string
+}
+
+func (m *mockCompiler) Compile(ctx context.Context, dir string, args []string, stdout, stderr io.Writer) error {
+	m.dir, m.args = dir, args
+	var out string
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--go_out="); ok {
+			out = value
+		} else if IsInput(arg) {
+			name := strings.TrimSuffix(filepath.Base(arg), ".proto") + ".pb.go"
+			if err := os.WriteFile(filepath.Join(out, name), []byte("package x\n"), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	io.WriteString(stderr, "pet.proto:3:1: warning: Import a.proto is unused.\n")
+	return nil
+}
+
+func TestRun_Compiler(t *testing.T) {
+	// The binary of the cache is not run.
+	cache := &mockCompiler{mockBinCache: mockBinCache{binPath: filepath.Join(t.TempDir(), "missing")}}
+	dir := t.TempDir()
+	result, err := Run(context.Background(), Options{
+		Cache:   cache,
+		Dir:     dir,
+		Inputs:  []string{"pet.proto"},
+		Plugins: []Plugin{{Name: "go", Out: "gen"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.dir != dir {
+		t.Errorf("Expected compilation in %s, got %s", dir, cache.dir)
+	}
+	if !reflect.DeepEqual(result.Files, []string{"gen/pet.pb.go"}) {
+		t.Errorf("Expected gen/pet.pb.go to be written, got %v", result.Files)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("Expected the warning of the compiler, got %v", result.Diagnostics)
+	}
+}
+
+// mockBinRunner runs its binary in-process, like mockCompiler compiles.
+type mockBinRunner struct {
+	compiler mockCompiler
+	binPath  string
+}
+
+func (m *mockBinRunner) BinPath(tag string) (string, error) {
+	return m.compiler.BinPath(tag)
+}
+
+func (m *mockBinRunner) RunBin(ctx context.Context, binPath, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	m.binPath = binPath
+	return m.compiler.Compile(ctx, dir, args, stdout, stderr)
+}
+
+func TestRun_BinRunner(t *testing.T) {
+	// The binary of the cache is not executed.
+	binPath := filepath.Join(t.TempDir(), "protoc")
+	cache := &mockBinRunner{compiler: mockCompiler{mockBinCache: mockBinCache{binPath: binPath}}}
+	result, err := Run(context.Background(), Options{
+		Cache:   cache,
+		Dir:     t.TempDir(),
+		Inputs:  []string{"pet.proto"},
+		Plugins: []Plugin{{Name: "go", Out: "."}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cache.binPath != binPath || result.ProtocPath != binPath {
+		t.Errorf("Expected %s to be run, got %s", binPath, cache.binPath)
+	}
+	if !reflect.DeepEqual(result.Files, []string{"pet.pb.go"}) {
+		t.Errorf("Expected pet.pb.go to be written, got %v", result.Files)
+	}
+}
+
+func TestRun_NoInputs(t *testing.T) {
+	// protoc reports the missing inputs itself.
+	cache := &mockBinCache{binPath: createMockProtoc(t, 0)}
+	result, err := Run(context.Background(), Options{Cache: cache, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(result.Files) != 0 {
+		t.Errorf("Expected no files, got %v", result.Files)
+	}
+}
+
+func TestRun_VersionRange(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pet.proto"), []byte("edition = \"2023\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		versions []string
+		expected string
+	}{
+		"published":  {versions: []string{"28.0", "27.1", "26.1"}, expected: "27.1"},
+		"not listed": {expected: "27.0"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cache := &mockBinCache{binPath: createMockProtoc(t, 0), versions: tc.versions}
+			result, err := Run(context.Background(), Options{Cache: cache, Version: ">=v26.0", Dir: dir, Plugins: []Plugin{}})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if result.ProtocVersion != tc.expected || cache.lastTag != tc.expected {
+				t.Errorf("Expected version %s, got %s (%s)", tc.expected, result.ProtocVersion, cache.lastTag)
+			}
+		})
+	}
+}
+
+func TestRun_OutputDir(t *testing.T) {
+	cache := &mockBinCache{binPath: createMockProtoc(t, 0)}
+	dir, outputDir := t.TempDir(), t.TempDir()
+	result, err := Run(context.Background(), Options{
+		Cache:     cache,
+		Dir:       dir,
+		OutputDir: outputDir,
+		Args:      []string{"--go_out=gen", "pet.proto"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(result.Files, []string{"gen/pet.pb.go"}) {
+		t.Errorf("Expected generated file to be reported, got %v", result.Files)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "gen", "pet.pb.go")); err != nil {
+		t.Errorf("Expected generated file in the output directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen")); err == nil {
+		t.Error("Expected nothing to be written to the run directory")
+	}
+
+	_, err = Run(context.Background(), Options{
+		Cache:     cache,
+		Dir:       dir,
+		OutputDir: outputDir,
+		Args:      []string{"--go_out=" + filepath.Join(dir, "gen"), "pet.proto"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "absolute output path") {
+		t.Errorf("Expected absolute output paths to be rejected, got: %v", err)
+	}
+}
+
+func TestOptions_Command(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pet.proto"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		opts     Options
+		expected []string
+	}{
+		"defaults": {
+			opts: Options{Dir: dir},
+			expected: []string{
+				"--go_out=.", "--go_opt=paths=source_relative",
+				"--go-grpc_out=.", "--go-grpc_opt=paths=source_relative",
+				"pet.proto",
+			},
+		},
+		"default plugin flags in args": {
+			opts: Options{Dir: dir, Args: []string{"--go_out=gen", "--go-grpc_opt", "require_unimplemented_servers=false"}},
+			expected: []string{
+				"--go_opt=paths=source_relative", "--go-grpc_out=.",
+				"--go_out=gen", "--go-grpc_opt", "require_unimplemented_servers=false",
+				"pet.proto",
+			},
+		},
+		"inputs in args": {
+			opts:     Options{Dir: dir, Plugins: []Plugin{}, Args: []string{"-I", "api", "api/other.proto"}},
+			expected: []string{"-I", "api", "api/other.proto"},
+		},
+		"explicit": {
+			opts: Options{
+				Dir:      dir,
+				Includes: []string{"api"},
+				Plugins:  []Plugin{{Name: "x", Out: "gen", Options: []string{"a=b"}, Path: "/bin/x"}},
+				Inputs:   []string{"api/other.proto"},
+			},
+			expected: []string{"-Iapi", "--plugin=protoc-gen-x=/bin/x", "--x_out=gen", "--x_opt=a=b", "api/other.proto"},
+		},
+		"go packages": {
+			opts: Options{
+				Dir:        dir,
+				Plugins:    []Plugin{{Name: "go", Out: "."}},
+				GoPackages: map[string]string{"pet.proto": "example.com/pets", "a/b.proto": "example.com/pets/a"},
+			},
+			expected: []string{
+				"--go_out=.", "--go_opt=Ma/b.proto=example.com/pets/a", "--go_opt=Mpet.proto=example.com/pets",
+				"pet.proto",
+			},
+		},
+		"no inputs found": {
+			opts:     Options{Dir: t.TempDir(), Plugins: []Plugin{}, Args: []string{"--version"}},
+			expected: []string{"--version"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			args, err := tc.opts.Command()
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package protoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format of the diagnostics written by WriteDiagnostics.
+type Format string
+
+const (
+	// FormatText prints diagnostics as protoc does.
+	FormatText Format = "text"
+	// FormatJSON prints a JSON array of diagnostics.
+	FormatJSON Format = "json"
+	// FormatSARIF prints a SARIF 2.1.0 log, as consumed by code scanning
+	// tools.
+	FormatSARIF Format = "sarif"
+	// FormatGitHub prints GitHub Actions workflow commands, which show up as
+	// annotations on pull requests.
+	FormatGitHub Format = "github"
+)
+
+// Formats are the supported diagnostic formats.
+var Formats = []Format{FormatText, FormatJSON, FormatSARIF, FormatGitHub}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown diagnostics format %q, expected one of %v", name, Formats)
+}
+
+// WriteDiagnostics writes the diagnostics to w in the given format.
+func WriteDiagnostics(w io.Writer, format Format, diagnostics []Diagnostic) error {
+	switch format {
+	case FormatText:
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(w, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatJSON:
+		if diagnostics == nil {
+			diagnostics = []Diagnostic{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diagnostics)
+	case FormatSARIF:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(newSARIFLog(diagnostics))
+	case FormatGitHub:
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(w, githubCommand(d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown diagnostics format %q", format)
+}
+
+// githubCommand formats a diagnostic as a GitHub Actions workflow command,
+// such as "::error file=pet.proto,line=3,col=1::message".
+func githubCommand(d Diagnostic) string {
+	var properties []string
+	if d.File != "" {
+		properties = append(properties, "file="+escapeGitHubProperty(d.File))
+	}
+	if d.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%d", d.Line))
+	}
+	if d.Column > 0 {
+		properties = append(properties, fmt.Sprintf("col=%d", d.Column))
+	}
+	command := "::" + string(d.Severity)
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+	return command + "::" + escapeGitHubData(d.Message)
+}
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func escapeGitHubData(s string) string     { return githubDataEscaper.Replace(s) }
+func escapeGitHubProperty(s string) string { return githubPropertyEscaper.Replace(s) }
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+	} `json:"driver"`
+}
+
+type sarifResult struct {
+	Level   string `json:"level"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func newSARIFLog(diagnostics []Diagnostic) sarifLog {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "protoc"
+	run.Tool.Driver.InformationURI = "https://github.com/protocolbuffers/protobuf"
+	for _, d := range diagnostics {
+		result := sarifResult{Level: string(d.Severity)}
+		result.Message.Text = d.Message
+		if d.File != "" {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = d.File
+			if d.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+	return sarifLog{Version: "2.1.0", Schema: sarifSchema, Runs: []sarifRun{run}}
+}
@@ -0,0 +1,107 @@
+package protoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+var testDiagnostics = []Diagnostic{
+	{Severity: SeverityError, File: "api/pet.proto", Line: 12, Column: 5, Message: `"Foo" is not defined.`},
+	{Severity: SeverityWarning, File: "api/pet.proto", Message: "Import a.proto is unused.\nRemove it."},
+	{Severity: SeverityError, Message: "--go_out: protoc-gen-go: Plugin failed with status code 1."},
+}
+
+func TestWriteDiagnostics_Text(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDiagnostics(&out, FormatText, testDiagnostics[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "api/pet.proto:12:5: \"Foo\" is not defined.\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestWriteDiagnostics_JSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDiagnostics(&out, FormatJSON, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("Expected empty array, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := WriteDiagnostics(&out, FormatJSON, testDiagnostics); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v\n%s", err, out.String())
+	}
+	if len(decoded) != len(testDiagnostics) || decoded[0] != testDiagnostics[0] {
+		t.Errorf("Expected %+v, got %+v", testDiagnostics, decoded)
+	}
+}
+
+func TestWriteDiagnostics_SARIF(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDiagnostics(&out, FormatSARIF, testDiagnostics); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				Level     string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           *struct{ StartLine, StartColumn int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 3 {
+		t.Fatalf("Unexpected SARIF log:\n%s", out.String())
+	}
+	results := log.Runs[0].Results
+	location := results[0].Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "api/pet.proto" || location.Region.StartLine != 12 || location.Region.StartColumn != 5 {
+		t.Errorf("Unexpected location %+v", location)
+	}
+	if results[1].Level != "warning" || results[1].Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("Unexpected warning result %+v", results[1])
+	}
+	if len(results[2].Locations) != 0 {
+		t.Errorf("Expected no location for diagnostic without file, got %+v", results[2])
+	}
+}
+
+func TestWriteDiagnostics_GitHub(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteDiagnostics(&out, FormatGitHub, testDiagnostics); err != nil {
+		t.Fatal(err)
+	}
+	expected := "::error file=api/pet.proto,line=12,col=5::\"Foo\" is not defined.\n" +
+		"::warning file=api/pet.proto::Import a.proto is unused.%0ARemove it.\n" +
+		"::error::--go_out: protoc-gen-go: Plugin failed with status code 1.\n"
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		if parsed, err := ParseFormat(string(format)); err != nil || parsed != format {
+			t.Errorf("Expected %q, got %q (%v)", format, parsed, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,362 @@
+package protofmt
+
+import (
+	"slices"
+	"strings"
+)
+
+// Indent is the indentation of each nesting level.
+const Indent = "  "
+
+// item is either a standalone comment or a statement, which may open a block
+// of nested items.
+type item struct {
+	// comment is set for standalone comments.
+	comment *token
+	// tokens of a statement, including its final ';' or up to its opening
+	// brace for blocks.
+	tokens   []token
+	block    bool
+	children []*item
+	// Comments on the same line after the statement, its opening brace and
+	// its closing brace.
+	trailing, openTrailing, closeTrailing string
+	// blankBefore tells whether the item is preceded by a blank line.
+	blankBefore bool
+}
+
+// Format returns the canonical formatting of the proto source src. Comments
+// are preserved. The formatting:
+//   - indents each nesting level with two spaces;
+//   - puts each statement on its own line, with canonical spacing between
+//     tokens;
+//   - keeps at most one blank line between statements and none at the start
+//     or end of a block;
+//   - orders the file header as syntax or edition, package, imports and
+//     options, sorting imports and options.
+func Format(src []byte) ([]byte, error) {
+	tokens, err := tokenize(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	items, err := p.items(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, &SyntaxError{p.tokens[p.pos].line, "unexpected '}'"}
+	}
+
+	var pr printer
+	pr.items(sortHeader(items), 0)
+	return []byte(pr.String()), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) items(depth int) ([]*item, error) {
+	var items []*item
+	// ended is the last statement when nothing but whitespace without line
+	// breaks followed it, and endSlot where a comment there belongs.
+	var ended *item
+	var endSlot *string
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if t.is("}") && depth > 0 {
+			return items, nil
+		}
+		if t.isComment() {
+			p.pos++
+			if ended != nil && t.newlines == 0 && *endSlot == "" && t.kind == tokenLineComment {
+				*endSlot = t.text
+				continue
+			}
+			items = append(items, &item{comment: &t, blankBefore: t.newlines > 1})
+			ended = nil
+			continue
+		}
+		if t.is(";") {
+			// Empty statement.
+			p.pos++
+			continue
+		}
+		st, err := p.statement(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, st)
+		ended, endSlot = st, &st.trailing
+		if st.block {
+			endSlot = &st.closeTrailing
+		}
+	}
+	if depth > 0 {
+		return nil, &SyntaxError{p.tokens[len(p.tokens)-1].line, "unexpected end of file, expected '}'"}
+	}
+	return items, nil
+}
+
+func (p *parser) statement(depth int) (*item, error) {
+	st := &item{blankBefore: p.tokens[p.pos].newlines > 1}
+	aggregateDepth := 0
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		p.pos++
+		switch {
+		case t.is(";") && aggregateDepth == 0:
+			st.tokens = append(st.tokens, t)
+			return st, nil
+		case t.is("{") && (aggregateDepth > 0 || isAggregateValue(st.tokens)):
+			aggregateDepth++
+		case t.is("}") && aggregateDepth > 0:
+			aggregateDepth--
+		case t.is("{"):
+			st.block = true
+			if p.pos < len(p.tokens) {
+				next := p.tokens[p.pos]
+				if next.kind == tokenLineComment && next.newlines == 0 {
+					st.openTrailing = next.text
+					p.pos++
+				}
+			}
+			children, err := p.items(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			st.children = children
+			// Consume the closing brace.
+			p.pos++
+			return st, nil
+		case t.is("}"):
+			return nil, &SyntaxError{t.line, "unexpected '}'"}
+		}
+		st.tokens = append(st.tokens, t)
+	}
+	return nil, &SyntaxError{p.tokens[len(p.tokens)-1].line, "unexpected end of file, expected ';'"}
+}
+
+// isAggregateValue tells whether a brace following tokens starts a message
+// literal, as in option values, rather than a block of definitions.
+func isAggregateValue(tokens []token) bool {
+	for _, t := range tokens {
+		if t.kind == tokenIdent && t.text == "group" {
+			return false
+		}
+	}
+	return slices.ContainsFunc(tokens, func(t token) bool { return t.is("=") || t.is(":") })
+}
+
+// Order of the file header statements.
+const (
+	headerSyntax = iota
+	headerPackage
+	headerImport
+	headerOption
+	notHeader
+)
+
+func headerKind(it *item) int {
+	if it.comment != nil || it.block || len(it.tokens) == 0 {
+		return notHeader
+	}
+	switch it.tokens[0].text {
+	case "syntax", "edition":
+		return headerSyntax
+	case "package":
+		return headerPackage
+	case "import":
+		return headerImport
+	case "option":
+		return headerOption
+	}
+	return notHeader
+}
+
+// sortHeader orders the header statements at the start of the file, keeping
+// each with the comments directly above it. Comments at the top of the file
+// separated by a blank line, such as license headers, stay at the top.
+func sortHeader(items []*item) []*item {
+	// Detached comments at the top of the file.
+	top := 0
+	for i := 0; i < len(items) && items[i].comment != nil; i++ {
+		if i+1 < len(items) && items[i+1].blankBefore {
+			top = i + 1
+		}
+	}
+
+	type unit struct {
+		items []*item
+		kind  int
+		key   string
+	}
+	var units []unit
+	var pending []*item
+	end := top
+	for i := top; i < len(items); i++ {
+		it := items[i]
+		if it.comment != nil {
+			pending = append(pending, it)
+			continue
+		}
+		kind := headerKind(it)
+		if kind == notHeader {
+			break
+		}
+		key := ""
+		if kind == headerImport || kind == headerOption {
+			key = tokensText(it.tokens[1:])
+		}
+		units = append(units, unit{append(pending, it), kind, key})
+		pending = nil
+		end = i + 1
+	}
+	slices.SortStableFunc(units, func(a, b unit) int {
+		if a.kind != b.kind {
+			return a.kind - b.kind
+		}
+		return strings.Compare(a.key, b.key)
+	})
+
+	sorted := slices.Clone(items[:top])
+	for i, u := range units {
+		u.items[0].blankBefore = (i == 0 && top > 0) || (i > 0 && units[i-1].kind != u.kind)
+		for _, it := range u.items[1:] {
+			it.blankBefore = false
+		}
+		sorted = append(sorted, u.items...)
+	}
+	if end < len(items) && len(units) > 0 {
+		items[end].blankBefore = true
+	}
+	return append(sorted, items[end:]...)
+}
+
+func tokensText(tokens []token) string {
+	var text strings.Builder
+	for _, t := range tokens {
+		text.WriteString(t.text)
+	}
+	return text.String()
+}
+
+type printer struct {
+	strings.Builder
+}
+
+func (p *printer) newline(depth int) {
+	p.WriteByte('\n')
+	p.WriteString(strings.Repeat(Indent, depth))
+}
+
+func (p *printer) items(items []*item, depth int) {
+	for i, it := range items {
+		if it.blankBefore && i > 0 {
+			p.WriteByte('\n')
+		}
+		p.WriteString(strings.Repeat(Indent, depth))
+		if it.comment != nil {
+			p.WriteString(it.comment.text)
+			p.WriteByte('\n')
+			continue
+		}
+		p.statement(it.tokens, depth)
+		if !it.block {
+			p.trailing(it.trailing)
+			p.WriteByte('\n')
+			continue
+		}
+		if len(it.children) == 0 && it.openTrailing == "" {
+			p.WriteString(" {}")
+		} else {
+			p.WriteString(" {")
+			p.trailing(it.openTrailing)
+			p.WriteByte('\n')
+			p.items(it.children, depth+1)
+			p.WriteString(strings.Repeat(Indent, depth) + "}")
+		}
+		p.trailing(it.closeTrailing)
+		p.WriteByte('\n')
+	}
+}
+
+func (p *printer) trailing(comment string) {
+	if comment != "" {
+		p.WriteString(" " + comment)
+	}
+}
+
+// statement prints the tokens of a statement, breaking message literals over
+// multiple lines.
+func (p *printer) statement(tokens []token, depth int) {
+	aggregateDepth := 0
+	for i, t := range tokens {
+		if i > 0 {
+			prev := tokens[i-1]
+			var next *token
+			if i+1 < len(tokens) {
+				next = &tokens[i+1]
+			}
+			switch {
+			case prev.kind == tokenLineComment:
+				p.newline(depth + 1 + aggregateDepth)
+			case aggregateDepth > 0 && t.is("}"):
+				if !prev.is("{") {
+					p.newline(depth + aggregateDepth - 1)
+				}
+			case aggregateDepth > 0 && (prev.is("{") || isFieldStart(prev, t, next)):
+				p.newline(depth + aggregateDepth)
+			case needSpace(tokens[:i], t):
+				p.WriteByte(' ')
+			}
+		}
+		p.WriteString(t.text)
+		if t.is("{") {
+			aggregateDepth++
+		} else if t.is("}") {
+			aggregateDepth--
+		}
+	}
+}
+
+// isFieldStart tells whether t starts a field of a message literal.
+func isFieldStart(prev, t token, next *token) bool {
+	if prev.is(":") || prev.is(".") || prev.is("[") || prev.is("-") {
+		return false
+	}
+	if t.is("[") {
+		return !prev.is(",")
+	}
+	return t.kind == tokenIdent && next != nil && (next.is(":") || next.is("{") || next.is("<"))
+}
+
+// needSpace tells whether a space separates t from the tokens printed before
+// it on the same line.
+func needSpace(before []token, t token) bool {
+	prev := before[len(before)-1]
+	switch {
+	case t.is(";") || t.is(",") || t.is(")") || t.is("]") || t.is(">") || t.is(":") || t.is("<"):
+		return false
+	case t.is("."):
+		// Fully qualified names may start with a dot, as in
+		// "optional .pkg.Message field = 1;".
+		return t.spaced && prev.kind == tokenIdent
+	case prev.is("(") || prev.is("[") || prev.is("<") || prev.is("."):
+		return false
+	case t.is("(") && len(before) >= 2 && before[len(before)-2].text == "rpc":
+		return false
+	case prev.is("-"):
+		// Unary minus.
+		if len(before) < 2 {
+			return false
+		}
+		switch op := before[len(before)-2]; {
+		case op.is("="), op.is(","), op.is("["), op.is("("), op.is(":"):
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package protofmt
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	testCases := map[string]struct {
+		src      string
+		expected string
+	}{
+		"empty": {
+			src:      "",
+			expected: "",
+		},
+		"spacing and indentation": {
+			src: "syntax=\"proto3\";\nmessage Pet{\n    int64 id=1;\n\tmap<string,int32> tags=2 [deprecated=true];\n}\n",
+			expected: "syntax = \"proto3\";\n\nmessage Pet {\n  int64 id = 1;\n" +
+				"  map<string, int32> tags = 2 [deprecated = true];\n}\n",
+		},
+		"blank lines": {
+			src:      "message A {\n\n  int32 a = 1;\n\n\n  int32 b = 2;\n\n}\n\n\n\nmessage B {}\n",
+			expected: "message A {\n  int32 a = 1;\n\n  int32 b = 2;\n}\n\nmessage B {}\n",
+		},
+		"one statement per line": {
+			src:      "enum Kind { KIND_UNSPECIFIED = 0; KIND_NEG = -1; }\n",
+			expected: "enum Kind {\n  KIND_UNSPECIFIED = 0;\n  KIND_NEG = -1;\n}\n",
+		},
+		"comments": {
+			src:      "// Leading.\nmessage A { // open\n  /* block */ int32 a = 1;   // trailing   \n} // close\n",
+			expected: "// Leading.\nmessage A { // open\n  /* block */\n  int32 a = 1; // trailing\n} // close\n",
+		},
+		"header order": {
+			src: "// License.\n\n// Syntax.\nsyntax = \"proto3\";\noption go_package = \"x\";\n" +
+				"import \"b.proto\";\n// About a.\nimport \"a.proto\";\noption cc_enable_arenas = true;\npackage p;\nmessage M {}\n",
+			expected: "// License.\n\n// Syntax.\nsyntax = \"proto3\";\n\npackage p;\n\n" +
+				"// About a.\nimport \"a.proto\";\nimport \"b.proto\";\n\n" +
+				"option cc_enable_arenas = true;\noption go_package = \"x\";\n\nmessage M {}\n",
+		},
+		"rpc and qualified names": {
+			src:      "service S {\n  rpc Get (.p.Req) returns(stream p.Res);\n}\n",
+			expected: "service S {\n  rpc Get(.p.Req) returns (stream p.Res);\n}\n",
+		},
+		"message literal": {
+			src:      "option (a) = { b: 1 c { d: \"e\" } f: [1, 2] };\n",
+			expected: "option (a) = {\n  b: 1\n  c {\n    d: \"e\"\n  }\n  f: [1, 2]\n};\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			formatted, err := Format([]byte(tc.src))
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if string(formatted) != tc.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tc.expected, formatted)
+			}
+			// Formatting is idempotent.
+			again, err := Format(formatted)
+			if err != nil || string(again) != string(formatted) {
+				t.Errorf("Expected formatting to be idempotent, got\n%s\n(%v)", again, err)
+			}
+		})
+	}
+}
+
+func TestFormat_SyntaxError(t *testing.T) {
+	testCases := map[string]struct {
+		src  string
+		line int
+	}{
+		"unterminated string":  {src: "syntax = \"proto3;\n", line: 1},
+		"unterminated comment": {src: "message A {}\n/* oops", line: 2},
+		"missing brace":        {src: "message A {\n  int32 a = 1;\n", line: 2},
+		"extra brace":          {src: "message A {}\n}\n", line: 2},
+		"missing semicolon":    {src: "syntax = \"proto3\"", line: 1},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Format([]byte(tc.src))
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Expected SyntaxError, got: %v", err)
+			}
+			if syntaxErr.Line != tc.line {
+				t.Errorf("Expected error on line %d, got: %v", tc.line, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package protofmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenPunct
+	tokenLineComment
+	tokenBlockComment
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// line is the 1-based line the token starts at.
+	line int
+	// newlines is the number of line breaks between the end of the previous
+	// token and the start of this one, and spaced whether any whitespace
+	// separates them.
+	newlines int
+	spaced   bool
+}
+
+func (t token) isComment() bool {
+	return t.kind == tokenLineComment || t.kind == tokenBlockComment
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokenPunct && t.text == punct
+}
+
+// SyntaxError is returned when the input cannot be tokenized or its braces
+// are unbalanced.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line, newlines, spaced := 1, 0, false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			newlines++
+			spaced = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			spaced = true
+			i++
+			continue
+		}
+
+		start, startLine := i, line
+		var kind tokenKind
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			kind = tokenLineComment
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			kind = tokenBlockComment
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, &SyntaxError{startLine, "unterminated block comment"}
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += 2 + end + 2
+		case isLetter(c):
+			kind = tokenIdent
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			kind = tokenNumber
+			for i < len(src) {
+				d := src[i]
+				if isLetter(d) || isDigit(d) || d == '.' {
+					i++
+				} else if (d == '+' || d == '-') && (src[i-1] == 'e' || src[i-1] == 'E') {
+					i++
+				} else {
+					break
+				}
+			}
+		case c == '"' || c == '\'':
+			kind = tokenString
+			i++
+			for ; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+				if i < len(src) && src[i] == '\n' {
+					return nil, &SyntaxError{startLine, "unterminated string"}
+				}
+			}
+			if i >= len(src) {
+				return nil, &SyntaxError{startLine, "unterminated string"}
+			}
+			i++
+		default:
+			kind = tokenPunct
+			i++
+		}
+		text := src[start:i]
+		if kind == tokenLineComment {
+			text = strings.TrimRight(text, " \t\r")
+		}
+		tokens = append(tokens, token{kind: kind, text: text, line: startLine, newlines: newlines, spaced: spaced})
+		newlines, spaced = 0, false
+	}
+	return tokens, nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
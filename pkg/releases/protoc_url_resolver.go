@@ -6,7 +6,12 @@ import (
 	"strings"
 )
 
-type ProtocURLResolver struct{}
+type ProtocURLResolver struct {
+	// WasmURL is the URL of the protoc releases compiled to WebAssembly, for
+	// the wasip1/wasm platform, in which {version} is replaced with the
+	// version. The protobuf project publishes no such releases.
+	WasmURL string
+}
 
 func NewProtocURLResolver() *ProtocURLResolver {
 	return &ProtocURLResolver{}
@@ -14,6 +19,12 @@ func NewProtocURLResolver() *ProtocURLResolver {
 
 func (resolver *ProtocURLResolver) ResolveURL(version, goos, goarch string) (*url.URL, error) {
 	sanitizedVersion := strings.TrimPrefix(version, "v")
+	if goos == "wasip1" {
+		if resolver.WasmURL == "" {
+			return nil, fmt.Errorf("no protoc release for %s/%s: the URL of protoc compiled to WebAssembly is not set", goos, goarch)
+		}
+		return url.Parse(strings.ReplaceAll(resolver.WasmURL, "{version}", sanitizedVersion))
+	}
 	filename := resolver.getPlatformFilename(sanitizedVersion, goos, goarch)
 	url := &url.URL{
 		Scheme: "https",
@@ -53,6 +64,12 @@ func (resolver *ProtocURLResolver) getPlatformFilename(version, goos, goarch str
 		arch = "x86_64"
 	case "arm64":
 		arch = "aarch_64"
+	case "386":
+		arch = "x86_32"
+	case "ppc64le":
+		arch = "ppcle_64"
+	case "s390x":
+		arch = "s390_64"
 	default:
 		arch = goarch // fallback
 	}
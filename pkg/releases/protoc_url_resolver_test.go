@@ -24,6 +24,10 @@ func TestProtocURLResolver_ResolveURL(t *testing.T) {
 		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-osx-aarch_64.zip":   {version: "v32.1", goos: "darwin", goarch: "arm64"},
 		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-osx-x86_64.zip":     {version: "v32.1", goos: "darwin", goarch: "amd64"},
 		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-win64.zip":          {version: "v32.1", goos: "windows", goarch: "amd64"},
+		// Other Linux architectures.
+		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-linux-x86_32.zip":   {version: "v32.1", goos: "linux", goarch: "386"},
+		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-linux-ppcle_64.zip": {version: "v32.1", goos: "linux", goarch: "ppc64le"},
+		"https://github.com/protocolbuffers/protobuf/releases/download/v32.1/protoc-32.1-linux-s390_64.zip":  {version: "v32.1", goos: "linux", goarch: "s390x"},
 		// v prefix in version is optional.
 		"https://github.com/protocolbuffers/protobuf/releases/download/v32.0/protoc-32.0-linux-aarch_64.zip": {version: "32.0", goos: "linux", goarch: "arm64"},
 	}
@@ -130,6 +134,21 @@ func TestProtocURLResolver_UnknownPlatforms(t *testing.T) {
 	}
 }
 
+func TestProtocURLResolver_Wasm(t *testing.T) {
+	resolver := &ProtocURLResolver{WasmURL: "https://example.com/protoc-{version}-wasm.zip"}
+	url, err := resolver.ResolveURL("v32.1", "wasip1", "wasm")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected := "https://example.com/protoc-32.1-wasm.zip"; url.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, url.String())
+	}
+
+	if _, err := (&ProtocURLResolver{}).ResolveURL("v32.1", "wasip1", "wasm"); err == nil {
+		t.Error("Expected an error without WasmURL")
+	}
+}
+
 func TestProtocURLResolver_EdgeCases(t *testing.T) {
 	testCases := []struct {
 		name     string
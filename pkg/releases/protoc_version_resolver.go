@@ -7,7 +7,14 @@ import (
 	"strings"
 )
 
-type ProtocVersionResolver struct{}
+// ReleasesAPIURL is the GitHub API URL of the protobuf releases.
+const ReleasesAPIURL = "https://api.github.com/repos/protocolbuffers/protobuf/releases"
+
+type ProtocVersionResolver struct {
+	// ReleasesURL is the GitHub API URL of the protobuf releases. Defaults
+	// to ReleasesAPIURL.
+	ReleasesURL string
+}
 
 func NewProtocVersionResolver() *ProtocVersionResolver {
 	return &ProtocVersionResolver{}
@@ -28,7 +35,7 @@ func (resolver *ProtocVersionResolver) ResolveVersion(tag string) (string, error
 }
 
 func (resolver *ProtocVersionResolver) getLatestReleaseTag() (string, error) {
-	resp, err := http.Get("https://api.github.com/repos/protocolbuffers/protobuf/releases/latest")
+	resp, err := http.Get(resolver.releasesURL() + "/latest")
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch latest release: %w", err)
 	}
@@ -47,3 +54,44 @@ func (resolver *ProtocVersionResolver) getLatestReleaseTag() (string, error) {
 
 	return release.TagName, nil
 }
+
+// ListVersions returns the versions of the published protoc releases, without
+// the 'v' prefix. Drafts and prereleases are left out.
+func (resolver *ProtocVersionResolver) ListVersions() ([]string, error) {
+	var versions []string
+	for page := 1; ; page++ {
+		resp, err := http.Get(fmt.Sprintf("%s?per_page=100&page=%d", resolver.releasesURL(), page))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list releases: %w", err)
+		}
+		var releases []struct {
+			TagName    string `json:"tag_name"`
+			Draft      bool   `json:"draft"`
+			Prerelease bool   `json:"prerelease"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&releases)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		if len(releases) == 0 {
+			return versions, nil
+		}
+		for _, release := range releases {
+			if !release.Draft && !release.Prerelease {
+				versions = append(versions, strings.TrimPrefix(release.TagName, "v"))
+			}
+		}
+	}
+}
+
+func (resolver *ProtocVersionResolver) releasesURL() string {
+	if resolver.ReleasesURL != "" {
+		return resolver.ReleasesURL
+	}
+	return ReleasesAPIURL
+}
@@ -3,6 +3,8 @@ package releases
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"golang.org/x/mod/semver"
@@ -152,3 +154,38 @@ func TestProtocVersionResolver_Integration(t *testing.T) {
 	t.Logf("Latest version: %s", latestVersion)
 	t.Logf("Specific version: %s", specificVersion)
 }
+
+func TestProtocVersionResolver_ListVersions(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"tag_name": "v33.0-rc1", "prerelease": true}, {"tag_name": "v32.1"}, {"tag_name": "v32.0"}]`,
+		"2": `[{"tag_name": "v31.1"}, {"tag_name": "v31.0", "draft": true}]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("per_page") != "100" {
+			t.Errorf("Expected 100 releases per page, got %s", r.URL.RawQuery)
+		}
+		page, ok := pages[r.URL.Query().Get("page")]
+		if !ok {
+			page = "[]"
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	resolver := &ProtocVersionResolver{ReleasesURL: server.URL}
+	versions, err := resolver.ListVersions()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []string{"32.1", "32.0", "31.1"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Expected %v, got %v", expected, versions)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	if _, err := resolver.ListVersions(); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected status error, got: %v", err)
+	}
+}
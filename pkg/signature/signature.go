@@ -0,0 +1,233 @@
+// Package signature verifies the detached signatures of downloaded archives,
+// such as protoc releases, before bincache caches them. It supports the
+// signatures of minisign, checked with a minisign public key, and the
+// signatures of cosign sign-blob and openssl, checked with a PEM-encoded
+// ECDSA, Ed25519 or RSA public key. cosign signatures may be given as
+// bundles, from which only the signature is used, as their transparency log
+// entries would require network access.
+package signature
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/pkg/downloader"
+	"github.com/jedisct1/go-minisign"
+)
+
+// ErrInvalidSignature is returned when an archive does not match its
+// signature.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// FileDownloader downloads signatures given by URL.
+type FileDownloader interface {
+	DownloadFile(url string, w io.Writer) (int64, error)
+}
+
+// Verifier verifies release archives against the detached signatures made
+// with a trusted key. Keys are either minisign public keys, for signatures
+// made with minisign, or PEM-encoded ECDSA, Ed25519 or RSA public keys, for
+// signatures made with cosign sign-blob or openssl. Signatures of the latter
+// may be cosign bundles, whose transparency log entries are not checked, so
+// that verification works offline.
+type Verifier struct {
+	FileDownloader
+	// Signatures is where the signature of an archive is found. It is the
+	// signature file itself, a directory or a base URL holding the
+	// signature of every archive next to its name, or, when empty, the URL
+	// of the archive. Signature files are named after their archive with
+	// the extension .minisig for minisign keys and .sig otherwise.
+	Signatures string
+
+	extension string
+	verify    func(archive, signature []byte) error
+}
+
+// NewVerifier creates a verifier of the signatures made with the private key
+// of publicKey, found at signatures.
+func NewVerifier(publicKey []byte, signatures string) (*Verifier, error) {
+	verifier := &Verifier{
+		FileDownloader: downloader.NewFileDownloader(),
+		Signatures:     signatures,
+	}
+	if block, _ := pem.Decode(publicKey); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		verifier.extension = ".sig"
+		verifier.verify = func(archive, signature []byte) error {
+			return verifyKey(key, archive, signature)
+		}
+		return verifier, nil
+	}
+	key, err := parseMinisignKey(string(publicKey))
+	if err != nil {
+		return nil, err
+	}
+	verifier.extension = ".minisig"
+	verifier.verify = func(archive, signature []byte) error {
+		return verifyMinisign(key, archive, signature)
+	}
+	return verifier, nil
+}
+
+// LoadVerifier creates a verifier with the public key in keyPath.
+func LoadVerifier(keyPath string, signatures string) (*Verifier, error) {
+	publicKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	verifier, err := NewVerifier(publicKey, signatures)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyPath, err)
+	}
+	return verifier, nil
+}
+
+// VerifyArchive verifies the archive at archivePath, downloaded from
+// archiveURL, against its signature.
+func (verifier *Verifier) VerifyArchive(archiveURL, archivePath string) error {
+	name := path.Base(archiveURL)
+	if u, err := url.Parse(archiveURL); err == nil {
+		name = path.Base(u.Path)
+	}
+	signature, err := verifier.signature(archiveURL, name)
+	if err != nil {
+		return fmt.Errorf("failed to get signature of %s: %w", name, err)
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := verifier.verify(archive, signature); err != nil {
+		return fmt.Errorf("failed to verify %s: %w", name, err)
+	}
+	return nil
+}
+
+// signature returns the content of the signature of the archive name
+// downloaded from archiveURL.
+func (verifier *Verifier) signature(archiveURL, name string) ([]byte, error) {
+	location := verifier.Signatures
+	switch {
+	case location == "":
+		location = archiveURL + verifier.extension
+	case strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://"):
+		location = strings.TrimSuffix(location, "/") + "/" + name + verifier.extension
+	default:
+		info, err := os.Stat(location)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			location = filepath.Join(location, name+verifier.extension)
+		}
+		return os.ReadFile(location)
+	}
+	var buf bytes.Buffer
+	if _, err := verifier.DownloadFile(location, &buf); err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", location, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseMinisignKey parses a minisign public key, either the content of a
+// minisign.pub file or the key line alone.
+func parseMinisignKey(publicKey string) (minisign.PublicKey, error) {
+	publicKey = strings.TrimSpace(strings.ReplaceAll(publicKey, "\r", ""))
+	var key minisign.PublicKey
+	var err error
+	if strings.HasPrefix(publicKey, "untrusted comment:") {
+		key, err = minisign.DecodePublicKey(publicKey)
+	} else {
+		key, err = minisign.NewPublicKey(publicKey)
+	}
+	if err != nil {
+		return key, fmt.Errorf("public key is neither a PEM nor a minisign public key: %w", err)
+	}
+	return key, nil
+}
+
+func verifyMinisign(key minisign.PublicKey, archive, signature []byte) error {
+	sig, err := minisign.DecodeSignature(strings.ReplaceAll(string(signature), "\r", ""))
+	if err != nil {
+		return fmt.Errorf("failed to decode minisign signature: %w", err)
+	}
+	if ok, err := key.Verify(archive, sig); !ok {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// cosignBundle holds the signature of both the legacy bundles written by
+// cosign sign-blob --bundle and Sigstore bundles.
+type cosignBundle struct {
+	Base64Signature  string `json:"base64Signature"`
+	MessageSignature struct {
+		Signature string `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+// decodeSignature returns the raw signature of a cosign bundle, a
+// base64-encoded signature or a raw signature.
+func decodeSignature(signature []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(signature)
+	encoded := string(trimmed)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var bundle cosignBundle
+		if err := json.Unmarshal(trimmed, &bundle); err != nil {
+			return nil, fmt.Errorf("failed to parse signature bundle: %w", err)
+		}
+		encoded = bundle.Base64Signature
+		if encoded == "" {
+			encoded = bundle.MessageSignature.Signature
+		}
+		if encoded == "" {
+			return nil, fmt.Errorf("signature bundle has no signature")
+		}
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return decoded, nil
+	}
+	return signature, nil
+}
+
+func verifyKey(key crypto.PublicKey, archive, signature []byte) error {
+	signature, err := decodeSignature(signature)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(archive)
+	valid := false
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, archive, signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var archive = []byte("protoc release archive")
+
+// minisignKey returns a minisign public key and a function signing content
+// with it, like minisign -S does.
+func minisignKey(t *testing.T) (string, func(content []byte) string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte("go-proto")
+	encodedKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), publicKey...))
+	sign := func(content []byte) string {
+		signature := ed25519.Sign(privateKey, content)
+		trustedComment := "timestamp:1760000000\tfile:protoc.zip"
+		globalSignature := ed25519.Sign(privateKey, append(signature, trustedComment...))
+		return fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), signature...)),
+			trustedComment,
+			base64.StdEncoding.EncodeToString(globalSignature))
+	}
+	return "untrusted comment: minisign public key\n" + encodedKey + "\n", sign
+}
+
+func pemKey(t *testing.T, publicKey crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifier_VerifyArchive(t *testing.T) {
+	minisignPublicKey, minisignSign := minisignKey(t)
+	_, otherMinisignSign := minisignKey(t)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(archive)
+	ecdsaSignature, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519PublicKey, ed25519PrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		publicKey   []byte
+		signature   []byte
+		archive     []byte
+		expectedErr error
+	}{
+		"minisign": {
+			publicKey: []byte(minisignPublicKey),
+			signature: []byte(minisignSign(archive)),
+		},
+		"minisign key line": {
+			publicKey: []byte(strings.Split(minisignPublicKey, "\n")[1]),
+			signature: []byte(minisignSign(archive)),
+		},
+		"minisign tampered archive": {
+			publicKey:   []byte(minisignPublicKey),
+			signature:   []byte(minisignSign(archive)),
+			archive:     []byte("tampered archive"),
+			expectedErr: ErrInvalidSignature,
+		},
+		"minisign other key": {
+			publicKey:   []byte(minisignPublicKey),
+			signature:   []byte(otherMinisignSign(archive)),
+			expectedErr: ErrInvalidSignature,
+		},
+		"cosign bundle": {
+			publicKey: pemKey(t, &ecdsaKey.PublicKey),
+			signature: fmt.Appendf(nil, `{"base64Signature": %q, "rekorBundle": {}}`, base64.StdEncoding.EncodeToString(ecdsaSignature)),
+		},
+		"sigstore bundle": {
+			publicKey: pemKey(t, &ecdsaKey.PublicKey),
+			signature: fmt.Appendf(nil, `{"messageSignature": {"signature": %q}}`, base64.StdEncoding.EncodeToString(ecdsaSignature)),
+		},
+		"cosign tampered archive": {
+			publicKey:   pemKey(t, &ecdsaKey.PublicKey),
+			signature:   []byte(base64.StdEncoding.EncodeToString(ecdsaSignature)),
+			archive:     []byte("tampered archive"),
+			expectedErr: ErrInvalidSignature,
+		},
+		"ed25519": {
+			publicKey: pemKey(t, ed25519PublicKey),
+			signature: ed25519.Sign(ed25519PrivateKey, archive),
+		},
+		"rsa": {
+			publicKey: pemKey(t, &rsaKey.PublicKey),
+			signature: []byte(base64.StdEncoding.EncodeToString(rsaSignature) + "\n"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			verifier, err := NewVerifier(tc.publicKey, dir)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			content := archive
+			if tc.archive != nil {
+				content = tc.archive
+			}
+			archivePath := writeFile(t, t.TempDir(), "download.zip", content)
+			writeFile(t, dir, "protoc-32.1-linux-x86_64.zip"+verifier.extension, tc.signature)
+
+			err = verifier.VerifyArchive("https://example.com/v32.1/protoc-32.1-linux-x86_64.zip", archivePath)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("Expected %v, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Signatures(t *testing.T) {
+	publicKey, sign := minisignKey(t)
+	archivePath := writeFile(t, t.TempDir(), "download.zip", archive)
+	signature := sign(archive)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/signatures/protoc.zip.minisig" && r.URL.Path != "/releases/protoc.zip.minisig" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(signature)))
+		w.Write([]byte(signature))
+	}))
+	defer server.Close()
+	signatureFile := writeFile(t, t.TempDir(), "bundle.minisig", []byte(signature))
+
+	testCases := map[string]struct {
+		signatures  string
+		expectedErr string
+	}{
+		"next to the archive": {signatures: ""},
+		"base url":            {signatures: server.URL + "/signatures/"},
+		"local file":          {signatures: signatureFile},
+		"missing directory": {
+			signatures:  filepath.Join(t.TempDir(), "missing"),
+			expectedErr: "failed to get signature of protoc.zip",
+		},
+		"missing signature": {
+			signatures:  server.URL + "/other",
+			expectedErr: "bad status",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			verifier, err := NewVerifier([]byte(publicKey), tc.signatures)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			err = verifier.VerifyArchive(server.URL+"/releases/protoc.zip", archivePath)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifier_InvalidKey(t *testing.T) {
+	_, err := NewVerifier([]byte("not a key"), "")
+	if err == nil || !strings.Contains(err.Error(), "neither a PEM nor a minisign public key") {
+		t.Errorf("Expected invalid key error, got: %v", err)
+	}
+}
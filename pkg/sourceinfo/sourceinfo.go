@@ -0,0 +1,51 @@
+// Package sourceinfo looks up the position and comments of descriptor
+// elements in the source code info protoc records with --include_source_info.
+package sourceinfo
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Locations maps source code info paths to their location in the file.
+type Locations map[string]*descriptorpb.SourceCodeInfo_Location
+
+// New indexes the source code info of file.
+func New(file *descriptorpb.FileDescriptorProto) Locations {
+	locs := make(Locations)
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		if len(loc.GetSpan()) >= 2 {
+			locs[pathKey(loc.GetPath())] = loc
+		}
+	}
+	return locs
+}
+
+// Position returns the 1-based line and column of the element at path, or of
+// its closest ancestor with a known position. It returns zeros when none is
+// known, for instance when the descriptors were built without source info.
+func (locs Locations) Position(path []int32) (int, int) {
+	for len(path) > 0 {
+		if loc, ok := locs[pathKey(path)]; ok {
+			return int(loc.GetSpan()[0]) + 1, int(loc.GetSpan()[1]) + 1
+		}
+		path = path[:len(path)-1]
+	}
+	return 0, 0
+}
+
+// Comments returns the leading and trailing comments of the element at path,
+// without surrounding whitespace, or an empty string when it has none.
+func (locs Locations) Comments(path []int32) string {
+	loc, ok := locs[pathKey(path)]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(loc.GetLeadingComments() + loc.GetTrailingComments())
+}
+
+func pathKey(path []int32) string {
+	return fmt.Sprint(path)
+}
@@ -0,0 +1,62 @@
+package sourceinfo
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func testFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name: proto.String("pet.proto"),
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{4, 0}, Span: []int32{4, 0, 7, 1}, LeadingComments: proto.String(" A pet.\n")},
+				{Path: []int32{4, 0, 2, 1}, Span: []int32{6, 2, 18}, TrailingComments: proto.String(" The name.\n")},
+				{Path: []int32{4, 1}, Span: []int32{9, 0, 10, 1}},
+			},
+		},
+	}
+}
+
+func TestLocations_Position(t *testing.T) {
+	locs := New(testFile())
+	tests := map[string]struct {
+		path         []int32
+		line, column int
+	}{
+		"exact":    {path: []int32{4, 0, 2, 1}, line: 7, column: 3},
+		"ancestor": {path: []int32{4, 0, 2, 0}, line: 5, column: 1},
+		"unknown":  {path: []int32{5, 0}, line: 0, column: 0},
+		"empty":    {path: nil, line: 0, column: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			line, column := locs.Position(tt.path)
+			if line != tt.line || column != tt.column {
+				t.Errorf("Expected %d:%d, got %d:%d", tt.line, tt.column, line, column)
+			}
+		})
+	}
+}
+
+func TestLocations_Comments(t *testing.T) {
+	locs := New(testFile())
+	tests := map[string]struct {
+		path     []int32
+		expected string
+	}{
+		"leading":      {path: []int32{4, 0}, expected: "A pet."},
+		"trailing":     {path: []int32{4, 0, 2, 1}, expected: "The name."},
+		"none":         {path: []int32{4, 1}, expected: ""},
+		"not ancestor": {path: []int32{4, 0, 2, 0}, expected: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if comments := locs.Comments(tt.path); comments != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, comments)
+			}
+		})
+	}
+}
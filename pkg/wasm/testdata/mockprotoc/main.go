@@ -0,0 +1,52 @@
+// Command mockprotoc is a mock protoc for WASI, built by the tests of the
+// wasm package. It prints its arguments and handles a few flags: --version
+// only prints the version, like protoc, --descriptor_set_out copies
+// set.binpb, --cpp_out writes pet.pb.h, --cat prints the file given and
+// --touch creates it.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func main() {
+	if slices.Contains(os.Args[1:], "--version") {
+		fmt.Println("libprotoc 32.1")
+		return
+	}
+	fmt.Println("mock-protoc called with args:", strings.Join(os.Args[1:], " "))
+	for _, arg := range os.Args[1:] {
+		flag, value, _ := strings.Cut(arg, "=")
+		var err error
+		switch flag {
+		case "--descriptor_set_out":
+			var content []byte
+			if content, err = os.ReadFile("set.binpb"); err == nil {
+				err = os.WriteFile(value, content, 0644)
+			}
+		case "--cpp_out":
+			if _, dir, ok := strings.Cut(value, ":"); ok {
+				value = dir
+			}
+			err = os.WriteFile(filepath.Join(value, "pet.pb.h"), []byte("cpp"), 0644)
+		case "--cat":
+			var content []byte
+			if content, err = os.ReadFile(value); err == nil {
+				fmt.Print(string(content))
+			}
+		case "--touch":
+			err = os.WriteFile(value, nil, 0644)
+		case "--fail":
+			fmt.Fprintln(os.Stderr, "pet.proto:1:1: failed")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
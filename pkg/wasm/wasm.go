@@ -0,0 +1,482 @@
+// Package wasm runs protoc compiled to WebAssembly for WASI with wazero, a
+// pure-Go WebAssembly runtime, as an alternative to the native protoc
+// releases. The protoc module is cached by bincache like the native releases,
+// behaves the same on every platform, and only accesses the directories it
+// is given in its arguments.
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/esdandreu/go-protoc/internal/protocrun"
+	"github.com/esdandreu/go-protoc/pkg/bincache"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// GOOS and GOARCH are the platform of the protoc modules in the cache.
+	GOOS   = "wasip1"
+	GOARCH = "wasm"
+	// Dir is the directory of the protoc cache holding the protoc links of
+	// the runtime, in a directory per version, and the compiled modules.
+	Dir = "wasm"
+	// CompiledDir is the directory of Dir caching the compiled modules.
+	CompiledDir = ".compiled"
+)
+
+// builtinGenerators are the generators built into protoc, which run in the
+// module. WASI cannot start processes, so the other --NAME_out flags run
+// their plugin on the host, on the descriptors compiled by the module.
+var builtinGenerators = []string{"cpp", "csharp", "java", "kotlin", "objc", "php", "pyi", "python", "ruby", "rust"}
+
+// ExitError is returned when protoc exits with a non-zero code, once it
+// printed its errors.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of protoc.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Runtime runs the protoc modules cached by a bincache.ProtocBinCache for
+// the wasip1/wasm platform. It is a protoc.BinCache whose binary is a link
+// named protoc to Executable, which runs Main when invoked through it, so
+// that programs running the binary keep working.
+type Runtime struct {
+	*bincache.ProtocBinCache
+	// CacheDir is the directory of the protoc cache, which also holds the
+	// proto dependencies and the outputs cached by go-protoc.
+	CacheDir string
+	// LinkDir is the directory of the protoc links and the compiled modules.
+	LinkDir string
+	// Executable is the program the protoc links point to. Defaults to the
+	// current program, see os.Executable.
+	Executable string
+}
+
+// NewRuntime creates a runtime of the protoc modules in the protoc cache of
+// cacheDir. Typically constructed with the result of os.UserCacheDir().
+// protoc publishes no module, so the URLResolver of the cache needs the URL
+// of the modules, see releases.ProtocURLResolver.
+func NewRuntime(cacheDir string) *Runtime {
+	dir := filepath.Join(cacheDir, bincache.DefaultProtocBinCachePrefix)
+	return &Runtime{
+		ProtocBinCache: bincache.NewProtocBinCache(cacheDir).ForPlatform(GOOS, GOARCH),
+		CacheDir:       dir,
+		LinkDir:        filepath.Join(dir, Dir),
+	}
+}
+
+// Dir returns the directory of the protoc cache, see CacheDir, rather than
+// the directory of the modules in it.
+func (r *Runtime) Dir() string {
+	return r.CacheDir
+}
+
+// BinPath returns the path of the protoc link of the module of tag,
+// downloading the module if it is not cached yet.
+func (r *Runtime) BinPath(tag string) (string, error) {
+	version, err := r.ResolveVersion(tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve version: %w", err)
+	}
+	if _, err := r.ProtocBinCache.BinPath(version); err != nil {
+		return "", err
+	}
+	executable := r.Executable
+	if executable == "" {
+		if executable, err = os.Executable(); err != nil {
+			return "", fmt.Errorf("failed to find executable: %w", err)
+		}
+	}
+	binPath := filepath.Join(r.LinkDir, version, "bin", "protoc")
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+	if err := protocrun.Link(executable, binPath); err != nil {
+		return "", err
+	}
+	return binPath, nil
+}
+
+// linkVersion returns the version of the protoc link at binPath.
+func linkVersion(binPath string) string {
+	return filepath.Base(filepath.Dir(filepath.Dir(binPath)))
+}
+
+// IsLink reports whether a program was invoked through the protoc link of a
+// Runtime, given its first argument.
+func IsLink(arg0 string) bool {
+	if strings.TrimSuffix(filepath.Base(arg0), ".exe") != "protoc" {
+		return false
+	}
+	if !strings.ContainsRune(arg0, filepath.Separator) && !strings.ContainsRune(arg0, '/') {
+		path, err := exec.LookPath(arg0)
+		if err != nil {
+			return false
+		}
+		arg0 = path
+	}
+	dir := filepath.Dir(filepath.Dir(filepath.Dir(arg0)))
+	return filepath.Base(dir) == Dir && filepath.Base(filepath.Dir(dir)) == bincache.DefaultProtocBinCachePrefix
+}
+
+// Main runs the module of the protoc link arg0 in the current directory with
+// the protoc arguments args and returns the exit code, like protoc.
+func Main(arg0 string, args []string) int {
+	if path, err := exec.LookPath(arg0); err == nil {
+		arg0 = path
+	}
+	cacheDir := filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(arg0)))))
+	err := NewRuntime(cacheDir).RunBin(context.Background(), arg0, ".", args, os.Stdin, os.Stdout, os.Stderr)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// RunBin runs the module of the protoc link at binPath in dir with the
+// protoc arguments args. The module only accesses dir, as its root
+// directory, and the other directories named in args, at their own path.
+// Directories holding inputs are read-only. The plugins of the --NAME_out
+// flags, other than the generators built into protoc, run on the host on the
+// descriptors compiled by the module.
+func (r *Runtime) RunBin(ctx context.Context, binPath, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	inv, err := protocrun.Parse(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return &ExitError{Code: 1}
+	}
+	modulePath := r.VersionBinPath(linkVersion(binPath))
+	module, err := r.load(ctx, modulePath)
+	if err != nil {
+		return err
+	}
+	defer module.close(ctx)
+
+	fsys, err := newSandbox(dir)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		// protoc prints its usage.
+		return module.run(ctx, fsys, nil, stdin, stdout, stderr)
+	}
+	// protoc finds the well-known types next to its binary, which the
+	// module cannot do.
+	includes := inv.IncludePaths()
+	wellKnown := filepath.Join(filepath.Dir(filepath.Dir(modulePath)), "include")
+	if info, err := os.Stat(wellKnown); err == nil && info.IsDir() {
+		includes = append(includes, wellKnown)
+	}
+	var common []string
+	for _, include := range includes {
+		common = append(common, "-I"+fsys.dir(include, false))
+	}
+	var inputs []string
+	for _, input := range inv.Inputs {
+		inputs = append(inputs, fsys.file(input, false))
+	}
+
+	var plugins, builtins []*protocrun.Output
+	for _, out := range inv.Outputs {
+		if slices.Contains(builtinGenerators, out.Name) {
+			builtins = append(builtins, out)
+		} else {
+			plugins = append(plugins, out)
+		}
+	}
+	var protocArgs []string
+	if inv.ErrorFormat != "" {
+		common = append(common, "--error_format="+inv.ErrorFormat)
+	}
+	for _, flag := range inv.Other {
+		name, value, _ := strings.Cut(flag, "=")
+		switch name {
+		case "--dependency_out":
+			protocArgs = append(protocArgs, name+"="+fsys.file(value, true))
+		case "--descriptor_set_in":
+			var files []string
+			for _, file := range filepath.SplitList(value) {
+				files = append(files, fsys.file(file, false))
+			}
+			common = append(common, name+"="+strings.Join(files, ":"))
+		default:
+			if strings.Contains(flag, "=") {
+				protocArgs = append(protocArgs, flag)
+			} else {
+				common = append(common, flag)
+			}
+		}
+	}
+	if inv.Version {
+		protocArgs = append(protocArgs, "--version")
+	}
+	if inv.DescriptorSetOut != "" {
+		protocArgs = append(protocArgs, "--descriptor_set_out="+fsys.file(inv.DescriptorSetOut, true))
+	}
+	if inv.IncludeImports {
+		protocArgs = append(protocArgs, "--include_imports")
+	}
+	if inv.IncludeSourceInfo {
+		protocArgs = append(protocArgs, "--include_source_info")
+	}
+	for _, out := range builtins {
+		value := fsys.dir(out.Dir, true)
+		if len(out.Parameters) > 0 {
+			value = strings.Join(out.Parameters, ",") + ":" + value
+		}
+		protocArgs = append(protocArgs, "--"+out.Name+"_out="+value)
+	}
+
+	if len(plugins) > 0 {
+		tempDir, err := os.MkdirTemp("", "go-protoc-wasm-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+		setPath := filepath.Join(tempDir, "set.binpb")
+		setArgs := slices.Concat(common, []string{"--descriptor_set_out=" + fsys.file(setPath, true), "--include_imports", "--include_source_info"}, inputs)
+		if err := module.run(ctx, fsys, setArgs, stdin, stdout, stderr); err != nil {
+			return err
+		}
+		content, err := os.ReadFile(setPath)
+		if err != nil {
+			return fmt.Errorf("failed to read descriptor set: %w", err)
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(content, set); err != nil {
+			return fmt.Errorf("failed to decode descriptor set: %w", err)
+		}
+		names := inv.FileNames(dir)
+		for _, out := range plugins {
+			if err := inv.RunPlugin(ctx, dir, out, set.GetFile(), names, stderr); err != nil {
+				fmt.Fprintf(stderr, "--%s_out: %v\n", out.Name, err)
+				return &ExitError{Code: 1}
+			}
+		}
+		if len(protocArgs) == 0 {
+			return nil
+		}
+	}
+	return module.run(ctx, fsys, slices.Concat(common, protocArgs, inputs), stdin, stdout, stderr)
+}
+
+// module is a compiled protoc module.
+type module struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// CheckBinary runs protoc --version in the module at modulePath and compares
+// the version reported with version, like bincache.VersionChecker does with
+// native binaries.
+func (r *Runtime) CheckBinary(modulePath, version string) error {
+	ctx := context.Background()
+	module, err := r.load(ctx, modulePath)
+	if err != nil {
+		return err
+	}
+	defer module.close(ctx)
+	fsys, err := newSandbox(".")
+	if err != nil {
+		return err
+	}
+	var stdout bytes.Buffer
+	if err := module.run(ctx, fsys, []string{"--version"}, nil, &stdout, io.Discard); err != nil {
+		return fmt.Errorf("failed to run protoc --version: %w", err)
+	}
+	return bincache.VersionChecker{}.CheckOutput(stdout.Bytes(), version)
+}
+
+// load compiles the module at modulePath, caching the compilation in the
+// CompiledDir of the runtime.
+func (r *Runtime) load(ctx context.Context, modulePath string) (*module, error) {
+	content, err := os.ReadFile(modulePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protoc module: %w", err)
+	}
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if r.LinkDir != "" {
+		// Modules are compiled on every run without the cache.
+		if cache, err := wazero.NewCompilationCacheWithDir(filepath.Join(r.LinkDir, CompiledDir)); err == nil {
+			config = config.WithCompilationCache(cache)
+		}
+	}
+	m := &module{runtime: wazero.NewRuntimeWithConfig(ctx, config)}
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, m.runtime); err != nil {
+		m.close(ctx)
+		return nil, fmt.Errorf("failed to instantiate WASI: %w", err)
+	}
+	if m.compiled, err = m.runtime.CompileModule(ctx, content); err != nil {
+		m.close(ctx)
+		return nil, fmt.Errorf("failed to compile protoc module: %w", err)
+	}
+	return m, nil
+}
+
+func (m *module) close(ctx context.Context) {
+	m.runtime.Close(ctx)
+}
+
+// run runs the module with args, with access to the directories of fsys.
+func (m *module) run(ctx context.Context, fsys *sandbox, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(append([]string{"protoc"}, args...)...).
+		WithFSConfig(fsys.config()).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithRandSource(rand.Reader).
+		WithSysWalltime().
+		WithSysNanotime()
+	if stdin != nil {
+		config = config.WithStdin(stdin)
+	}
+	instance, err := m.runtime.InstantiateModule(ctx, m.compiled, config)
+	if instance != nil {
+		instance.Close(ctx)
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return nil
+		}
+		return &ExitError{Code: int(exitErr.ExitCode())}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run protoc module: %w", err)
+	}
+	return nil
+}
+
+// sandbox is the file system of the module: the working directory at the
+// root, and the directories outside of it mounted at their own path. Only the
+// directories holding outputs are writable.
+type sandbox struct {
+	root string
+	// mounts are the directories of the module, root included, and whether
+	// they are writable.
+	mounts map[string]bool
+}
+
+func newSandbox(dir string) (*sandbox, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	return &sandbox{root: root, mounts: map[string]bool{root: false}}, nil
+}
+
+// dir returns the path of the directory at path, relative to the working
+// directory unless absolute, in the module, mounting it if needed.
+func (s *sandbox) dir(path string, writable bool) string {
+	return s.guestPath(path, writable, false)
+}
+
+// file returns the path of the file at path in the module, like dir, mounting
+// the directory holding it if needed.
+func (s *sandbox) file(path string, writable bool) string {
+	return s.guestPath(path, writable, true)
+}
+
+func (s *sandbox) guestPath(path string, writable, isFile bool) string {
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(s.root, path)
+	}
+	mount := abs
+	if isFile {
+		mount = filepath.Dir(abs)
+	}
+	rel, inRoot := s.relative(abs)
+	// Directories of the working directory are readable through the root.
+	if !inRoot || writable {
+		s.mounts[mount] = s.mounts[mount] || writable
+	}
+	if !inRoot {
+		return hostToGuest(abs)
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// relative returns the path of the absolute path relative to the working
+// directory, and whether it is in the working directory.
+func (s *sandbox) relative(abs string) (string, bool) {
+	rel, err := filepath.Rel(s.root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// hostToGuest returns the path in the module of the absolute path of a
+// mounted directory, which is the path itself outside of Windows. Volume
+// names lose their colon, which protoc takes as a separator.
+func hostToGuest(path string) string {
+	volume := filepath.VolumeName(path)
+	guest := filepath.ToSlash(path[len(volume):])
+	if volume != "" {
+		guest = "/" + strings.Trim(filepath.ToSlash(volume), "/:") + guest
+	}
+	return guest
+}
+
+// config returns the file system configuration of the module. Directories
+// of the working directory are mounted at their path relative to the root,
+// which the module resolves to the longest mounted prefix. The root is
+// mounted first, as the module starts in its first mount.
+func (s *sandbox) config() wazero.FSConfig {
+	config := wazero.NewFSConfig()
+	dirs := slices.DeleteFunc(slices.Sorted(maps.Keys(s.mounts)), func(dir string) bool {
+		return dir == s.root
+	})
+	for _, dir := range append([]string{s.root}, dirs...) {
+		guest := hostToGuest(dir)
+		if rel, ok := s.relative(dir); ok {
+			guest = path.Join("/", filepath.ToSlash(rel))
+		}
+		if s.mounts[dir] {
+			config = config.WithDirMount(dir, guest)
+		} else {
+			config = config.WithReadOnlyDirMount(dir, guest)
+		}
+	}
+	return config
+}
@@ -0,0 +1,284 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// mockModule is the path of testdata/mockprotoc compiled to WASI.
+var mockModule string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "go-protoc-wasm-test-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	mockModule = filepath.Join(dir, "protoc.wasm")
+	cmd := exec.Command("go", "build", "-o", mockModule, "./testdata/mockprotoc")
+	cmd.Env = append(os.Environ(), "GOOS="+GOOS, "GOARCH="+GOARCH)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build mock protoc module: %v\n%s", err, output)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRuntime creates a runtime with the mock module cached as v32.1, and
+// the well-known types, and returns it with the path of its protoc link.
+func newTestRuntime(t *testing.T) (*Runtime, string) {
+	t.Helper()
+	r := NewRuntime(t.TempDir())
+	r.Executable = filepath.Join(t.TempDir(), "go-protoc")
+	if err := os.WriteFile(r.Executable, []byte("go-protoc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(mockModule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulePath := r.VersionBinPath("32.1")
+	wellKnown := filepath.Join(filepath.Dir(filepath.Dir(modulePath)), "include", "google", "protobuf")
+	if err := os.MkdirAll(wellKnown, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(modulePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(modulePath, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	binPath, err := r.BinPath("v32.1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	return r, binPath
+}
+
+func TestRuntime_BinPath(t *testing.T) {
+	r, binPath := newTestRuntime(t)
+	expected := filepath.Join(r.LinkDir, "32.1", "bin", "protoc")
+	if runtime.GOOS == "windows" {
+		expected += ".exe"
+	}
+	if binPath != expected {
+		t.Errorf("Expected the link at %s, got %s", expected, binPath)
+	}
+	linked, err := os.Stat(binPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.Stat(r.Executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(linked, target) {
+		t.Errorf("Expected %s to link to %s", binPath, r.Executable)
+	}
+	if !IsLink(binPath) {
+		t.Errorf("Expected %s to be a protoc link", binPath)
+	}
+	if err := r.Validate("32.1"); err != nil {
+		t.Errorf("Expected the module to be cached, got: %v", err)
+	}
+}
+
+func TestRuntime_CheckBinary(t *testing.T) {
+	r, _ := newTestRuntime(t)
+	modulePath := r.VersionBinPath("32.1")
+	if err := r.CheckBinary(modulePath, "32.1"); err != nil {
+		t.Errorf("Expected the module to report 32.1, got: %v", err)
+	}
+	if err := r.CheckBinary(modulePath, "31.1"); err == nil || !strings.Contains(err.Error(), "libprotoc 32.1") {
+		t.Errorf("Expected a version mismatch, got: %v", err)
+	}
+}
+
+func TestIsLink(t *testing.T) {
+	testCases := map[string]bool{
+		filepath.Join("cache", "go-protoc", "wasm", "32.1", "bin", "protoc"):    true,
+		filepath.Join("cache", "go-protoc", "compiler", "bin", "protoc"):        false,
+		filepath.Join("cache", "go-protoc", "wasm", "32.1", "bin", "go-protoc"): false,
+		filepath.Join("cache", "go-protoc", "32.1", "bin", "protoc"):            false,
+		filepath.Join("cache", "other", "wasm", "32.1", "bin", "protoc"):        false,
+	}
+	for arg0, expected := range testCases {
+		if IsLink(arg0) != expected {
+			t.Errorf("Expected IsLink(%q) to be %v", arg0, expected)
+		}
+	}
+}
+
+func TestRuntime_RunBin(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		args           []string
+		expectedCode   int
+		expectedStdout []string
+		expectedStderr string
+		expectedFiles  []string
+	}{
+		"version": {
+			args:           []string{"--version"},
+			expectedStdout: []string{"libprotoc 32.1"},
+		},
+		"built-in generator": {
+			args:           []string{"--cpp_out=gen", "pet.proto"},
+			expectedStdout: []string{"args: -I. -I", "--cpp_out=gen pet.proto"},
+			expectedFiles:  []string{filepath.Join("gen", "pet.pb.h")},
+		},
+		"output outside the directory": {
+			args:           []string{"--cpp_out=dllexport_decl=X:" + outside, "pet.proto"},
+			expectedStdout: []string{"--cpp_out=dllexport_decl=X:" + hostToGuest(outside)},
+			expectedFiles:  []string{filepath.Join(outside, "pet.pb.h")},
+		},
+		"file outside the sandbox": {
+			args:           []string{"--cat=" + secret, "pet.proto"},
+			expectedCode:   1,
+			expectedStderr: "secret.txt",
+		},
+		"read-only working directory": {
+			args:           []string{"--cpp_out=gen", "--touch=x.proto", "pet.proto"},
+			expectedCode:   1,
+			expectedStderr: "x.proto",
+		},
+		"writable output directory": {
+			args:          []string{"--cpp_out=gen", "--touch=" + filepath.Join("gen", "x.proto"), "pet.proto"},
+			expectedFiles: []string{filepath.Join("gen", "pet.pb.h"), filepath.Join("gen", "x.proto")},
+		},
+		"read-only include": {
+			args:           []string{"-I" + outside, "--touch=" + filepath.Join(outside, "x.proto"), "pet.proto"},
+			expectedCode:   1,
+			expectedStderr: "x.proto",
+		},
+		"failure": {
+			args:           []string{"--fail", "pet.proto"},
+			expectedCode:   1,
+			expectedStderr: "pet.proto:1:1: failed\n",
+		},
+	}
+	r, binPath := newTestRuntime(t)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "gen"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			err := r.RunBin(context.Background(), binPath, dir, tc.args, nil, &stdout, &stderr)
+			var exitErr *ExitError
+			if tc.expectedCode != 0 {
+				if !errors.As(err, &exitErr) || exitErr.Code != tc.expectedCode {
+					t.Errorf("Expected exit code %d, got: %v", tc.expectedCode, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Expected no error, got: %v\n%s", err, stderr.String())
+			}
+			for _, expected := range tc.expectedStdout {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("Expected %q in the output, got:\n%s", expected, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), tc.expectedStderr) {
+				t.Errorf("Expected %q in the errors, got:\n%s", tc.expectedStderr, stderr.String())
+			}
+			for _, file := range tc.expectedFiles {
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(dir, file)
+				}
+				if _, err := os.Stat(file); err != nil {
+					t.Errorf("Expected %s to be written, got: %v", file, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntime_RunBin_Plugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock plugins require a POSIX shell")
+	}
+	r, binPath := newTestRuntime(t)
+	dir := t.TempDir()
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("pet.proto"), Package: proto.String("pets")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := proto.Marshal(&pluginpb.CodeGeneratorResponse{
+		File: []*pluginpb.CodeGeneratorResponse_File{{Name: proto.String("pet.txt"), Content: proto.String("pet")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"set.binpb":       string(set),
+		"response.binpb":  string(response),
+		"pet.proto":       "syntax = \"proto3\";\n",
+		"protoc-gen-mock": "#!/bin/sh\ncat > request.binpb\ncat response.binpb\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--plugin=" + filepath.Join(dir, "protoc-gen-mock"), "--mock_out=a:.", "--cpp_out=.", "pet.proto"}
+	if err := r.RunBin(context.Background(), binPath, dir, args, nil, &stdout, &stderr); err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, stderr.String())
+	}
+	for _, name := range []string{"pet.txt", "pet.pb.h"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be generated, got: %v", name, err)
+		}
+	}
+	if strings.Contains(stdout.String(), "--mock_out") || strings.Contains(stdout.String(), "--plugin") {
+		t.Errorf("Expected the plugin to run on the host, got:\n%s", stdout.String())
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "request.binpb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &pluginpb.CodeGeneratorRequest{}
+	if err := proto.Unmarshal(content, request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.GetFileToGenerate()) != 1 || request.GetFileToGenerate()[0] != "pet.proto" || request.GetParameter() != "a" {
+		t.Errorf("Expected pet.proto to be generated with a, got %v", request)
+	}
+}
+
+func TestHostToGuest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if guest := hostToGuest(`C:\Users\me\protos`); guest != "/C/Users/me/protos" {
+			t.Errorf("Expected /C/Users/me/protos, got %s", guest)
+		}
+		return
+	}
+	if guest := hostToGuest("/home/me/protos"); guest != "/home/me/protos" {
+		t.Errorf("Expected /home/me/protos, got %s", guest)
+	}
+}